@@ -0,0 +1,141 @@
+package xades
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/beevik/etree"
+)
+
+// unsignedSignaturePropertiesOrder is the order of the properties in xades:UnsignedSignatureProperties,
+// EN 319 132-1: a property relies on the ones placed before it
+var unsignedSignaturePropertiesOrder = map[string]int{
+	SignatureTimeStampTag:      1,
+	CompleteCertificateRefsTag: 2,
+	CompleteRevocationRefsTag:  3,
+	"SigAndRefsTimeStamp":      4,
+	"RefsOnlyTimeStamp":        4,
+	CertificateValuesTag:       5,
+	RevocationValuesTag:        6,
+	SignaturePolicyStoreTag:    7,
+	ArchiveTimeStampTag:        8,
+}
+
+// UnsignedPropertiesBuilder collect the unsigned properties upgrading a signature, e.g. from XAdES-BES to XAdES-T
+// and then XAdES-XL, and add them by Build without re-signing. Properties are added in schema order whatever the
+// order of the calls, each one placed before the properties of the signature that follow it in that order.
+type UnsignedPropertiesBuilder struct {
+	signature *etree.Element
+	steps     []unsignedPropertiesStep
+}
+
+type unsignedPropertiesStep struct {
+	order int
+	add   func(goCtx context.Context) error
+}
+
+// NewUnsignedPropertiesBuilder create UnsignedPropertiesBuilder adding to the QualifyingProperties of signature
+func NewUnsignedPropertiesBuilder(signature *etree.Element) *UnsignedPropertiesBuilder {
+	return &UnsignedPropertiesBuilder{signature: signature}
+}
+
+// SignatureTimeStamp add xades:SignatureTimeStamp, see AddSignatureTimeStamp
+func (b *UnsignedPropertiesBuilder) SignatureTimeStamp(tsCtx *TimeStampContext) *UnsignedPropertiesBuilder {
+	return b.step(SignatureTimeStampTag, func(goCtx context.Context) error {
+		return AddSignatureTimeStamp(goCtx, b.signature, tsCtx)
+	})
+}
+
+// CompleteReferences add xades:CompleteCertificateRefs and xades:CompleteRevocationRefs, see AddCompleteReferences
+func (b *UnsignedPropertiesBuilder) CompleteReferences(refsCtx *CompleteReferencesContext) *UnsignedPropertiesBuilder {
+	return b.step(CompleteCertificateRefsTag, func(goCtx context.Context) error {
+		return AddCompleteReferences(b.signature, refsCtx)
+	})
+}
+
+// ValidationValues add xades:CertificateValues and xades:RevocationValues, see AddValidationValues
+func (b *UnsignedPropertiesBuilder) ValidationValues(valuesCtx *ValidationValuesContext) *UnsignedPropertiesBuilder {
+	return b.step(CertificateValuesTag, func(goCtx context.Context) error {
+		return AddValidationValues(b.signature, valuesCtx)
+	})
+}
+
+// SignaturePolicyStore add xades141:SignaturePolicyStore, see AddSignaturePolicyStore
+func (b *UnsignedPropertiesBuilder) SignaturePolicyStore(storeCtx *SignaturePolicyStoreContext) *UnsignedPropertiesBuilder {
+	return b.step(SignaturePolicyStoreTag, func(goCtx context.Context) error {
+		return AddSignaturePolicyStore(b.signature, storeCtx)
+	})
+}
+
+// ArchiveTimeStamp add xades:ArchiveTimeStamp over the signature and all the properties before it, see AddArchiveTimeStamp
+func (b *UnsignedPropertiesBuilder) ArchiveTimeStamp(tsCtx *TimeStampContext) *UnsignedPropertiesBuilder {
+	return b.step(ArchiveTimeStampTag, func(goCtx context.Context) error {
+		return AddArchiveTimeStamp(goCtx, b.signature, tsCtx)
+	})
+}
+
+// step insert add among the steps after those of the same or an earlier order
+func (b *UnsignedPropertiesBuilder) step(tag string, add func(goCtx context.Context) error) *UnsignedPropertiesBuilder {
+	order := unsignedSignaturePropertiesOrder[tag]
+	i := len(b.steps)
+	for i > 0 && b.steps[i-1].order > order {
+		i--
+	}
+	b.steps = append(b.steps, unsignedPropertiesStep{})
+	copy(b.steps[i+1:], b.steps[i:])
+	b.steps[i] = unsignedPropertiesStep{order: order, add: add}
+	return b
+}
+
+// Build add the collected properties to the signature, goCtx bounds the time-stamp requests. On error the
+// properties of the steps already run stay in the signature, those a step would place before a present
+// ArchiveTimeStamp are removed
+func (b *UnsignedPropertiesBuilder) Build(goCtx context.Context) error {
+
+	for _, step := range b.steps {
+		if err := goCtx.Err(); err != nil {
+			return err
+		}
+		unsignedSignatureProperties, err := findOrCreateUnsignedSignatureProperties(b.signature)
+		if err != nil {
+			return err
+		}
+		present := unsignedSignatureProperties.ChildElements()
+		if err := step.add(goCtx); err != nil {
+			return err
+		}
+		added := unsignedSignatureProperties.ChildElements()[len(present):]
+		for _, property := range added {
+			if err := placeUnsignedSignatureProperty(unsignedSignatureProperties, property, present); err != nil {
+				for _, property := range added {
+					unsignedSignatureProperties.RemoveChild(property)
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// placeUnsignedSignatureProperty move added before the first of the present properties that follows it in
+// schema order, present properties of unknown order stay where they are. An ArchiveTimeStamp covers the
+// properties before it, so added cannot be placed before a present one
+func placeUnsignedSignatureProperty(unsignedSignatureProperties *etree.Element, added *etree.Element, present []*etree.Element) error {
+	order := unsignedSignaturePropertiesOrder[added.Tag]
+	if order < unsignedSignaturePropertiesOrder[ArchiveTimeStampTag] {
+		for _, child := range present {
+			if child.Tag == ArchiveTimeStampTag {
+				return fmt.Errorf("xades: %v cannot be added before the ArchiveTimeStamp that covers the properties before it", added.Tag)
+			}
+		}
+	}
+	for _, child := range present {
+		if unsignedSignaturePropertiesOrder[child.Tag] > order {
+			index := child.Index()
+			unsignedSignatureProperties.RemoveChild(added)
+			unsignedSignatureProperties.InsertChildAt(index, added)
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package xades
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"testing"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsignedPropertiesBuilder(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	client := &fakeTimestampClient{}
+	tsCtx := &TimeStampContext{
+		Client:        client,
+		Hash:          crypto.SHA256,
+		Canonicalizer: dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""),
+		SignedData:    signedData,
+	}
+	ca := newTestKeyStoreFromTemplate(t, &x509.Certificate{})
+	refsCtx := &CompleteReferencesContext{CertChain: []*x509.Certificate{ca.Cert}, Hash: crypto.SHA256}
+	valuesCtx := &ValidationValuesContext{CertChain: []*x509.Certificate{ca.Cert}, OCSPResponses: [][]byte{[]byte("ocsp")}}
+
+	tags := func() []string {
+		var tags []string
+		for _, child := range signature.FindElement(unsignedSignaturePropertiesPath("ds")).ChildElements() {
+			tags = append(tags, child.Tag)
+		}
+		return tags
+	}
+
+	require.NoError(t, NewUnsignedPropertiesBuilder(signature).SignatureTimeStamp(tsCtx).Build(context.Background()))
+	require.Equal(t, []string{SignatureTimeStampTag}, tags())
+
+	err = NewUnsignedPropertiesBuilder(signature).
+		ArchiveTimeStamp(tsCtx).
+		ValidationValues(valuesCtx).
+		CompleteReferences(refsCtx).
+		Build(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{SignatureTimeStampTag, CompleteCertificateRefsTag, CompleteRevocationRefsTag,
+		CertificateValuesTag, RevocationValuesTag, ArchiveTimeStampTag}, tags())
+	require.Len(t, client.digests, 2)
+
+	// the ArchiveTimeStamp would no longer cover the properties before it
+	err = NewUnsignedPropertiesBuilder(signature).SignatureTimeStamp(tsCtx).Build(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ArchiveTimeStampTag)
+	require.Equal(t, []string{SignatureTimeStampTag, CompleteCertificateRefsTag, CompleteRevocationRefsTag,
+		CertificateValuesTag, RevocationValuesTag, ArchiveTimeStampTag}, tags())
+	require.NoError(t, NewUnsignedPropertiesBuilder(signature).ArchiveTimeStamp(tsCtx).Build(context.Background()))
+
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, NewUnsignedPropertiesBuilder(signature).ValidationValues(valuesCtx).Build(context.Background()))
+	require.NoError(t, NewUnsignedPropertiesBuilder(signature).SignatureTimeStamp(tsCtx).Build(context.Background()))
+	require.Equal(t, []string{SignatureTimeStampTag, CertificateValuesTag, RevocationValuesTag}, tags())
+
+	tsCtx.Client = nil
+	require.Error(t, NewUnsignedPropertiesBuilder(signature).ArchiveTimeStamp(tsCtx).Build(context.Background()))
+}
@@ -0,0 +1,135 @@
+package xades
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// defaultNamespaceToken is the InclusiveNamespaces PrefixList token of the default namespace
+const defaultNamespaceToken string = "#default"
+
+// exclusiveCanonicalizer return exclusive c14n 1.0 with the InclusiveNamespaces prefixList, comments tells
+// whether comments are kept. goxmldsig ignores the "#default" token, a prefix list holding it is canonicalized
+// by defaultNamespaceCanonicalizer
+func exclusiveCanonicalizer(prefixList string, comments bool) dsig.Canonicalizer {
+	for _, prefix := range strings.Fields(prefixList) {
+		if prefix == defaultNamespaceToken {
+			return &defaultNamespaceCanonicalizer{prefixList: prefixList, comments: comments}
+		}
+	}
+	if comments {
+		return dsig.MakeC14N10ExclusiveWithCommentsCanonicalizerWithPrefixList(prefixList)
+	}
+	return dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(prefixList)
+}
+
+// defaultNamespaceCanonicalizer is exclusive c14n 1.0 whose PrefixList holds "#default": the default namespace
+// is rendered as by inclusive c14n, wherever it differs from the one rendered by the closest output ancestor,
+// whether or not the element is in it
+type defaultNamespaceCanonicalizer struct {
+	prefixList string
+	comments   bool
+}
+
+func (c *defaultNamespaceCanonicalizer) Algorithm() dsig.AlgorithmID {
+	if c.comments {
+		return dsig.CanonicalXML10ExclusiveWithCommentsAlgorithmId
+	}
+	return dsig.CanonicalXML10ExclusiveAlgorithmId
+}
+
+func (c *defaultNamespaceCanonicalizer) Canonicalize(el *etree.Element) ([]byte, error) {
+
+	inclusive := make(map[string]bool)
+	for _, prefix := range strings.Fields(c.prefixList) {
+		if prefix == defaultNamespaceToken {
+			prefix = ""
+		}
+		inclusive[prefix] = true
+	}
+	scope := map[string]string{"xml": etreeutils.XMLNamespace, "": ""}
+	rendered := map[string]string{"xml": etreeutils.XMLNamespace, "": ""}
+	if err := transformExclusive(el, scope, rendered, inclusive, c.comments); err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(el.Copy())
+	doc.WriteSettings = etree.WriteSettings{
+		CanonicalAttrVal: true,
+		CanonicalEndTags: true,
+		CanonicalText:    true,
+	}
+	return doc.WriteToBytes()
+}
+
+// transformExclusive rewrite the namespace declarations of el and its descendants as rendered by exclusive c14n,
+// scope maps the prefixes in scope at the parent of el to their namespace and rendered those declared by the
+// closest output ancestors
+func transformExclusive(el *etree.Element, scope map[string]string, rendered map[string]string, inclusive map[string]bool, comments bool) error {
+
+	scope = copyNamespaces(scope)
+	utilized := map[string]bool{el.Space: true}
+	var attrs []etree.Attr
+	for _, attr := range el.Attr {
+		if prefix, ok := namespacePrefix(attr); ok {
+			scope[prefix] = attr.Value
+			if inclusive[prefix] {
+				utilized[prefix] = true
+			}
+			continue
+		}
+		if attr.Space != "" {
+			utilized[attr.Space] = true
+		}
+		attrs = append(attrs, attr)
+	}
+
+	rendered = copyNamespaces(rendered)
+	for prefix := range utilized {
+		uri, ok := scope[prefix]
+		if !ok {
+			return fmt.Errorf("xades: undeclared namespace prefix %q", prefix)
+		}
+		if rendered[prefix] == uri {
+			continue
+		}
+		rendered[prefix] = uri
+		if prefix == "" {
+			attrs = append(attrs, etree.Attr{Key: "xmlns", Value: uri})
+		} else {
+			attrs = append(attrs, etree.Attr{Space: "xmlns", Key: prefix, Value: uri})
+		}
+	}
+	sort.Sort(etreeutils.SortedAttrs(attrs))
+	el.Attr = attrs
+
+	if !comments {
+		for i := 0; i < len(el.Child); {
+			if _, ok := el.Child[i].(*etree.Comment); ok {
+				el.RemoveChildAt(i)
+			} else {
+				i++
+			}
+		}
+	}
+	for _, child := range el.ChildElements() {
+		if err := transformExclusive(child, scope, rendered, inclusive, comments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyNamespaces(namespaces map[string]string) map[string]string {
+	copied := make(map[string]string, len(namespaces)+1)
+	for prefix, uri := range namespaces {
+		copied[prefix] = uri
+	}
+	return copied
+}
@@ -0,0 +1,79 @@
+package xades
+
+import (
+	"crypto"
+	"crypto/x509"
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultNamespace(t *testing.T) {
+	const defaultNamespaceXML = `<Invoice xmlns="urn:invoice" id="invoice"><Line amount="1">first</Line><Line amount="2">second</Line></Invoice>`
+
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.ReferenceURI = "#invoice"
+	root, signature := signAndReparse(t, defaultNamespaceXML, ctx)
+	_, err := (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+
+	ctx.PlainXMLDSig = true
+	root, _ = signAndReparse(t, defaultNamespaceXML, ctx)
+	certificateStore := &dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{ctx.KeyStore.Cert}}
+	validationContext := dsig.NewDefaultValidationContext(certificateStore)
+	validationContext.IdAttribute = "id"
+	validationContext.Clock = dsig.NewFakeClockAt(ctx.KeyStore.Cert.NotBefore)
+	_, err = validationContext.Validate(root)
+	require.NoError(t, err)
+}
+
+func TestDefaultNamespaceToken(t *testing.T) {
+	const nestedPayloadXML = `<doc xmlns="urn:a"><x:payload xmlns:x="urn:x" id="payload"><x:v>1</x:v><w/></x:payload></doc>`
+	const canonicalPayload = `<x:payload xmlns="urn:a" xmlns:x="urn:x" id="payload"><x:v>1</x:v><w></w></x:payload>`
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(nestedPayloadXML))
+	payload := doc.Root().SelectElement("payload").Copy()
+	payload.CreateAttr("xmlns", "urn:a")
+	canonical, err := exclusiveCanonicalizer("#default x", false).Canonicalize(payload)
+	require.NoError(t, err)
+	require.Equal(t, canonicalPayload, string(canonical))
+	canonical, err = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("#default x").Canonicalize(payload)
+	require.NoError(t, err)
+	require.NotEqual(t, canonicalPayload, string(canonical))
+
+	for _, prefixList := range []string{"", "x", "x y"} {
+		for _, comments := range []bool{false, true} {
+			expected, err := exclusiveCanonicalizer(prefixList, comments).Canonicalize(payload)
+			require.NoError(t, err)
+			canonical, err := (&defaultNamespaceCanonicalizer{prefixList: prefixList, comments: comments}).Canonicalize(payload)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), string(canonical), prefixList)
+		}
+	}
+
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.IsEnveloped = false
+	ctx.DataContext.InclusiveNamespaces = "#default"
+	doc = etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(nestedPayloadXML))
+	_, err = SignElementByID(doc, "payload", ctx)
+	require.NoError(t, err)
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+
+	signedData := parsed.Root().SelectElement("payload")
+	signature := parsed.Root().SelectElement(dsig.SignatureTag)
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Equal(t, DigestBytes([]byte(canonicalPayload), crypto.SHA256), reference.FindElement("ds:"+dsig.DigestValueTag).Text())
+	_, err = (&VerifyContext{}).Verify(signature, signedData)
+	require.NoError(t, err)
+
+	signedData.SelectElement("w").SetText("tampered")
+	_, err = (&VerifyContext{}).Verify(signature, signedData)
+	require.Error(t, err)
+}
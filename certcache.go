@@ -0,0 +1,177 @@
+package xades
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/beevik/etree"
+)
+
+// certCacheSize bounds the number of certificates in certCache, which is emptied when full
+const certCacheSize = 64
+
+// certCacheEntry hold the values every signature with a certificate derives from it again: the base64 of its DER
+// encoding, the text of its IssuerSerial, its CertDigest values by hash and the ds:KeyInfo built with it
+type certCacheEntry struct {
+	der            []byte
+	base64         string
+	issuerName     string
+	serialNumber   string
+	issuerSerialV2 []byte
+	digests        map[crypto.Hash]string
+	keyInfos       map[keyInfoCacheKey]*etree.Element
+}
+
+// keyInfoCacheKey is what ds:KeyInfo depends on besides the signing certificate, chain identifies the certificates
+// of KeyStore.CertChain in order
+type keyInfoCacheKey struct {
+	keyInfoCtx    KeyInfoContext
+	chain         string
+	lineWidth     int
+	xmlDsigPrefix string
+}
+
+// certCacheMu guards certCache, it is never held while computing a value, which may take algorithmsMu
+var certCacheMu sync.Mutex
+
+// certCache caches certCacheEntry by certificate, so repeated signing with the same key store only digests the
+// references, computes the signature and copies the cached ds:KeyInfo. Certificates are treated as immutable, an
+// entry is dropped when the certificate comes with other DER bytes
+var certCache = map[*x509.Certificate]*certCacheEntry{}
+
+// resetCertCache empty certCache
+func resetCertCache() {
+	certCacheMu.Lock()
+	defer certCacheMu.Unlock()
+	certCache = map[*x509.Certificate]*certCacheEntry{}
+}
+
+// cachedCert return a copy of the cache entry of cert with DER encoding der, without digests other than the one by
+// hash, a fresh entry when there is none yet
+func cachedCert(cert *x509.Certificate, der []byte, hash crypto.Hash) certCacheEntry {
+	certCacheMu.Lock()
+	defer certCacheMu.Unlock()
+	entry, ok := certCache[cert]
+	if !ok || !bytes.Equal(entry.der, der) {
+		return certCacheEntry{der: der}
+	}
+	copied := *entry
+	copied.digests, copied.keyInfos = nil, nil
+	if digest, ok := entry.digests[hash]; ok {
+		copied.digests = map[crypto.Hash]string{hash: digest}
+	}
+	return copied
+}
+
+// storeCert update the cache entry of cert with the values set in entry
+func storeCert(cert *x509.Certificate, entry certCacheEntry) {
+	certCacheMu.Lock()
+	defer certCacheMu.Unlock()
+	cached := certCacheEntryOf(cert, entry.der)
+	if entry.base64 != "" {
+		cached.base64 = entry.base64
+	}
+	if entry.issuerName != "" {
+		cached.issuerName, cached.serialNumber = entry.issuerName, entry.serialNumber
+	}
+	if entry.issuerSerialV2 != nil {
+		cached.issuerSerialV2 = entry.issuerSerialV2
+	}
+	for hash, digest := range entry.digests {
+		cached.digests[hash] = digest
+	}
+}
+
+// certCacheEntryOf return the cache entry of cert with DER encoding der, replacing a missing or stale one. The
+// caller holds certCacheMu
+func certCacheEntryOf(cert *x509.Certificate, der []byte) *certCacheEntry {
+	cached, ok := certCache[cert]
+	if !ok || !bytes.Equal(cached.der, der) {
+		if len(certCache) >= certCacheSize {
+			certCache = map[*x509.Certificate]*certCacheEntry{}
+		}
+		cached = &certCacheEntry{der: der, digests: map[crypto.Hash]string{}, keyInfos: map[keyInfoCacheKey]*etree.Element{}}
+		certCache[cert] = cached
+	}
+	return cached
+}
+
+// newKeyInfoCacheKey return the key of the ds:KeyInfo built from keyStore with keyInfoCtx
+func newKeyInfoCacheKey(keyStore *MemoryX509KeyStore, keyInfoCtx *KeyInfoContext, lineWidth int, xmlDsigPrefix string) keyInfoCacheKey {
+	chain := make([]string, len(keyStore.CertChain))
+	for i, cert := range keyStore.CertChain {
+		chain[i] = fmt.Sprintf("%p", cert)
+	}
+	return keyInfoCacheKey{keyInfoCtx: *keyInfoCtx, chain: strings.Join(chain, ","), lineWidth: lineWidth, xmlDsigPrefix: xmlDsigPrefix}
+}
+
+// cachedKeyInfo return a copy of the ds:KeyInfo cached for keyStore and key, nil when there is none yet
+func cachedKeyInfo(keyStore *MemoryX509KeyStore, key keyInfoCacheKey) *etree.Element {
+	certCacheMu.Lock()
+	entry, ok := certCache[keyStore.Cert]
+	var keyInfo *etree.Element
+	if ok && bytes.Equal(entry.der, keyStore.CertBinary) {
+		keyInfo = entry.keyInfos[key]
+	}
+	certCacheMu.Unlock()
+	if keyInfo == nil {
+		return nil
+	}
+	return keyInfo.Copy()
+}
+
+// storeKeyInfo cache a copy of keyInfo, built from keyStore, under key
+func storeKeyInfo(keyStore *MemoryX509KeyStore, key keyInfoCacheKey, keyInfo *etree.Element) {
+	keyInfo = keyInfo.Copy()
+	certCacheMu.Lock()
+	defer certCacheMu.Unlock()
+	certCacheEntryOf(keyStore.Cert, keyStore.CertBinary).keyInfos[key] = keyInfo
+}
+
+// certBase64 return the base64 encoding of der, the DER encoding of cert
+func certBase64(cert *x509.Certificate, der []byte) string {
+	if entry := cachedCert(cert, der, 0); entry.base64 != "" {
+		return entry.base64
+	}
+	encoded := base64.StdEncoding.EncodeToString(der)
+	storeCert(cert, certCacheEntry{der: der, base64: encoded})
+	return encoded
+}
+
+// certDigest return the base64 digest with hash of der, the DER encoding of cert
+func certDigest(cert *x509.Certificate, der []byte, hash crypto.Hash) string {
+	if digest, ok := cachedCert(cert, der, hash).digests[hash]; ok {
+		return digest
+	}
+	digest := DigestBytes(der, hash)
+	storeCert(cert, certCacheEntry{der: der, digests: map[crypto.Hash]string{hash: digest}})
+	return digest
+}
+
+// certIssuerSerial return the X509IssuerName and X509SerialNumber text of cert
+func certIssuerSerial(cert *x509.Certificate) (issuerName string, serialNumber string) {
+	if entry := cachedCert(cert, cert.Raw, 0); entry.issuerName != "" {
+		return entry.issuerName, entry.serialNumber
+	}
+	issuerName, serialNumber = cert.Issuer.String(), cert.SerialNumber.String()
+	storeCert(cert, certCacheEntry{der: cert.Raw, issuerName: issuerName, serialNumber: serialNumber})
+	return issuerName, serialNumber
+}
+
+// certIssuerSerialV2 return the DER encoded IssuerSerial of cert of the IssuerSerialV2 element
+func certIssuerSerialV2(cert *x509.Certificate) ([]byte, error) {
+	if entry := cachedCert(cert, cert.Raw, 0); entry.issuerSerialV2 != nil {
+		return entry.issuerSerialV2, nil
+	}
+	der, err := marshalIssuerSerial(cert)
+	if err != nil {
+		return nil, err
+	}
+	storeCert(cert, certCacheEntry{der: cert.Raw, issuerSerialV2: der})
+	return der, nil
+}
@@ -0,0 +1,102 @@
+package xades
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertCache(t *testing.T) {
+	resetCertCache()
+	keyStore := newTestKeyStoreFromTemplate(t, &x509.Certificate{SerialNumber: big.NewInt(42)})
+	cert := keyStore.Cert
+
+	for i := 0; i < 2; i++ {
+		require.Equal(t, base64.StdEncoding.EncodeToString(cert.Raw), certBase64(cert, cert.Raw))
+		require.Equal(t, DigestBytes(cert.Raw, crypto.SHA1), certDigest(cert, cert.Raw, crypto.SHA1))
+		require.Equal(t, DigestBytes(cert.Raw, crypto.SHA256), certDigest(cert, cert.Raw, crypto.SHA256))
+		issuerName, serialNumber := certIssuerSerial(cert)
+		require.Equal(t, cert.Issuer.String(), issuerName)
+		require.Equal(t, "42", serialNumber)
+		expected, err := marshalIssuerSerial(cert)
+		require.NoError(t, err)
+		issuerSerialV2, err := certIssuerSerialV2(cert)
+		require.NoError(t, err)
+		require.Equal(t, expected, issuerSerialV2)
+	}
+	require.Len(t, certCache, 1)
+	require.Len(t, certCache[cert].digests, 2)
+
+	// the same certificate with other DER bytes is not served from the cache
+	other := newTestKeyStoreFromTemplate(t, &x509.Certificate{SerialNumber: big.NewInt(43)}).Cert
+	require.Equal(t, DigestBytes(other.Raw, crypto.SHA256), certDigest(cert, other.Raw, crypto.SHA256))
+	require.Equal(t, DigestBytes(cert.Raw, crypto.SHA256), certDigest(cert, cert.Raw, crypto.SHA256))
+
+	for i := 0; i < certCacheSize; i++ {
+		certBase64(&x509.Certificate{}, []byte{byte(i)})
+	}
+	require.LessOrEqual(t, len(certCache), certCacheSize)
+
+	ctx := newTestSigningContext(t)
+	ctx.KeyStore = *keyStore
+	first, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	second, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	serialize := func(signature *etree.Element) string {
+		doc := etree.NewDocument()
+		doc.SetRoot(signature)
+		serialized, err := doc.WriteToString()
+		require.NoError(t, err)
+		return serialized
+	}
+	require.Equal(t, serialize(first), serialize(second))
+	require.Len(t, certCache[cert].keyInfos, 1)
+
+	// every signature gets its own copy of the cached KeyInfo
+	findChild(second, dsig.KeyInfoTag).CreateElement("ds:KeyName").SetText("changed")
+	third, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Equal(t, serialize(first), serialize(third))
+
+	ctx.KeyInfoContext.IncludeX509IssuerSerial = true
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Len(t, certCache[cert].keyInfos, 2)
+}
+
+// BenchmarkCertificateElements signing with the same key store encodes and digests its certificate and builds
+// its KeyInfo once
+func BenchmarkCertificateElements(b *testing.B) {
+	ctx, err := prepareSigningContext(newTestSigningContext(b))
+	require.NoError(b, err)
+	ctx.KeyInfoContext.IncludeX509IssuerSerial = true
+	signingTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		name   string
+		cached bool
+	}{{"cached", true}, {"uncached", false}} {
+		b.Run(test.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !test.cached {
+					resetCertCache()
+				}
+				if _, err := createSignedProperties(&ctx.KeyStore, signingTime, "", ctx); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := createKeyInfo(&ctx.KeyStore, &ctx.KeyInfoContext, ctx.IssuerNameFormat, ctx.Base64LineWidth, ctx.XmlDsigPrefix); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
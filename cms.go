@@ -0,0 +1,211 @@
+package xades
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	oidContentTypeAttr   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigestAttr = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+// cmsContentInfo, cmsSignedData and cmsSignerInfo are the RFC 5652 structures of a TimeStampToken as read by
+// VerifyTimeStampToken, raw fields keep the encoding the signature is computed over
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	SignedData  cmsSignedData `asn1:"explicit,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,tag:0"`
+	}
+	Certificates cmsRawContent   `asn1:"optional,tag:0"`
+	CRLs         []asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos  []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        cmsRawContent `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      cmsRawContent `asn1:"optional,tag:1"`
+}
+
+// cmsRawContent hold the DER encoding of an implicitly tagged SET, its tag included
+type cmsRawContent struct {
+	Raw asn1.RawContent
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// cmsSignatureAlgorithms map the signature algorithm OIDs of a SignerInfo to x509.SignatureAlgorithm, the key
+// algorithms rsaEncryption and id-ecPublicKey are completed by the digest algorithm
+var cmsSignatureAlgorithms = map[string]map[crypto.Hash]x509.SignatureAlgorithm{
+	"1.2.840.113549.1.1.1":  {crypto.SHA1: x509.SHA1WithRSA, crypto.SHA256: x509.SHA256WithRSA, crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA},
+	"1.2.840.113549.1.1.5":  {0: x509.SHA1WithRSA},
+	"1.2.840.113549.1.1.11": {0: x509.SHA256WithRSA},
+	"1.2.840.113549.1.1.12": {0: x509.SHA384WithRSA},
+	"1.2.840.113549.1.1.13": {0: x509.SHA512WithRSA},
+	"1.2.840.10045.2.1":     {crypto.SHA1: x509.ECDSAWithSHA1, crypto.SHA256: x509.ECDSAWithSHA256, crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512},
+	"1.2.840.10045.4.1":     {0: x509.ECDSAWithSHA1},
+	"1.2.840.10045.4.3.2":   {0: x509.ECDSAWithSHA256},
+	"1.2.840.10045.4.3.3":   {0: x509.ECDSAWithSHA384},
+	"1.2.840.10045.4.3.4":   {0: x509.ECDSAWithSHA512},
+}
+
+// VerifyTimeStampToken check the CMS signature of the time-stamping authority on the DER encoded RFC 3161
+// TimeStampToken token and return its TSTInfo. The single SignerInfo must carry the content-type and
+// message-digest signed attributes over the TSTInfo, and its certificate, found among the certificates of token,
+// must chain to roots at GenTime with the timeStamping extended key usage. The message imprint is not compared
+// with any data, see VerifySignatureTimeStamp
+func VerifyTimeStampToken(token []byte, roots *x509.CertPool) (*TimeStampToken, error) {
+
+	if roots == nil {
+		return nil, errors.New("xades: verifying a TimeStampToken requires the roots of the time-stamping authority")
+	}
+	parsed, err := ParseTimeStampToken(token)
+	if err != nil {
+		return nil, err
+	}
+	var content cmsContentInfo
+	if _, err := asn1.Unmarshal(token, &content); err != nil {
+		return nil, fmt.Errorf("xades: parsing TimeStampToken: %w", err)
+	}
+	signedData := content.SignedData
+	if len(signedData.SignerInfos) != 1 {
+		return nil, fmt.Errorf("xades: TimeStampToken has %d SignerInfo, one is required", len(signedData.SignerInfos))
+	}
+	signerInfo := signedData.SignerInfos[0]
+
+	var certs []*x509.Certificate
+	if len(signedData.Certificates.Raw) > 0 {
+		var set asn1.RawValue
+		if _, err := asn1.Unmarshal(signedData.Certificates.Raw, &set); err != nil {
+			return nil, fmt.Errorf("xades: parsing TimeStampToken certificates: %w", err)
+		}
+		if certs, err = x509.ParseCertificates(set.Bytes); err != nil {
+			return nil, fmt.Errorf("xades: parsing TimeStampToken certificates: %w", err)
+		}
+	}
+	signer, err := findSignerCertificate(signerInfo.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, ok := imprintHashes[signerInfo.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("xades: unsupported TimeStampToken digest algorithm %v", signerInfo.DigestAlgorithm.Algorithm)
+	}
+	if err := checkSignedAttributes(signerInfo.SignedAttrs.Raw, digestSum(signedData.EncapContentInfo.EContent, hash)); err != nil {
+		return nil, err
+	}
+	algorithms := cmsSignatureAlgorithms[signerInfo.SignatureAlgorithm.Algorithm.String()]
+	algorithm, ok := algorithms[0]
+	if !ok {
+		if algorithm, ok = algorithms[hash]; !ok {
+			return nil, fmt.Errorf("xades: unsupported TimeStampToken signature algorithm %v with digest %v",
+				signerInfo.SignatureAlgorithm.Algorithm, signerInfo.DigestAlgorithm.Algorithm)
+		}
+	}
+	// the signature covers the DER encoding of the signed attributes with the SET OF tag instead of [0]
+	signedAttrs := append([]byte{asn1.TagSet | 0x20}, signerInfo.SignedAttrs.Raw[1:]...)
+	if err := signer.CheckSignature(algorithm, signedAttrs, signerInfo.Signature); err != nil {
+		return nil, fmt.Errorf("xades: TimeStampToken signature does not verify: %w", err)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs {
+		intermediates.AddCert(cert)
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   parsed.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return nil, fmt.Errorf("xades: TimeStampToken certificate %q: %w", signer.Subject.String(), err)
+	}
+	return parsed, nil
+}
+
+// findSignerCertificate return the certificate of certs identified by sid, an IssuerAndSerialNumber or a
+// [0] SubjectKeyIdentifier
+func findSignerCertificate(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	var issuerAndSerial cmsIssuerAndSerialNumber
+	isIssuerAndSerial := sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence
+	if isIssuerAndSerial {
+		if _, err := asn1.Unmarshal(sid.FullBytes, &issuerAndSerial); err != nil {
+			return nil, fmt.Errorf("xades: parsing TimeStampToken signer identifier: %w", err)
+		}
+	} else if sid.Class != asn1.ClassContextSpecific || sid.Tag != 0 {
+		return nil, errors.New("xades: unsupported TimeStampToken signer identifier")
+	}
+	for _, cert := range certs {
+		if isIssuerAndSerial && bytes.Equal(cert.RawIssuer, issuerAndSerial.Issuer.FullBytes) && cert.SerialNumber.Cmp(issuerAndSerial.SerialNumber) == 0 {
+			return cert, nil
+		}
+		if !isIssuerAndSerial && len(cert.SubjectKeyId) > 0 && bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("xades: TimeStampToken does not carry the certificate of its signer")
+}
+
+// checkSignedAttributes check that the DER encoded signed attributes raw announce TSTInfo content of digest
+func checkSignedAttributes(raw []byte, digest []byte) error {
+	if len(raw) == 0 {
+		return errors.New("xades: TimeStampToken SignerInfo has no signed attributes")
+	}
+	var set asn1.RawValue
+	if _, err := asn1.Unmarshal(raw, &set); err != nil {
+		return fmt.Errorf("xades: parsing TimeStampToken signed attributes: %w", err)
+	}
+	contentTypeChecked, digestChecked := false, false
+	for rest := set.Bytes; len(rest) > 0; {
+		var attribute cmsAttribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attribute); err != nil {
+			return fmt.Errorf("xades: parsing TimeStampToken signed attributes: %w", err)
+		}
+		switch {
+		case attribute.Type.Equal(oidContentTypeAttr):
+			var contentType asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(attribute.Values.Bytes, &contentType); err != nil || !contentType.Equal(oidTSTInfo) {
+				return errors.New("xades: TimeStampToken content-type attribute is not TSTInfo")
+			}
+			contentTypeChecked = true
+		case attribute.Type.Equal(oidMessageDigestAttr):
+			var messageDigest []byte
+			if _, err := asn1.Unmarshal(attribute.Values.Bytes, &messageDigest); err != nil || !bytes.Equal(messageDigest, digest) {
+				return errors.New("xades: TimeStampToken message-digest attribute does not match the TSTInfo")
+			}
+			digestChecked = true
+		}
+	}
+	if !contentTypeChecked || !digestChecked {
+		return errors.New("xades: TimeStampToken signed attributes require content-type and message-digest")
+	}
+	return nil
+}
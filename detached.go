@@ -0,0 +1,44 @@
+package xades
+
+import (
+	"context"
+	"errors"
+
+	"github.com/beevik/etree"
+)
+
+// CreateDetachedSignature create a standalone signature document over the external data referenced by uri,
+// e.g. the name of the signed file. data is digested as is whatever its content type, e.g. a PNG or PDF, the data
+// reference has no Transforms element and ctx.DataContext.ReferenceURI, IsEnveloped and Canonicalizer are ignored;
+// the content type may be declared by PropertiesContext.DataObjectFormat. Transforms of the data that cannot apply
+// to raw octets, Base64Transform, XSLTStylesheet, Transforms, OmitTransforms, ExcludeSignatures and
+// InclusiveNamespaces, are rejected. ctx is not modified.
+func CreateDetachedSignature(data []byte, uri string, ctx *SigningContext) (*etree.Document, error) {
+
+	dataCtx := &ctx.DataContext
+	if dataCtx.Base64Transform || dataCtx.XSLTStylesheet != nil || dataCtx.Transforms != nil || dataCtx.OmitTransforms ||
+		dataCtx.ExcludeSignatures || dataCtx.InclusiveNamespaces != "" {
+		return nil, errors.New("xades: detached data is digested as is, Base64Transform, XSLTStylesheet, Transforms, " +
+			"OmitTransforms, ExcludeSignatures and InclusiveNamespaces do not apply")
+	}
+	ctx, err := prepareSigningContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx.DataContext.ReferenceURI = uri
+	ctx.DataContext.IsEnveloped = false
+
+	signatureIdPrefix, err := createSignatureIdPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := createSignature(context.Background(), data, false, signatureIdPrefix, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	doc.SetRoot(signature)
+	return doc, nil
+}
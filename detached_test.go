@@ -0,0 +1,118 @@
+package xades
+
+import (
+	"crypto"
+	"errors"
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateDetachedSignature(t *testing.T) {
+	data := []byte("%PDF-1.4 detached content")
+
+	ctx := newTestSigningContext(t)
+	doc, err := CreateDetachedSignature(data, "document.pdf", ctx)
+	require.NoError(t, err)
+	require.True(t, ctx.DataContext.IsEnveloped)
+	require.Equal(t, "#signedData", ctx.DataContext.ReferenceURI)
+
+	signature := doc.Root()
+	require.Equal(t, dsig.SignatureTag, signature.Tag)
+	require.NoError(t, ValidateStructure(signature))
+
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Equal(t, "document.pdf", reference.SelectAttrValue(dsig.URIAttr, ""))
+	require.Nil(t, reference.SelectElement("ds:"+dsig.TransformsTag))
+	require.Equal(t, DigestBytes(data, crypto.SHA256), reference.SelectElement("ds:"+dsig.DigestValueTag).Text())
+
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+	require.Equal(t, dsig.Namespace, parsed.Root().SelectAttrValue("xmlns:ds", ""))
+}
+
+func TestVerifyDetachedSignature(t *testing.T) {
+	data := []byte("%PDF-1.4 detached content")
+
+	ctx := newTestSigningContext(t)
+	doc, err := CreateDetachedSignature(data, "document.pdf", ctx)
+	require.NoError(t, err)
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+	signature := parsed.Root()
+
+	var resolved []string
+	resolve := func(content []byte) func(uri string) ([]byte, error) {
+		return func(uri string) ([]byte, error) {
+			resolved = append(resolved, uri)
+			if uri != "document.pdf" {
+				return nil, errors.New("not found")
+			}
+			return content, nil
+		}
+	}
+	_, err = (&VerifyContext{ResolveURI: resolve(data)}).Verify(signature, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"document.pdf"}, resolved)
+
+	_, err = (&VerifyContext{}).Verify(signature, nil)
+	require.Error(t, err)
+	_, err = (&VerifyContext{ResolveURI: resolve([]byte("%PDF-1.4 other content"))}).Verify(signature, nil)
+	require.Error(t, err)
+	signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.ReferenceTag).CreateAttr(dsig.URIAttr, "missing.pdf")
+	_, err = (&VerifyContext{ResolveURI: resolve(data)}).Verify(signature, nil)
+	require.Error(t, err)
+
+	resolved = nil
+	root, signature := signAndReparse(t, testXML, ctx)
+	_, err = (&VerifyContext{ResolveURI: resolve(data)}).Verify(signature, root)
+	require.NoError(t, err)
+	require.Empty(t, resolved)
+}
+
+func TestDetachedBinaryReference(t *testing.T) {
+	// PNG signature and IHDR chunk start, not XML
+	data := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0x0d, 'I', 'H', 'D', 'R', 0xff, 0x00}
+
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.DataObjectFormat = &DataObjectFormat{MimeType: "image/png"}
+	doc, err := CreateDetachedSignature(data, "https://example.com/images/logo.png", ctx)
+	require.NoError(t, err)
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+	signature := parsed.Root()
+
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Equal(t, "https://example.com/images/logo.png", reference.SelectAttrValue(dsig.URIAttr, ""))
+	require.Nil(t, reference.SelectElement("ds:"+dsig.TransformsTag))
+	require.Equal(t, DigestBytes(data, crypto.SHA256), reference.SelectElement("ds:"+dsig.DigestValueTag).Text())
+	dataObjectFormat := findPath(findQualifyingProperties(signature), SignedPropertiesTag, SignedDataObjectPropertiesTag, DataObjectFormatTag)
+	require.Equal(t, "image/png", findChild(dataObjectFormat, "MimeType").Text())
+
+	resolve := func(uri string) ([]byte, error) { return data, nil }
+	_, err = (&VerifyContext{ResolveURI: resolve}).Verify(signature, nil)
+	require.NoError(t, err)
+
+	for name, configure := range map[string]func(dataCtx *SignedDataContext){
+		"Base64Transform":     func(dataCtx *SignedDataContext) { dataCtx.Base64Transform = true },
+		"XSLTStylesheet":      func(dataCtx *SignedDataContext) { dataCtx.XSLTStylesheet = []byte("<xsl:stylesheet/>") },
+		"Transforms":          func(dataCtx *SignedDataContext) { dataCtx.Transforms = []DataTransform{} },
+		"OmitTransforms":      func(dataCtx *SignedDataContext) { dataCtx.OmitTransforms = true },
+		"ExcludeSignatures":   func(dataCtx *SignedDataContext) { dataCtx.ExcludeSignatures = true },
+		"InclusiveNamespaces": func(dataCtx *SignedDataContext) { dataCtx.InclusiveNamespaces = "#default" },
+	} {
+		configured := *ctx
+		configure(&configured.DataContext)
+		_, err = CreateDetachedSignature(data, "logo.png", &configured)
+		require.EqualError(t, err, "xades: detached data is digested as is, Base64Transform, XSLTStylesheet, Transforms, "+
+			"OmitTransforms, ExcludeSignatures and InclusiveNamespaces do not apply", name)
+	}
+}
@@ -0,0 +1,351 @@
+package xades
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// SignEnveloped sign the root element of a copy of doc with an enveloped XAdES-BES signature and return the signed copy.
+// Exclusive canonicalization and hash are used everywhere, the reference points at the Id attribute of the root
+// and the Signature is appended as the last child of the root.
+func SignEnveloped(doc *etree.Document, keyStore *MemoryX509KeyStore, hash crypto.Hash) (*etree.Document, error) {
+
+	signedDoc := doc.Copy()
+	root := signedDoc.Root()
+	if root == nil {
+		return nil, errors.New("xades: document has no root element")
+	}
+	id := elementId(root)
+	if id == "" {
+		return nil, errors.New("xades: root element has no Id attribute to reference")
+	}
+
+	ctx := NewSigningContext(keyStore, WithHash(hash), WithEnveloped(), WithReferenceURI("#"+id))
+
+	signature, err := CreateSignature(root, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := InsertSignature(root, signature, PositionLast, ""); err != nil {
+		return nil, err
+	}
+	return signedDoc, nil
+}
+
+// SignElementByID sign the element of doc whose Id, ID or xml:id attribute equals id with reference URI "#id"
+// and insert the Signature into doc: as the last child of the element when ctx.DataContext.IsEnveloped,
+// otherwise right after the element. ctx is not modified.
+func SignElementByID(doc *etree.Document, id string, ctx *SigningContext) (*etree.Element, error) {
+
+	root := doc.Root()
+	if root == nil {
+		return nil, errors.New("xades: document has no root element")
+	}
+	signedData := findElementById(root, id)
+	if signedData == nil {
+		return nil, fmt.Errorf("xades: no element with Id %q in document", id)
+	}
+	if !ctx.DataContext.IsEnveloped && signedData == root {
+		return nil, fmt.Errorf("xades: element with Id %q is the root element, a detached signature cannot be placed next to it", id)
+	}
+
+	referenceCtx := *ctx
+	referenceCtx.DataContext.ReferenceURI = "#" + id
+	signature, err := CreateSignature(signedData, &referenceCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckIdCollisions(signedData, signature); err != nil {
+		return nil, err
+	}
+	if ctx.DataContext.IsEnveloped {
+		signedData.AddChild(signature)
+	} else {
+		signedData.Parent().InsertChildAt(signedData.Index()+1, signature)
+	}
+	return signature, nil
+}
+
+// SignDocument sign the whole of doc with an enveloped signature whose data reference has the empty URI and append
+// the Signature as the last child of the root element. The digest covers the document without the signature,
+// ctx.DataContext.ReferenceURI and IsEnveloped are overridden, ctx is not modified.
+func SignDocument(doc *etree.Document, ctx *SigningContext) (*etree.Element, error) {
+
+	root := doc.Root()
+	if root == nil {
+		return nil, errors.New("xades: document has no root element")
+	}
+
+	documentCtx := *ctx
+	documentCtx.DataContext.ReferenceURI = ""
+	documentCtx.DataContext.IsEnveloped = true
+	signature, err := CreateSignature(root, &documentCtx)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckIdCollisions(root, signature); err != nil {
+		return nil, err
+	}
+	root.AddChild(signature)
+	return signature, nil
+}
+
+// findElementById return el or the first of its descendants, in document order, whose Id attribute equals id
+func findElementById(el *etree.Element, id string) *etree.Element {
+	if elementId(el) == id {
+		return el
+	}
+	for _, child := range el.ChildElements() {
+		if found := findElementById(child, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// SignaturePosition select where InsertSignature places the signature among the children of the signed element
+type SignaturePosition int
+
+const (
+	// PositionLast append the signature after the last child
+	PositionLast SignaturePosition = iota
+	// PositionFirst insert the signature before the first child
+	PositionFirst
+	// PositionBefore insert the signature immediately before the first child element with the given tag
+	PositionBefore
+	// PositionAfter insert the signature immediately after the first child element with the given tag
+	PositionAfter
+)
+
+// AppendSignature append sig as the last child of root as InsertSignature does. A same-document data reference
+// "#id" or "#xpointer(id('id'))" of sig must resolve in the document of root: the Id attribute is part of the
+// referenced content, so it is set before CreateSignature, see SetReferenceId, and not here
+func AppendSignature(root *etree.Element, sig *etree.Element) error {
+	return InsertSignature(root, sig, PositionLast, "")
+}
+
+// SetReferenceId set the Id the same-document data reference "#id" or "#xpointer(id('id'))" of ctx points at on
+// signedData, named as ctx.IdAttribute, when signedData has no Id. Call it before CreateSignature so the data
+// digest covers the Id attribute. An error is returned when signedData has another Id
+func SetReferenceId(signedData *etree.Element, ctx *SigningContext) error {
+	id, _ := referenceURIId(ctx.DataContext.ReferenceURI)
+	if id == "" {
+		return nil
+	}
+	switch existing := elementId(signedData); existing {
+	case id:
+		return nil
+	case "":
+		signedData.Attr = append(signedData.Attr, idAttr(ctx.IdAttribute, id))
+		return nil
+	default:
+		return fmt.Errorf("xades: <%v> has Id %q, the reference URI %q points at another element", signedData.FullTag(), existing, ctx.DataContext.ReferenceURI)
+	}
+}
+
+// InsertSignature insert sig as a child of root at position, tag is the local name of the sibling of
+// PositionBefore and PositionAfter and is ignored otherwise. The enveloped-signature transform removes sig
+// wherever it is, so the position does not change the data digest. Nothing is inserted when an Id of sig is
+// already used in the document, see CheckIdCollisions, or when its same-document data reference does not resolve
+func InsertSignature(root *etree.Element, sig *etree.Element, position SignaturePosition, tag string) error {
+
+	index := len(root.Child)
+	switch position {
+	case PositionLast:
+	case PositionFirst:
+		index = 0
+	case PositionBefore, PositionAfter:
+		sibling := findChild(root, tag)
+		if sibling == nil {
+			return fmt.Errorf("xades: <%v> has no child element %v to place the signature next to", root.FullTag(), tag)
+		}
+		index = sibling.Index()
+		if position == PositionAfter {
+			index++
+		}
+	default:
+		return fmt.Errorf("xades: unknown signature position %v", position)
+	}
+
+	if err := CheckIdCollisions(root, sig); err != nil {
+		return err
+	}
+	uri := dataReferenceURI(sig)
+	if id, _ := referenceURIId(uri); id != "" && findElementById(documentElement(root), id) == nil {
+		return fmt.Errorf("xades: reference URI %q does not resolve in the document of <%v>, see SetReferenceId", uri, root.FullTag())
+	}
+	root.InsertChildAt(index, sig)
+	return nil
+}
+
+// AppendSignatureInScope append sig as the last child of root as InsertSignature and remove the namespace
+// declarations of sig that root already has in scope with the same URI, e.g. xmlns:ds when the document declares
+// the ds prefix at its root. Declarations not in scope, or in scope with another URI, are kept. SignedInfo is
+// canonicalized with the namespaces in scope, so the signature still verifies
+func AppendSignatureInScope(root *etree.Element, sig *etree.Element) error {
+
+	if err := InsertSignature(root, sig, PositionLast, ""); err != nil {
+		return err
+	}
+	var attrs []etree.Attr
+	for _, attr := range sig.Attr {
+		if prefix, ok := namespacePrefix(attr); ok {
+			if uri, inScope := inScopeNamespace(root, prefix); inScope && uri == attr.Value {
+				continue
+			}
+		}
+		attrs = append(attrs, attr)
+	}
+	sig.Attr = attrs
+	return nil
+}
+
+// namespacePrefix return the prefix declared by attr, "" for the default namespace, ok is false for other attributes
+func namespacePrefix(attr etree.Attr) (prefix string, ok bool) {
+	switch {
+	case attr.Space == "xmlns":
+		return attr.Key, true
+	case attr.Space == "" && attr.Key == "xmlns":
+		return "", true
+	}
+	return "", false
+}
+
+// inScopeNamespace return the URI el or its closest ancestor declares for prefix, inScope is false when none does
+func inScopeNamespace(el *etree.Element, prefix string) (uri string, inScope bool) {
+	for ; el != nil; el = el.Parent() {
+		for _, attr := range el.Attr {
+			if declared, ok := namespacePrefix(attr); ok && declared == prefix {
+				return attr.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Resign replace the signatures enveloped in signedData by a new one created with ctx and signed now, see ResignAt
+func Resign(signedData *etree.Element, ctx *SigningContext) (*etree.Element, error) {
+	return ResignAt(signedData, ctx, time.Now())
+}
+
+// ResignAt remove the ds:Signature children of signedData and sign it again with ctx and SigningTime signingTime.
+// The new signature takes the place of the first removed one, or is appended. A SignatureUuid of ctx is not reused,
+// with UseSignatureUuid a new one is generated so no Id of a prior signature survives. ctx is not modified.
+// A copy without the signatures is signed first, signedData is left unchanged when signing fails
+func ResignAt(signedData *etree.Element, ctx *SigningContext, signingTime time.Time) (*etree.Element, error) {
+
+	if err := validateReferenceURI(signedData, &ctx.DataContext); err != nil {
+		return nil, err
+	}
+	// the copy carries the namespace declarations in scope, so it canonicalizes as signedData does
+	unsigned, err := dereference(signedData, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var previous []*etree.Element
+	for _, child := range signedData.ChildElements() {
+		if child.Tag == dsig.SignatureTag && child.NamespaceURI() == dsig.Namespace {
+			previous = append(previous, child)
+		}
+	}
+	for _, child := range unsigned.ChildElements() {
+		if child.Tag == dsig.SignatureTag && child.NamespaceURI() == dsig.Namespace {
+			unsigned.RemoveChild(child)
+		}
+	}
+
+	resignCtx := *ctx
+	resignCtx.SignatureUuid = nil
+	resignCtx.PropertiesContext.SigninigTime = signingTime
+	signature, err := CreateSignature(unsigned, &resignCtx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool)
+	collectIds(signature, ids)
+	if err := checkIds(documentElement(signedData), ids, previous...); err != nil {
+		return nil, err
+	}
+
+	index := len(signedData.Child)
+	if len(previous) > 0 {
+		index = previous[0].Index()
+	}
+	for _, child := range previous {
+		signedData.RemoveChild(child)
+	}
+	signedData.InsertChildAt(index, signature)
+	return signature, nil
+}
+
+// CheckIdCollisions return an error when an Id, ID or xml:id attribute of sig or of one of its descendants is
+// already used by an element of the document holding root, outside of sig. Inserting sig there would produce
+// duplicate Ids, which same-document references cannot resolve, e.g. when a second signature of the document
+// is created with fixed Ids (no SignatureUuid nor UseSignatureUuid)
+func CheckIdCollisions(root *etree.Element, sig *etree.Element) error {
+
+	ids := make(map[string]bool)
+	collectIds(sig, ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	return checkIds(documentElement(root), ids, sig)
+}
+
+// collectIds add the Ids of el and of its descendants to ids
+func collectIds(el *etree.Element, ids map[string]bool) {
+	if id := elementId(el); id != "" {
+		ids[id] = true
+	}
+	for _, child := range el.ChildElements() {
+		collectIds(child, ids)
+	}
+}
+
+// checkIds return an error for the first element of the subtree of el, the subtrees of excluded left out, whose
+// Id is in ids
+func checkIds(el *etree.Element, ids map[string]bool, excluded ...*etree.Element) error {
+	for _, skipped := range excluded {
+		if el == skipped {
+			return nil
+		}
+	}
+	if id := elementId(el); ids[id] {
+		return fmt.Errorf("xades: Id %q of the signature is already used by <%v> in the document", id, el.FullTag())
+	}
+	for _, child := range el.ChildElements() {
+		if err := checkIds(child, ids, excluded...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dataReferenceURI return URI of the first ds:Reference in SignedInfo of sig
+func dataReferenceURI(sig *etree.Element) string {
+	signedInfo := findChild(sig, dsig.SignedInfoTag)
+	if signedInfo == nil {
+		return ""
+	}
+	reference := findChild(signedInfo, dsig.ReferenceTag)
+	if reference == nil {
+		return ""
+	}
+	return reference.SelectAttrValue(dsig.URIAttr, "")
+}
+
+// findChild return the first child element of el with local name tag, regardless of its prefix
+func findChild(el *etree.Element, tag string) *etree.Element {
+	for _, child := range el.ChildElements() {
+		if child.Tag == tag {
+			return child
+		}
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package xades
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignEnveloped(t *testing.T) {
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(testXML))
+
+	signedDoc, err := SignEnveloped(doc, keyStore, crypto.SHA256)
+	require.NoError(t, err)
+	require.Nil(t, doc.Root().FindElement("ds:"+dsig.SignatureTag))
+
+	children := signedDoc.Root().ChildElements()
+	signature := children[len(children)-1]
+	require.Equal(t, dsig.SignatureTag, signature.Tag)
+
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.NotEmpty(t, reference)
+	require.Equal(t, "#signedData", reference.SelectAttrValue(dsig.URIAttr, ""))
+
+	doc = etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(`<root><child/></root>`))
+	_, err = SignEnveloped(doc, keyStore, crypto.SHA256)
+	require.Error(t, err)
+}
+
+func TestAppendSignature(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(`<root><child/></root>`))
+	root := doc.Root()
+	require.Error(t, AppendSignature(root, signature))
+	require.Len(t, root.ChildElements(), 1)
+
+	// the Id is set before signing, so the digest covers it
+	require.NoError(t, SetReferenceId(root, ctx))
+	require.Equal(t, "signedData", root.SelectAttrValue("Id", ""))
+	signature, err = CreateSignature(root, ctx)
+	require.NoError(t, err)
+	require.NoError(t, AppendSignature(root, signature))
+	children := root.ChildElements()
+	require.Len(t, children, 2)
+	require.Equal(t, signature, children[1])
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+	require.Error(t, AppendSignature(root, signature.Copy()))
+
+	doc = etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(`<root ID="existing"/>`))
+	require.Error(t, SetReferenceId(doc.Root(), ctx))
+	require.Error(t, AppendSignature(doc.Root(), signature.Copy()))
+	require.Equal(t, "existing", elementId(doc.Root()))
+	require.Empty(t, doc.Root().ChildElements())
+}
+
+func TestParallelSignatures(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.UseSignatureUuid = true
+	ctx.DataContext.ExcludeSignatures = true
+
+	first, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, AppendSignature(signedData, first))
+	second, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, AppendSignature(signedData, second))
+	require.Nil(t, ctx.SignatureUuid)
+
+	firstId := first.SelectAttrValue("Id", "")
+	secondId := second.SelectAttrValue("Id", "")
+	require.NotEqual(t, firstId, secondId)
+
+	for _, signature := range []*etree.Element{first, second} {
+		transforms := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "[1]/ds:" + dsig.TransformsTag + "/ds:" + dsig.TransformTag)
+		require.Len(t, transforms, 2)
+		require.Equal(t, xpathTransformAlgorithmId, transforms[0].SelectAttrValue(dsig.AlgorithmAttr, ""))
+		xpath := transforms[0].FindElement("ds:" + xpathTag)
+		require.NotEmpty(t, xpath)
+		require.NotContains(t, xpath.Text(), "@Id")
+	}
+
+	// each signature verifies although the other one was appended after it
+	for _, signature := range []*etree.Element{first, second} {
+		_, err := (&VerifyContext{}).Verify(signature, signedData)
+		require.NoError(t, err)
+	}
+	third, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, AppendSignature(signedData, third))
+	_, err = (&VerifyContext{}).Verify(first, signedData)
+	require.NoError(t, err)
+	signedData.CreateElement("tampered")
+	_, err = (&VerifyContext{}).Verify(first, signedData)
+	require.Error(t, err)
+}
+
+func TestSignElementByID(t *testing.T) {
+	const documentXML = `<root><header/><body ID="content"><text>signed</text></body><footer xml:id="trailer"/></root>`
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(documentXML))
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.ReferenceURI = ""
+
+	signature, err := SignElementByID(doc, "content", ctx)
+	require.NoError(t, err)
+	require.Empty(t, ctx.DataContext.ReferenceURI)
+	require.Equal(t, "#content", dataReferenceURI(signature))
+	body := doc.Root().SelectElement("body")
+	require.Equal(t, body, signature.Parent())
+
+	doc = etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(documentXML))
+	ctx.DataContext.IsEnveloped = false
+	signature, err = SignElementByID(doc, "trailer", ctx)
+	require.NoError(t, err)
+	require.Equal(t, "#trailer", dataReferenceURI(signature))
+	children := doc.Root().ChildElements()
+	require.Len(t, children, 4)
+	require.Equal(t, signature, children[3])
+
+	_, err = SignElementByID(doc, "content", ctx)
+	require.Error(t, err)
+	require.Len(t, doc.Root().ChildElements(), 4)
+	ctx.UseSignatureUuid = true
+	signature, err = SignElementByID(doc, "content", ctx)
+	require.NoError(t, err)
+	children = doc.Root().ChildElements()
+	require.Equal(t, signature, children[2])
+
+	_, err = SignElementByID(doc, "missing", ctx)
+	require.Error(t, err)
+
+	doc = etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(`<root Id="rootData"/>`))
+	_, err = SignElementByID(doc, "rootData", ctx)
+	require.Error(t, err)
+}
+
+const nestedXML = `<inv:Invoice xmlns:inv="urn:example:invoice"><inv:Header>header</inv:Header><inv:Lines Id="lines"><inv:Line>1</inv:Line><inv:Line>2</inv:Line></inv:Lines></inv:Invoice>`
+
+func TestSignNestedElement(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.ReferenceURI = "#lines"
+
+	for _, insideTarget := range []bool{false, true} {
+		doc := etree.NewDocument()
+		require.NoError(t, doc.ReadFromString(nestedXML))
+		lines := findElementById(doc.Root(), "lines")
+
+		signature, err := CreateSignature(lines, ctx)
+		require.NoError(t, err)
+		expected, err := canonicalizeInContext(ctx.DataContext.Canonicalizer, lines)
+		require.NoError(t, err)
+		require.Equal(t, DigestBytes(expected, ctx.DataContext.Hash), signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.ReferenceTag+"/ds:"+dsig.DigestValueTag).Text())
+
+		if insideTarget {
+			lines.AddChild(signature)
+		} else {
+			doc.Root().AddChild(signature)
+		}
+		serialized, err := doc.WriteToString()
+		require.NoError(t, err)
+		parsed := etree.NewDocument()
+		require.NoError(t, parsed.ReadFromString(serialized))
+		root := parsed.Root()
+		parsedSignature := root.FindElement("//ds:" + dsig.SignatureTag)
+
+		_, err = (&VerifyContext{}).Verify(parsedSignature, root)
+		require.NoError(t, err)
+
+		root.SelectElement("inv:Header").SetText("changed")
+		_, err = (&VerifyContext{}).Verify(parsedSignature, root)
+		require.NoError(t, err)
+
+		root.FindElement("inv:Lines/inv:Line").SetText("changed")
+		_, err = (&VerifyContext{}).Verify(parsedSignature, root)
+		require.Error(t, err)
+	}
+}
+
+func TestInsertSignature(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		position SignaturePosition
+		tag      string
+		index    int
+	}{
+		{PositionLast, "", 4},
+		{PositionFirst, "", 0},
+		{PositionBefore, "transactionStatus", 1},
+		{PositionAfter, "transactionStatus", 2},
+	} {
+		signedData := newTestSignedData(t)
+		require.NoError(t, InsertSignature(signedData, signature.Copy(), test.position, test.tag))
+		require.Equal(t, dsig.SignatureTag, signedData.ChildElements()[test.index].Tag)
+
+		_, err := (&VerifyContext{}).Verify(findChild(signedData, dsig.SignatureTag), signedData)
+		require.NoError(t, err)
+	}
+
+	signedData := newTestSignedData(t)
+	require.Error(t, InsertSignature(signedData, signature.Copy(), PositionAfter, "missing"))
+	require.Nil(t, findChild(signedData, dsig.SignatureTag))
+}
+
+func TestAppendSignatureInScope(t *testing.T) {
+	for _, test := range []struct {
+		rootXML string
+		keep    bool
+	}{
+		{`<root xmlns:ds="http://www.w3.org/2000/09/xmldsig#" Id="signedData"><child/></root>`, false},
+		{`<outer xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><root Id="signedData"><child/></root></outer>`, false},
+		{`<root Id="signedData"><child/></root>`, true},
+		{`<root xmlns:ds="urn:example:other" Id="signedData"><child/></root>`, true},
+	} {
+		doc := etree.NewDocument()
+		require.NoError(t, doc.ReadFromString(test.rootXML))
+		root := doc.FindElement("//root")
+		ctx := newTestSigningContext(t)
+		signature, err := CreateSignature(root, ctx)
+		require.NoError(t, err)
+		require.NoError(t, AppendSignatureInScope(root, signature))
+		require.Equal(t, test.keep, signature.SelectAttr("xmlns:ds") != nil, test.rootXML)
+
+		serialized, err := doc.WriteToString()
+		require.NoError(t, err)
+		parsed := etree.NewDocument()
+		require.NoError(t, parsed.ReadFromString(serialized))
+		parsedRoot := parsed.FindElement("//root")
+		_, err = (&VerifyContext{}).Verify(findChild(parsedRoot, dsig.SignatureTag), parsedRoot)
+		require.NoError(t, err, test.rootXML)
+	}
+}
+
+func TestCheckIdCollisions(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	signedData := newTestSignedData(t)
+	first, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, InsertSignature(signedData, first, PositionLast, ""))
+	require.NoError(t, CheckIdCollisions(signedData, first))
+
+	second, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	err = CheckIdCollisions(signedData, second)
+	require.EqualError(t, err, `xades: Id "Signature" of the signature is already used by <ds:Signature> in the document`)
+	require.Error(t, InsertSignature(signedData, second, PositionFirst, ""))
+	require.Len(t, signedData.SelectElements("ds:"+dsig.SignatureTag), 1)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(`<root><other Id="SignedProperties"/><data Id="signedData"/></root>`))
+	third, err := CreateSignature(doc.Root().SelectElement("data"), ctx)
+	require.NoError(t, err)
+	err = InsertSignature(doc.Root().SelectElement("data"), third, PositionLast, "")
+	require.EqualError(t, err, `xades: Id "SignedProperties" of the signature is already used by <other> in the document`)
+
+	ctx.UseSignatureUuid = true
+	second, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, InsertSignature(signedData, second, PositionLast, ""))
+}
+
+func TestResign(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	signatureUuid := uuid.MustParse("3b1f0c7e-5d2a-4f66-8e0b-9a4c2d1e7f50")
+	ctx.SignatureUuid = &signatureUuid
+	ctx.UseSignatureUuid = true
+
+	signedData := newTestSignedData(t)
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, InsertSignature(signedData, signature, PositionFirst, ""))
+
+	signingTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	resigned, err := ResignAt(signedData, ctx, signingTime)
+	require.NoError(t, err)
+	require.Equal(t, &signatureUuid, ctx.SignatureUuid)
+	require.Equal(t, resigned, signedData.ChildElements()[0])
+	require.Len(t, signedData.SelectElements("ds:"+dsig.SignatureTag), 1)
+	require.NotEqual(t, signature.SelectAttrValue("Id", ""), resigned.SelectAttrValue("Id", ""))
+	require.NotContains(t, resigned.SelectAttrValue("Id", ""), signatureUuid.String())
+
+	signedProperties := findChild(findQualifyingProperties(resigned), SignedPropertiesTag)
+	require.Equal(t, "2021-06-01T12:00:00Z", findPath(signedProperties, SignedSignaturePropertiesTag, SigningTimeTag).Text())
+	_, err = (&VerifyContext{}).Verify(resigned, signedData)
+	require.NoError(t, err)
+
+	// a failed signing leaves the signature in place
+	failingCtx := *ctx
+	failingCtx.PropertiesContext.AllDataObjectsTimeStamp = &TimeStampContext{}
+	_, err = ResignAt(signedData, &failingCtx, signingTime)
+	require.Error(t, err)
+	require.Equal(t, []*etree.Element{resigned}, signedData.SelectElements("ds:"+dsig.SignatureTag))
+	_, err = (&VerifyContext{}).Verify(resigned, signedData)
+	require.NoError(t, err)
+
+	before := time.Now().Add(-time.Second)
+	resigned, err = Resign(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	signedProperties = findChild(findQualifyingProperties(resigned), SignedPropertiesTag)
+	resignedTime, err := time.ParseInLocation(timeFormat, findPath(signedProperties, SignedSignaturePropertiesTag, SigningTimeTag).Text(), time.Local)
+	require.NoError(t, err)
+	require.False(t, resignedTime.Before(before.Truncate(time.Second)))
+}
+
+func TestSignDocument(t *testing.T) {
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(nestedXML))
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.IsEnveloped = false
+
+	signature, err := SignDocument(doc, ctx)
+	require.NoError(t, err)
+	require.Equal(t, "#signedData", ctx.DataContext.ReferenceURI)
+	require.Equal(t, doc.Root(), signature.Parent())
+
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	uri := reference.SelectAttr(dsig.URIAttr)
+	require.NotNil(t, uri)
+	require.Empty(t, uri.Value)
+	transforms := reference.FindElements("ds:" + dsig.TransformsTag + "/ds:" + dsig.TransformTag)
+	require.Equal(t, dsig.EnvelopedSignatureAltorithmId.String(), transforms[0].SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+	parsedSignature := parsed.Root().SelectElement("ds:" + dsig.SignatureTag)
+	_, err = (&VerifyContext{}).Verify(parsedSignature, parsed.Root())
+	require.NoError(t, err)
+	_, err = (&VerifyContext{}).Verify(parsedSignature, parsed.Root().SelectElement("inv:Header"))
+	require.NoError(t, err)
+
+	parsed.Root().SelectElement("inv:Header").SetText("changed")
+	_, err = (&VerifyContext{}).Verify(parsedSignature, parsed.Root())
+	require.Error(t, err)
+
+	ctx.DataContext.ReferenceURI = ""
+	ctx.DataContext.IsEnveloped = true
+	_, err = CreateSignature(doc.Root().SelectElement("inv:Lines"), ctx)
+	require.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package xades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// CreateEnvelopingSignature create a signature enveloping a copy of data in a ds:Object with Id objectId, placed
+// after ds:KeyInfo, which the data reference points at. The ds:Object is digested as placed in the signature. A
+// with-comments DataContext.Canonicalizer references it as "#xpointer(id('objectId'))" so the comments of data are
+// digested, otherwise as "#objectId", which drops them. ctx.DataContext.ReferenceURI and IsEnveloped are
+// overridden, ctx is not modified. Verify the result with the signature as signed data.
+func CreateEnvelopingSignature(data *etree.Element, objectId string, ctx *SigningContext) (*etree.Element, error) {
+
+	if objectId == "" {
+		return nil, errors.New("xades: enveloping signature requires the Id of its ds:Object")
+	}
+	if objectId == ctx.ObjectID {
+		return nil, fmt.Errorf("xades: Id %q of the enveloped data is the ObjectID of QualifyingProperties", objectId)
+	}
+	ctx, err := prepareSigningContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx.DataContext.IsEnveloped = false
+	ctx.DataContext.ReferenceURI = "#" + objectId
+	if keepsComments(ctx.DataContext.Canonicalizer) {
+		ctx.DataContext.ReferenceURI = "#xpointer(id('" + objectId + "'))"
+	}
+
+	// data keeps its comments and the namespaces in scope in its document, the reference decides what is digested
+	payload, err := dereference(data, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	object := etree.Element{
+		Space: ctx.XmlDsigPrefix,
+		Tag:   "Object",
+		Attr:  []etree.Attr{idAttr(ctx.IdAttribute, objectId)},
+		Child: []etree.Token{payload},
+	}
+	// the digest is computed over a copy declaring the ds namespace ds:Object inherits from ds:Signature
+	qualifiedObject := object.Copy()
+	qualifiedObject.Attr = append(qualifiedObject.Attr, etree.Attr{Space: "xmlns", Key: ctx.XmlDsigPrefix, Value: dsig.Namespace})
+	if err := checkDataTransforms(&ctx.DataContext); err != nil {
+		return nil, err
+	}
+	_, keepComments := referenceURIId(ctx.DataContext.ReferenceURI)
+	applyImplicitCanonicalization(&ctx.DataContext, keepComments)
+	canonicalData, err := transformReference(&ctx.DataContext, qualifiedObject, keepComments)
+	if err != nil {
+		return nil, wrapPhase(ErrDataDigest, err)
+	}
+
+	signatureIdPrefix, err := createSignatureIdPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := createSignature(context.Background(), canonicalData, !ctx.DataContext.OmitTransforms, signatureIdPrefix, ctx)
+	if err != nil {
+		return nil, err
+	}
+	index := 2
+	if keyInfo := findChild(signature, dsig.KeyInfoTag); keyInfo != nil {
+		index = keyInfo.Index() + 1
+	}
+	signature.InsertChildAt(index, &object)
+	linkChildren(&object)
+	return signature, nil
+}
+
+// keepsComments tell whether canonicalizer is a with-comments canonicalization algorithm
+func keepsComments(canonicalizer dsig.Canonicalizer) bool {
+	switch canonicalizer.Algorithm() {
+	case dsig.CanonicalXML10ExclusiveWithCommentsAlgorithmId, dsig.CanonicalXML10WithCommentsAlgorithmId, dsig.CanonicalXML11WithCommentsAlgorithmId:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package xades
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateEnvelopingSignature(t *testing.T) {
+	const payloadXML = `<doc xmlns="urn:doc"><a:data xmlns:a="urn:a"><!-- approved by accounting --><a:v>1</a:v></a:data></doc>`
+
+	sign := func(comment string, ctx *SigningContext) (*etree.Element, string) {
+		doc := etree.NewDocument()
+		require.NoError(t, doc.ReadFromString(payloadXML))
+		data := doc.Root().SelectElement("data")
+		data.Child[0].(*etree.Comment).Data = comment
+		signature, err := CreateEnvelopingSignature(data, "payload", ctx)
+		require.NoError(t, err)
+		require.Equal(t, doc.Root(), data.Parent())
+
+		signed := etree.NewDocument()
+		signed.SetRoot(signature)
+		serialized, err := signed.WriteToString()
+		require.NoError(t, err)
+		parsed := etree.NewDocument()
+		require.NoError(t, parsed.ReadFromString(serialized))
+		digestValue := parsed.Root().FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "/ds:" + dsig.DigestValueTag)
+		return parsed.Root(), digestValue.Text()
+	}
+
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.Canonicalizer = dsig.MakeC14N10ExclusiveWithCommentsCanonicalizerWithPrefixList("")
+	signature, digest := sign(" approved by accounting ", ctx)
+	require.NoError(t, ValidateStructure(signature))
+	children := signature.ChildElements()
+	require.Len(t, children, 5)
+	object := children[3]
+	require.Equal(t, "payload", object.SelectAttrValue("Id", ""))
+	require.Equal(t, "urn:a", object.SelectElement("a:data").NamespaceURI())
+	require.Equal(t, "#xpointer(id('payload'))", dataReferenceURI(signature))
+	_, err := (&VerifyContext{}).Verify(signature, signature)
+	require.NoError(t, err)
+
+	_, otherDigest := sign(" rejected by accounting ", ctx)
+	require.NotEqual(t, digest, otherDigest)
+	object.SelectElement("a:data").Child[0].(*etree.Comment).Data = " rejected by accounting "
+	_, err = (&VerifyContext{}).Verify(signature, signature)
+	require.Error(t, err)
+
+	ctx.DataContext.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signature, digest = sign(" approved by accounting ", ctx)
+	require.Equal(t, "#payload", dataReferenceURI(signature))
+	_, otherDigest = sign(" rejected by accounting ", ctx)
+	require.Equal(t, digest, otherDigest)
+	_, err = (&VerifyContext{}).Verify(signature, signature)
+	require.NoError(t, err)
+
+	ctx.ObjectID = "payload"
+	_, err = CreateEnvelopingSignature(newTestSignedData(t), "payload", ctx)
+	require.Error(t, err)
+}
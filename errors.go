@@ -0,0 +1,40 @@
+package xades
+
+import "errors"
+
+// Phase errors of signature creation, test with errors.Is, the underlying error stays reachable through errors.Unwrap
+var (
+	ErrDataDigest       = errors.New("xades: data digest")
+	ErrPropertiesDigest = errors.New("xades: SignedProperties digest")
+	ErrSignatureValue   = errors.New("xades: signature value")
+)
+
+// ErrCertificatePath labels the failure of the certificate path check of VerifyContext.RootCAs, test with errors.Is,
+// so an untrusted signer is told apart from a signature that does not verify
+var ErrCertificatePath = errors.New("xades: certificate path")
+
+// phaseError is err raised during phase, one of the phase errors
+type phaseError struct {
+	phase error
+	err   error
+}
+
+// wrapPhase return err labelled with phase, nil when err is nil
+func wrapPhase(phase error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &phaseError{phase: phase, err: err}
+}
+
+func (e *phaseError) Error() string {
+	return e.phase.Error() + ": " + e.err.Error()
+}
+
+func (e *phaseError) Unwrap() error {
+	return e.err
+}
+
+func (e *phaseError) Is(target error) bool {
+	return target == e.phase
+}
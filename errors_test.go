@@ -0,0 +1,56 @@
+package xades
+
+import (
+	"crypto"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+var errTest = errors.New("test failure")
+
+type failingCanonicalizer struct{}
+
+func (failingCanonicalizer) Canonicalize(el *etree.Element) ([]byte, error) {
+	return nil, errTest
+}
+
+func (failingCanonicalizer) Algorithm() dsig.AlgorithmID {
+	return dsig.CanonicalXML10ExclusiveAlgorithmId
+}
+
+type failingSigner struct {
+	crypto.Signer
+}
+
+func (failingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return nil, errTest
+}
+
+func TestPhaseErrors(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.Canonicalizer = failingCanonicalizer{}
+	_, err := CreateSignature(signedData, ctx)
+	require.True(t, errors.Is(err, ErrDataDigest))
+	require.True(t, errors.Is(err, errTest))
+
+	ctx = newTestSigningContext(t)
+	ctx.PropertiesContext.Canonicalizer = failingCanonicalizer{}
+	_, err = CreateSignature(signedData, ctx)
+	require.True(t, errors.Is(err, ErrPropertiesDigest))
+	require.False(t, errors.Is(err, ErrDataDigest))
+	require.True(t, errors.Is(err, errTest))
+
+	ctx = newTestSigningContext(t)
+	ctx.KeyStore.Signer = failingSigner{ctx.KeyStore.PrivateKey}
+	_, err = CreateSignature(signedData, ctx)
+	require.True(t, errors.Is(err, ErrSignatureValue))
+	require.True(t, errors.Is(err, errTest))
+	require.EqualError(t, err, "xades: signature value: test failure")
+}
@@ -0,0 +1,40 @@
+package xades
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// CreateSignatureExternalProperties create signature whose ds:Object holds xades:QualifyingPropertiesReference to uri
+// instead of the QualifyingProperties, which are returned to be stored at uri, e.g. as the root of a separate document.
+// The SignedProperties reference of SignedInfo points at uri#Id of the SignedProperties. uri must not contain a
+// fragment. Verify and ValidateStructure expect embedded QualifyingProperties. ctx is not modified.
+func CreateSignatureExternalProperties(signedData *etree.Element, uri string, ctx *SigningContext) (signature *etree.Element, qualifyingProperties *etree.Element, err error) {
+
+	if uri == "" {
+		return nil, nil, errors.New("xades: QualifyingPropertiesReference requires a URI")
+	}
+	if strings.Contains(uri, "#") {
+		return nil, nil, fmt.Errorf("xades: QualifyingPropertiesReference URI %q must not contain a fragment", uri)
+	}
+	externalCtx := *ctx
+	externalCtx.qualifyingPropertiesURI = uri
+	signature, err = CreateSignature(signedData, &externalCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qualifyingProperties = findQualifyingProperties(signature)
+	object := qualifyingProperties.Parent()
+	object.RemoveChild(qualifyingProperties)
+	qualifyingProperties.CreateAttr("xmlns:"+ctx.XmlDsigPrefix, dsig.Namespace)
+
+	reference := object.CreateElement(Prefix + ":" + QualifyingPropertiesReferenceTag)
+	reference.CreateAttr("xmlns:"+Prefix, Namespace)
+	reference.CreateAttr(dsig.URIAttr, uri)
+	return signature, qualifyingProperties, nil
+}
@@ -0,0 +1,44 @@
+package xades
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSignatureExternalProperties(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+
+	signature, qualifyingProperties, err := CreateSignatureExternalProperties(signedData, "properties.xml", ctx)
+	require.NoError(t, err)
+	require.Nil(t, findQualifyingProperties(signature))
+	require.Empty(t, ctx.qualifyingPropertiesURI)
+
+	reference := signature.FindElement("ds:Object/" + Prefix + ":" + QualifyingPropertiesReferenceTag)
+	require.NotNil(t, reference)
+	require.Equal(t, "properties.xml", reference.SelectAttrValue(dsig.URIAttr, ""))
+
+	// store the properties as a document of their own and digest SignedProperties from there
+	doc := etree.NewDocument()
+	doc.SetRoot(qualifyingProperties)
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	external := etree.NewDocument()
+	require.NoError(t, external.ReadFromString(serialized))
+	signedProperties := external.Root().SelectElement(Prefix + ":" + SignedPropertiesTag)
+	require.NotNil(t, signedProperties)
+
+	propertiesReference := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)[1]
+	require.Equal(t, "properties.xml#"+elementId(signedProperties), propertiesReference.SelectAttrValue(dsig.URIAttr, ""))
+	canonical, err := canonicalizeInContext(ctx.PropertiesContext.Canonicalizer, signedProperties)
+	require.NoError(t, err)
+	require.Equal(t, DigestBytes(canonical, ctx.PropertiesContext.Hash), propertiesReference.SelectElement("ds:"+dsig.DigestValueTag).Text())
+
+	_, _, err = CreateSignatureExternalProperties(signedData, "", ctx)
+	require.Error(t, err)
+	_, _, err = CreateSignatureExternalProperties(signedData, "properties.xml#qp", ctx)
+	require.EqualError(t, err, `xades: QualifyingPropertiesReference URI "properties.xml#qp" must not contain a fragment`)
+}
@@ -0,0 +1,66 @@
+package xades
+
+import (
+	"crypto"
+
+	"github.com/google/uuid"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// Facturae signature policy v3.1, mandated for Facturae 3.2, 3.2.1 and 3.2.2 invoices
+const (
+	FacturaePolicyIdentifier  string = "http://www.facturae.es/politica_de_firma_formato_facturae/politica_de_firma_formato_facturae_v3_1.pdf"
+	FacturaePolicyDescription string = "Política de Firma FacturaE v3.1"
+	// FacturaePolicyDigest is the SHA-1 digest of the policy document published with the policy
+	FacturaePolicyDigest string = "Ohixl6upD6av8N7pEvDABhEL6hM="
+)
+
+// Facturae signer roles of xades:ClaimedRole
+const (
+	FacturaeRoleSupplier   string = "emisor"
+	FacturaeRoleCustomer   string = "receptor"
+	FacturaeRoleThirdParty string = "tercero"
+)
+
+// FacturaePreset create SigningContext emitting the XAdES-EPES signature of a Facturae 3.2.x invoice: an enveloped
+// signature over the whole document, see SignDocument, with the Facturae v3.1 SignaturePolicyIdentifier, a
+// DataObjectFormat of MIME type text/xml, the supplier ClaimedRole and UUID based Ids. SHA-256 and exclusive c14n
+// are used, inclusive c14n of SignedInfo would render the namespaces the Facturae root declares, see
+// SigningContext.Canonicalizer. opts are applied last, e.g. WithClaimedRoles(FacturaeRoleThirdParty).
+func FacturaePreset(keyStore *MemoryX509KeyStore, opts ...Option) *SigningContext {
+
+	canonicalizer := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signatureUuid := uuid.New()
+	ctx := &SigningContext{
+		DataContext: SignedDataContext{
+			Canonicalizer: canonicalizer,
+			Hash:          crypto.SHA256,
+			IsEnveloped:   true,
+		},
+		PropertiesContext: SignedPropertiesContext{
+			Canonicalizer: canonicalizer,
+			Hash:          crypto.SHA256,
+			SignaturePolicy: &SignaturePolicy{
+				Identifier:  FacturaePolicyIdentifier,
+				Description: FacturaePolicyDescription,
+				Hash:        crypto.SHA1,
+				Digest:      FacturaePolicyDigest,
+			},
+			DataObjectFormat: &DataObjectFormat{
+				Description: "Factura electrónica",
+				MimeType:    "text/xml",
+			},
+			ClaimedRoles: []string{FacturaeRoleSupplier},
+		},
+		Canonicalizer:    canonicalizer,
+		Hash:             crypto.SHA256,
+		KeyStore:         *keyStore,
+		XmlDsigPrefix:    dsig.DefaultPrefix,
+		SignatureUuid:    &signatureUuid,
+		UseSignatureUuid: true,
+	}
+	for _, opt := range opts {
+		opt(ctx)
+	}
+	return ctx
+}
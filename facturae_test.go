@@ -0,0 +1,47 @@
+package xades
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFacturaePreset(t *testing.T) {
+	const facturaeXML = `<fe:Facturae xmlns:fe="http://www.facturae.gob.es/formato/Versiones/Facturaev3_2_2.xml" xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><FileHeader><SchemaVersion>3.2.2</SchemaVersion><Modality>I</Modality></FileHeader></fe:Facturae>`
+
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(facturaeXML))
+	signature, err := SignDocument(doc, FacturaePreset(keyStore))
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+	signature = parsed.Root().SelectElement("ds:" + dsig.SignatureTag)
+	require.Equal(t, "", dataReferenceURI(signature))
+	_, err = (&VerifyContext{}).Verify(signature, parsed.Root())
+	require.NoError(t, err)
+
+	signedSignatureProperties := findPath(findQualifyingProperties(signature), SignedPropertiesTag, SignedSignaturePropertiesTag)
+	signaturePolicyId := findPath(signedSignatureProperties, SignaturePolicyIdentifierTag, SignaturePolicyIdTag)
+	require.Equal(t, FacturaePolicyIdentifier, findPath(signaturePolicyId, SigPolicyIdTag, IdentifierTag).Text())
+	require.Equal(t, FacturaePolicyDescription, findPath(signaturePolicyId, SigPolicyIdTag, DescriptionTag).Text())
+	require.Equal(t, "http://www.w3.org/2000/09/xmldsig#sha1", findPath(signaturePolicyId, SigPolicyHashTag, dsig.DigestMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+	require.Equal(t, FacturaePolicyDigest, findPath(signaturePolicyId, SigPolicyHashTag, dsig.DigestValueTag).Text())
+	require.Equal(t, FacturaeRoleSupplier, findPath(signedSignatureProperties, SignerRoleTag, ClaimedRolesTag, ClaimedRoleTag).Text())
+
+	dataObjectFormat := findPath(findQualifyingProperties(signature), SignedPropertiesTag, SignedDataObjectPropertiesTag, DataObjectFormatTag)
+	require.Equal(t, "text/xml", findChild(dataObjectFormat, "MimeType").Text())
+
+	doc = etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(facturaeXML))
+	signature, err = SignDocument(doc, FacturaePreset(keyStore, WithClaimedRoles(FacturaeRoleThirdParty)))
+	require.NoError(t, err)
+	require.Equal(t, FacturaeRoleThirdParty, signature.FindElement(".//"+Prefix+":"+ClaimedRoleTag).Text())
+}
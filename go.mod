@@ -4,7 +4,8 @@ go 1.15
 
 require (
 	github.com/beevik/etree v1.2.0
-	github.com/google/uuid v1.3.1 // indirect
+	github.com/google/uuid v1.3.1
 	github.com/russellhaering/goxmldsig v1.4.0
 	github.com/stretchr/testify v1.8.4
+	software.sslmate.com/src/go-pkcs12 v0.2.0
 )
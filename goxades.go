@@ -1,17 +1,32 @@
 package xades
 
 import (
+	"bytes"
+	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
 	"crypto/rsa"
-	"crypto/sha1"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"strings"
 	"time"
 
 	"github.com/beevik/etree"
 	"github.com/google/uuid"
 	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
 )
 
 const (
@@ -20,14 +35,26 @@ const (
 )
 
 const (
-	SignedPropertiesTag          string = "SignedProperties"
-	SignedSignaturePropertiesTag string = "SignedSignatureProperties"
-	SigningTimeTag               string = "SigningTime"
-	SigningCertificateTag        string = "SigningCertificate"
-	CertTag                      string = "Cert"
-	IssuerSerialTag              string = "IssuerSerial"
-	CertDigestTag                string = "CertDigest"
-	QualifyingPropertiesTag      string = "QualifyingProperties"
+	SignedPropertiesTag               string = "SignedProperties"
+	SignedSignaturePropertiesTag      string = "SignedSignatureProperties"
+	SigningTimeTag                    string = "SigningTime"
+	SigningCertificateTag             string = "SigningCertificate"
+	SigningCertificateV2Tag           string = "SigningCertificateV2"
+	IssuerSerialV2Tag                 string = "IssuerSerialV2"
+	CertTag                           string = "Cert"
+	IssuerSerialTag                   string = "IssuerSerial"
+	CertDigestTag                     string = "CertDigest"
+	QualifyingPropertiesTag           string = "QualifyingProperties"
+	QualifyingPropertiesReferenceTag  string = "QualifyingPropertiesReference"
+	SignedDataObjectPropertiesTag     string = "SignedDataObjectProperties"
+	AllDataObjectsTimeStampTag        string = "AllDataObjectsTimeStamp"
+	IndividualDataObjectsTimeStampTag string = "IndividualDataObjectsTimeStamp"
+	IncludeTag                        string = "Include"
+	DataObjectFormatTag               string = "DataObjectFormat"
+	EncapsulatedTimeStampTag          string = "EncapsulatedTimeStamp"
+	SignerRoleTag                     string = "SignerRole"
+	ClaimedRolesTag                   string = "ClaimedRoles"
+	ClaimedRoleTag                    string = "ClaimedRole"
 )
 
 const (
@@ -35,48 +62,255 @@ const (
 	targetAttr           string = "Target"
 )
 
+const (
+	keyValueTag    string = "KeyValue"
+	rsaKeyValueTag string = "RSAKeyValue"
+	modulusTag     string = "Modulus"
+	exponentTag    string = "Exponent"
+	xpathTag       string = "XPath"
+	keyNameTag     string = "KeyName"
+
+	hmacOutputLengthTag string = "HMACOutputLength"
+
+	x509IssuerSerialTag string = "X509IssuerSerial"
+	x509IssuerNameTag   string = "X509IssuerName"
+	x509SerialNumberTag string = "X509SerialNumber"
+	x509SubjectNameTag  string = "X509SubjectName"
+	x509SKITag          string = "X509SKI"
+)
+
+const inclusiveNamespacesPrefix string = "ec"
+
+// timeFormat is the layout of xsd:dateTime values, times are emitted as is without conversion to UTC
+const timeFormat string = "2006-01-02T15:04:05Z"
+
+// SignedPropertiesType is the default Type of the SignedProperties reference
+const SignedPropertiesType string = "http://uri.etsi.org/01903#SignedProperties"
+
+const xpathTransformAlgorithmId string = "http://www.w3.org/TR/1999/REC-xpath-19991116"
+
+// digestAlgorithmIdentifiers and signatureMethodIdentifiers hold the built-in algorithms, extended by
+// RegisterDigestMethod and RegisterSignatureMethod, access them through the accessors of registry.go
 var digestAlgorithmIdentifiers = map[crypto.Hash]string{
 	crypto.SHA1:   "http://www.w3.org/2000/09/xmldsig#sha1",
 	crypto.SHA256: "http://www.w3.org/2001/04/xmlenc#sha256",
+	crypto.SHA384: "http://www.w3.org/2001/04/xmldsig-more#sha384",
 	crypto.SHA512: "http://www.w3.org/2001/04/xmlenc#sha512",
 }
 
 var signatureMethodIdentifiers = map[crypto.Hash]string{
 	crypto.SHA1:   "http://www.w3.org/2000/09/xmldsig#rsa-sha1",
 	crypto.SHA256: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256",
+	crypto.SHA384: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha384",
 	crypto.SHA512: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512",
 }
 
+// ed25519SignatureMethodIdentifier is the pure Ed25519 signature method of RFC 9231, it has no separate digest
+const ed25519SignatureMethodIdentifier string = "http://www.w3.org/2021/04/xmldsig-more#eddsa-ed25519"
+
+// ecdsaSignatureMethodIdentifiers are the ECDSA signature methods of RFC 4051, the SignatureValue is the raw r||s
+var ecdsaSignatureMethodIdentifiers = map[crypto.Hash]string{
+	crypto.SHA1:   "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha1",
+	crypto.SHA256: "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256",
+	crypto.SHA384: "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384",
+	crypto.SHA512: "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512",
+}
+
 type SigningContext struct {
 	DataContext       SignedDataContext
 	PropertiesContext SignedPropertiesContext
-	Canonicalizer     dsig.Canonicalizer
-	Hash              crypto.Hash
-	KeyStore          MemoryX509KeyStore
-	XmlDsigPrefix     string
-	SignatureUuid     *uuid.UUID
-	UseSignatureUuid  bool
+	KeyInfoContext    KeyInfoContext
+	// Canonicalizer of SignedInfo, exclusive c14n when nil. SignedInfo is canonicalized with only the XmlDsigPrefix
+	// namespace in scope, whatever the prefix. Inclusive c14n also renders the namespaces declared by the ancestors
+	// of the placed signature, so it verifies only where those declare none; prefer exclusive c14n for enveloped
+	// signatures in namespaced documents, the same holds for PropertiesContext.Canonicalizer
+	Canonicalizer    dsig.Canonicalizer
+	Hash             crypto.Hash
+	KeyStore         MemoryX509KeyStore
+	XmlDsigPrefix    string
+	SignatureUuid    *uuid.UUID
+	UseSignatureUuid bool
+	// InclusiveNamespaces is the PrefixList of ec:InclusiveNamespaces emitted in CanonicalizationMethod, exclusive c14n only
+	InclusiveNamespaces string
+	// CertDigestHash is the digest algorithm of the SigningCertificate CertDigest, PropertiesContext.Hash when zero
+	CertDigestHash crypto.Hash
+	// Rand is the entropy source passed to the crypto.Signer, when nil the signature is computed by goxmldsig,
+	// or with crypto/rand when KeyStore.Signer is set
+	Rand io.Reader
+	// SignatureID overrides the generated Id of ds:Signature
+	SignatureID string
+	// SignedPropertiesID overrides the generated Id of xades:SignedProperties
+	SignedPropertiesID string
+	// ObjectID is the Id of the ds:Object holding QualifyingProperties, omitted when empty
+	ObjectID string
+	// SignedInfoID, SignatureValueID and KeyInfoID are the Ids of ds:SignedInfo, ds:SignatureValue and ds:KeyInfo,
+	// omitted when empty. KeyInfoID is what a reference added by KeyInfoContext.SignKeyInfo points at
+	SignedInfoID     string
+	SignatureValueID string
+	KeyInfoID        string
+	// SignedPropertiesReferenceID is the Id of the SignedProperties ds:Reference, omitted when empty
+	SignedPropertiesReferenceID string
+	// IssuerNameFormat renders X509IssuerName in ds:X509IssuerSerial and the SigningCertificate IssuerSerial,
+	// GoIssuerName when nil
+	IssuerNameFormat IssuerNameFormat
+	// SignedPropertiesReferenceType is the Type attribute of the SignedProperties reference, SignedPropertiesType when empty
+	SignedPropertiesReferenceType string
+	// DsigContext computes SignatureValue instead of a goxmldsig signing context built from Hash and KeyStore,
+	// its Hash and key also select the SignatureMethod. KeyStore still provides the certificate of KeyInfo and
+	// SigningCertificate. Ignored for Ed25519 and ECDSA keys of KeyStore and when a SignerFunc is registered for the
+	// SignatureMethod, and it cannot be combined with Signer or HMAC
+	DsigContext *dsig.SigningContext
+	// Signer computes SignatureValue instead of KeyStore, and announces its SignatureMethod. KeyStore still
+	// provides the certificate of KeyInfo and SigningCertificate. It cannot be combined with DsigContext or HMAC
+	Signer Signer
+	// Base64LineWidth wraps the base64 text of ds:SignatureValue and ds:X509Certificate at this column, 0 for a single line.
+	// Digest values and other content inside SignedInfo or SignedProperties are never wrapped
+	Base64LineWidth int
+	// SecurityPolicy restricts the algorithms of the signature, no restriction when zero
+	SecurityPolicy SecurityPolicy
+	// IdAttribute is the name of the Id attributes written on ds:Signature, xades:SignedProperties, ds:Object and
+	// the data ds:Reference, "Id" when empty; e.g. "ID" or "xml:id" for validators resolving references by those.
+	// Other Ids of the signature, such as those of unsigned properties, follow the attribute of ds:Signature
+	IdAttribute string
+	// PlainXMLDSig creates a plain XML DSig signature with the data reference only, without the SignedProperties
+	// reference and the ds:Object holding QualifyingProperties. PropertiesContext is ignored, except that
+	// signed data object properties cannot be requested
+	PlainXMLDSig bool
+	// HMAC computes SignatureValue as the HMAC with Hash of SignedInfo under a shared secret instead of with KeyStore,
+	// which is then unused, and KeyInfo carries its KeyName only. HMAC requires PlainXMLDSig
+	HMAC *HMACKeyStore
+
+	// qualifyingPropertiesURI locates external QualifyingProperties, see CreateSignatureExternalProperties
+	qualifyingPropertiesURI string
 }
 
 type SignedDataContext struct {
+	// Canonicalizer of the signed data, exclusive c14n when nil
 	Canonicalizer dsig.Canonicalizer
 	Hash          crypto.Hash
-	ReferenceURI  string
-	IsEnveloped   bool
+	// ReferenceURI of the data reference. The empty URI selects the whole document, signedData must then be its
+	// root element and, as the signature is placed inside, IsEnveloped set, see SignDocument. The empty and "#id"
+	// URIs dereference to content without comments, "#xpointer(id('id'))" keeps them for a with-comments Canonicalizer
+	ReferenceURI string
+	// ReferenceType is the Type attribute of the data ds:Reference, omitted when empty
+	ReferenceType string
+	// ReferenceID is the Id attribute of the data ds:Reference, omitted when empty. It lets properties such as
+	// DataObjectFormat/ObjectReference point at the reference with "#ReferenceID", with a DataObjectFormat
+	// an Id is generated when empty
+	ReferenceID string
+	IsEnveloped bool
+	// InclusiveNamespaces is the PrefixList of ec:InclusiveNamespaces emitted in the c14n transform, exclusive c14n only.
+	// The "#default" token keeps the default namespace in scope at signedData even where no element uses it
+	InclusiveNamespaces string
+	// Base64Transform digests the base64 decoded text content of the signed data, announced by the base64
+	// transform. The decoded octets are digested as is, Canonicalizer is then unused
+	Base64Transform bool
+	// Base64DecodedXML parses the octets decoded by Base64Transform as an XML document whose canonical form by
+	// Canonicalizer is digested, the canonicalization transform follows the base64 transform
+	Base64DecodedXML bool
+	// ExcludeSignatures replaces the enveloped-signature transform by an XPath transform removing every
+	// ds:Signature from the signed data, so parallel signatures of the same data verify whatever the others
+	ExcludeSignatures bool
+	// XSLTStylesheet appends the XSLT transform embedding this stylesheet after the canonicalization transform,
+	// the digest covers the output of the engine of RegisterXSLTEngine over the canonical data. The output is
+	// digested as is, XSLT 1.0 output is only as reproducible as the engine, so both sides should use the same one
+	XSLTStylesheet []byte
+	// OmitTransforms emits the data reference without a Transforms element. XML DSig then digests a same-document
+	// reference as its inclusive c14n 1.0, with comments for "#xpointer(id('id'))" URIs only, so Canonicalizer is
+	// unused. It cannot be combined with IsEnveloped, which needs the enveloped-signature transform, nor with
+	// Base64Transform or XSLTStylesheet. CreateDetachedSignature rejects it, a detached reference has no transforms
+	OmitTransforms bool
+	// Transforms orders the transforms of the data reference, by default the enveloped transform, base64 decoding,
+	// canonicalization then XSLT, each as configured. It must list the transforms that IsEnveloped, Base64Transform
+	// and XSLTStylesheet configure; canonicalization may come before the enveloped transform, or be left out for the
+	// implicit inclusive c14n 1.0 as with OmitTransforms. Unsupported by CreateDetachedSignature and
+	// CreateManifestSignature
+	Transforms []DataTransform
 }
 
 type SignedPropertiesContext struct {
+	// Canonicalizer of SignedProperties, exclusive c14n when nil
 	Canonicalizer dsig.Canonicalizer
 	Hash          crypto.Hash
 	SigninigTime  time.Time
+	// UseSigningCertificateV2 emits xades:SigningCertificateV2 with IssuerSerialV2 in place of SigningCertificate.
+	// EN 319 132-1 defines SigningCertificateV2 in the v1.3.2 namespace, so Namespace is kept
+	UseSigningCertificateV2 bool
+	// SigningCertificateChain adds a xades:Cert for every certificate of KeyStore.CertChain after the one of the
+	// signing certificate, in the order of the path from the signing certificate upwards. Signing fails when a
+	// certificate of the chain is not on that path
+	SigningCertificateChain bool
+	// OmitSigningTime drops xades:SigningTime, for profiles taking the signing time from a SignatureTimeStamp only
+	OmitSigningTime bool
+	// InclusiveNamespaces is the PrefixList of ec:InclusiveNamespaces emitted in the c14n transform, exclusive c14n only
+	InclusiveNamespaces string
+	// AllDataObjectsTimeStamp adds xades:AllDataObjectsTimeStamp to SignedDataObjectProperties when set
+	AllDataObjectsTimeStamp *TimeStampContext
+	// IndividualDataObjectsTimeStamp adds xades:IndividualDataObjectsTimeStamp to SignedDataObjectProperties when
+	// set, time-stamping the data reference it points at with a xades:Include. An Id of the data reference is
+	// generated when DataContext.ReferenceID is empty
+	IndividualDataObjectsTimeStamp *TimeStampContext
+	// DataObjectFormat adds xades:DataObjectFormat describing the data reference to SignedDataObjectProperties when set
+	DataObjectFormat *DataObjectFormat
+	// SignaturePolicy adds xades:SignaturePolicyIdentifier identifying an explicit policy when set, see AddSignaturePolicyStore
+	SignaturePolicy *SignaturePolicy
+	// ClaimedRoles adds xades:SignerRole with a xades:ClaimedRole for each role, omitted when empty
+	ClaimedRoles []string
+}
+
+// DataObjectFormat describe the format of the signed data
+type DataObjectFormat struct {
+	// ObjectReference is "#" followed by the Id of the data reference, derived from DataContext.ReferenceID when empty
+	ObjectReference string
+	Description     string
+	MimeType        string
+	Encoding        string
+}
+
+// KeyInfoContext controls the content of ds:KeyInfo
+type KeyInfoContext struct {
+	// IncludeKeyValue adds ds:KeyValue/ds:RSAKeyValue derived from the certificate public key
+	IncludeKeyValue bool
+	// OmitX509Data drops ds:X509Data, requires IncludeKeyValue or KeyName
+	OmitX509Data bool
+	// KeyName adds ds:KeyName with this value first in ds:KeyInfo, for receivers resolving the key by name;
+	// with OmitX509Data it replaces the certificate. Omitted when empty
+	KeyName string
+	// IncludeX509IssuerSerial adds ds:X509IssuerSerial of the signing certificate to ds:X509Data
+	IncludeX509IssuerSerial bool
+	// IncludeX509SubjectName adds ds:X509SubjectName of the signing certificate to ds:X509Data
+	IncludeX509SubjectName bool
+	// IncludeX509SKI adds ds:X509SKI with the subject key identifier of the signing certificate to ds:X509Data
+	IncludeX509SKI bool
+	// OmitX509Certificate drops the ds:X509Certificate elements from ds:X509Data
+	OmitX509Certificate bool
+	// OrderCertChain emits KeyStore.CertChain leaf-first, each certificate followed by its issuer, and fails when
+	// a certificate of the chain is not on the path from the signing certificate
+	OrderCertChain bool
+	// ExcludeRootCertificate drops the self-signed certificates of KeyStore.CertChain from ds:X509Data
+	ExcludeRootCertificate bool
+	// RequireChain fails signing when KeyStore.CertChain is empty, for profiles mandating the intermediate CAs
+	RequireChain bool
+	// SignKeyInfo adds a ds:Reference to ds:KeyInfo after the SignedProperties reference, so the certificate is
+	// covered by the signature. It is digested with the Canonicalizer and Hash of PropertiesContext and requires
+	// SigningContext.KeyInfoID; PlainXMLDSig and HMAC signatures are not supported
+	SignKeyInfo bool
 }
 
 // MemoryX509KeyStore struct
 type MemoryX509KeyStore struct {
 	PrivateKey *rsa.PrivateKey
-	Cert       *x509.Certificate
+	// Cert is the signing certificate. Its encoding, digests, IssuerSerial and the KeyInfo built with it are cached
+	// by certificate across signatures, so Cert must not be modified once signed with, a new certificate is parsed
+	// instead. When nil it is parsed from CertBinary for every signature, which then misses the cache
+	Cert *x509.Certificate
+	// CertBinary is the DER encoding of Cert, Cert.Raw when nil. Signing fails when it is set to other bytes
 	CertBinary []byte
-	CertChain  []*x509.Certificate
+	// CertChain are the certificates added to ds:X509Data after Cert, they must not be modified once signed with
+	CertChain []*x509.Certificate
+	// Signer signs instead of PrivateKey when set, e.g. an *ecdsa.PrivateKey, an ed25519.PrivateKey or a key held
+	// by a hardware token
+	Signer crypto.Signer
 }
 
 // GetKeyPair func
@@ -84,6 +318,34 @@ func (ks *MemoryX509KeyStore) GetKeyPair() (*rsa.PrivateKey, []byte, error) {
 	return ks.PrivateKey, ks.CertBinary, nil
 }
 
+// signer return Signer, or PrivateKey when Signer is unset
+func (ks *MemoryX509KeyStore) signer() crypto.Signer {
+	if ks.Signer != nil {
+		return ks.Signer
+	}
+	if ks.PrivateKey == nil {
+		return nil
+	}
+	return ks.PrivateKey
+}
+
+// Validate check that the certificate is fit for signing at signingTime: its key usage must include
+// digitalSignature or nonRepudiation and signingTime must lie within its validity period.
+// CreateSignature does not call Validate, callers opt in.
+func (ks *MemoryX509KeyStore) Validate(signingTime time.Time) error {
+	if ks.Cert == nil {
+		return errors.New("xades: key store has no certificate")
+	}
+	if ks.Cert.KeyUsage&(x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment) == 0 {
+		return fmt.Errorf("xades: certificate %q key usage allows neither digitalSignature nor nonRepudiation", ks.Cert.Subject.String())
+	}
+	if signingTime.Before(ks.Cert.NotBefore) || signingTime.After(ks.Cert.NotAfter) {
+		return fmt.Errorf("xades: signing time %v is outside the validity period %v - %v of certificate %q",
+			signingTime.UTC().Format(timeFormat), ks.Cert.NotBefore.UTC().Format(timeFormat), ks.Cert.NotAfter.UTC().Format(timeFormat), ks.Cert.Subject.String())
+	}
+	return nil
+}
+
 // DigestValue calculate hash for digest
 func DigestValue(element *etree.Element, canonicalizer *dsig.Canonicalizer, hash crypto.Hash) (base64encoded string, err error) {
 
@@ -92,14 +354,69 @@ func DigestValue(element *etree.Element, canonicalizer *dsig.Canonicalizer, hash
 		return
 	}
 
-	_hash := hash.New()
-	_, err = _hash.Write(canonical)
+	base64encoded = DigestBytes(canonical, hash)
+	return
+}
+
+// DigestValueWithHashFunc calculate digest with a hash created by newHash, for digest algorithms outside crypto.Hash
+// such as GOST R 34.11-2012 or SM3, which need no RegisterDigestMethod. It return ds:DigestMethod announcing
+// algorithmURI and ds:DigestValue with xmlDsigPrefix, the children of a ds:Reference after its transforms
+func DigestValueWithHashFunc(element *etree.Element, canonicalizer *dsig.Canonicalizer, newHash func() hash.Hash, algorithmURI string, xmlDsigPrefix string) (digestMethod *etree.Element, digestValue *etree.Element, err error) {
+
+	if newHash == nil || algorithmURI == "" {
+		return nil, nil, errors.New("xades: custom digest requires a hash constructor and its algorithm URI")
+	}
+	canonical, err := (*canonicalizer).Canonicalize(element)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
+	_hash := newHash()
+	_hash.Write(canonical)
 
-	base64encoded = base64.StdEncoding.EncodeToString(_hash.Sum(nil))
-	return
+	digestMethod = &etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   dsig.DigestMethodTag,
+		Attr:  []etree.Attr{{Key: dsig.AlgorithmAttr, Value: algorithmURI}},
+	}
+	digestValue = &etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   dsig.DigestValueTag,
+	}
+	digestValue.SetText(base64.StdEncoding.EncodeToString(_hash.Sum(nil)))
+	return digestMethod, digestValue, nil
+}
+
+// DigestBytes calculate hash for digest of raw data, e.g. detached non-XML content
+func DigestBytes(data []byte, hash crypto.Hash) string {
+	return base64.StdEncoding.EncodeToString(digestSum(data, hash))
+}
+
+// DigestBytesHex calculate hash of raw data as lowercase hex, for non-XML consumers such as external indexes.
+// Digest values of XML signatures are always standard base64, see DigestBytes
+func DigestBytesHex(data []byte, hash crypto.Hash) string {
+	return hex.EncodeToString(digestSum(data, hash))
+}
+
+// DigestBytesBase64URL calculate hash of raw data as unpadded base64url (RFC 4648 section 5), for non-XML consumers
+func DigestBytesBase64URL(data []byte, hash crypto.Hash) string {
+	return base64.RawURLEncoding.EncodeToString(digestSum(data, hash))
+}
+
+func digestSum(data []byte, hash crypto.Hash) []byte {
+	_hash := newHash(hash)
+	_hash.Write(data)
+	return _hash.Sum(nil)
+}
+
+// DigestReader calculate hash for digest of the octets read from r, e.g. data canonicalized by an external
+// streaming canonicalizer. The data is hashed in chunks, so memory use does not depend on its size,
+// and the result equals DigestBytes over the same octets
+func DigestReader(r io.Reader, hash crypto.Hash) (string, error) {
+	_hash := newHash(hash)
+	if _, err := io.Copy(_hash, r); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(_hash.Sum(nil)), nil
 }
 
 // SignatureValue calculate signature
@@ -110,11 +427,67 @@ func SignatureValue(element *etree.Element, canonicalizer *dsig.Canonicalizer, h
 		return
 	}
 
+	return SignatureValueBytes(canonical, hash, keyStore)
+}
+
+// SignatureValueBytes calculate signature of raw data
+func SignatureValueBytes(data []byte, hash crypto.Hash, keyStore *MemoryX509KeyStore) (base64encoded string, err error) {
+
 	ctx := &dsig.SigningContext{
 		Hash:     hash,
 		KeyStore: keyStore,
 	}
-	buffer, err := ctx.SignString(string(canonical))
+	return signatureValueWithContext(data, ctx)
+}
+
+// SignatureValueWithContext calculate signature with a caller configured goxmldsig signing context,
+// its Hash and key are used
+func SignatureValueWithContext(element *etree.Element, canonicalizer *dsig.Canonicalizer, dsigCtx *dsig.SigningContext) (base64encoded string, err error) {
+
+	canonical, err := (*canonicalizer).Canonicalize(element)
+	if err != nil {
+		return
+	}
+
+	return signatureValueWithContext(canonical, dsigCtx)
+}
+
+func signatureValueWithContext(data []byte, dsigCtx *dsig.SigningContext) (base64encoded string, err error) {
+
+	buffer, err := dsigCtx.SignString(string(data))
+	if err != nil {
+		return
+	}
+	base64encoded = base64.StdEncoding.EncodeToString(buffer)
+	return
+}
+
+// SignatureValueWithSigner calculate signature using key as crypto.Signer and rand as entropy source.
+// When hash is zero the canonical element is signed without prior hashing, as Ed25519 requires
+func SignatureValueWithSigner(element *etree.Element, canonicalizer *dsig.Canonicalizer, hash crypto.Hash, key crypto.Signer, rand io.Reader) (base64encoded string, err error) {
+
+	canonical, err := (*canonicalizer).Canonicalize(element)
+	if err != nil {
+		return
+	}
+
+	if hash == 0 {
+		buffer, signErr := key.Sign(rand, canonical, crypto.Hash(0))
+		if signErr != nil {
+			err = signErr
+			return
+		}
+		base64encoded = base64.StdEncoding.EncodeToString(buffer)
+		return
+	}
+
+	_hash := newHash(hash)
+	_, err = _hash.Write(canonical)
+	if err != nil {
+		return
+	}
+
+	buffer, err := key.Sign(rand, _hash.Sum(nil), hash)
 	if err != nil {
 		return
 	}
@@ -122,71 +495,497 @@ func SignatureValue(element *etree.Element, canonicalizer *dsig.Canonicalizer, h
 	return
 }
 
-// CreateSignature create filled signature element
+// CreateSignature create filled signature element.
+// Neither ctx nor signedData is modified, so a single ctx may be shared by concurrent calls.
 func CreateSignature(signedData *etree.Element, ctx *SigningContext) (*etree.Element, error) {
+	return CreateSignatureContext(context.Background(), signedData, ctx)
+}
+
+// CreateSignatureContext create filled signature element, goCtx bounds network-backed operations such as time-stamping
+func CreateSignatureContext(goCtx context.Context, signedData *etree.Element, ctx *SigningContext) (*etree.Element, error) {
 
-	//DigestValue of signedData
-	digestData, err := DigestValue(signedData, &ctx.DataContext.Canonicalizer, ctx.DataContext.Hash)
+	ctx, canonicalData, signatureIdPrefix, err := prepareSignedData(goCtx, signedData, ctx)
 	if err != nil {
 		return nil, err
 	}
+	return createSignature(goCtx, canonicalData, !ctx.DataContext.OmitTransforms, signatureIdPrefix, ctx)
+}
+
+// prepareSignedData return prepared copy of ctx, the canonical octets of signedData and the Id prefix of the signature
+func prepareSignedData(goCtx context.Context, signedData *etree.Element, ctx *SigningContext) (*SigningContext, []byte, string, error) {
 
-	signingTime := ctx.PropertiesContext.SigninigTime
-	if signingTime.IsZero() {
-		signingTime = time.Now()
+	if err := goCtx.Err(); err != nil {
+		return nil, nil, "", err
 	}
-	//DigestValue of signedProperties
-	signedProperties := createSignedProperties(&ctx.KeyStore, signingTime, ctx)
-	qualifiedSignedProperties := createQualifiedSignedProperties(signedProperties, ctx.XmlDsigPrefix)
 
-	digestProperties, err := DigestValue(qualifiedSignedProperties, &ctx.PropertiesContext.Canonicalizer, ctx.PropertiesContext.Hash)
+	ctx, err := prepareSigningContext(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, "", err
 	}
 
-	//SignatureValue
-	signedInfo := createSignedInfo(string(digestData), string(digestProperties), ctx)
-	qualifiedSignedInfo := createQualifiedSignedInfo(signedInfo, ctx.XmlDsigPrefix)
+	if err := validateReferenceURI(signedData, &ctx.DataContext); err != nil {
+		return nil, nil, "", err
+	}
 
+	// signedData is canonicalized as a copy carrying the namespace declarations in scope, so a sub-element
+	// digests as it does inside its document, and exclusive c14n cannot rewrite signedData in place
+	_, keepComments := referenceURIId(ctx.DataContext.ReferenceURI)
+	if ctx.DataContext.OmitTransforms && (ctx.DataContext.IsEnveloped || ctx.DataContext.Base64Transform || ctx.DataContext.XSLTStylesheet != nil) {
+		return nil, nil, "", errors.New("xades: OmitTransforms cannot be combined with IsEnveloped, Base64Transform or XSLTStylesheet")
+	}
+	if err := checkDataTransforms(&ctx.DataContext); err != nil {
+		return nil, nil, "", err
+	}
+	applyImplicitCanonicalization(&ctx.DataContext, keepComments)
+	canonicalData, err := transformReference(&ctx.DataContext, signedData, keepComments)
 	if err != nil {
-		return nil, err
+		return nil, nil, "", wrapPhase(ErrDataDigest, err)
 	}
-	signatureValueText, err := SignatureValue(qualifiedSignedInfo, &ctx.Canonicalizer, ctx.Hash, &ctx.KeyStore)
+	signatureIdPrefix, err := createSignatureIdPrefix(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, "", err
 	}
+	return ctx, canonicalData, signatureIdPrefix, nil
+}
 
-	signatureValue := createSignatureValue(signatureValueText, ctx.XmlDsigPrefix)
-	keyInfo := createKeyInfo(&ctx.KeyStore, ctx.XmlDsigPrefix)
-	object := createObject(signedProperties, ctx)
+// createSignature create filled signature element over the octets of the data reference, ctx is prepared.
+// dataCanonicalized tells whether data is the output of the DataContext.Canonicalizer transform,
+// otherwise the reference has no transforms and the data is digested as is
+func createSignature(goCtx context.Context, data []byte, dataCanonicalized bool, signatureIdPrefix string, ctx *SigningContext) (*etree.Element, error) {
 
-	signatureIdPrefix, err := createSignatureIdPrefix(ctx)
+	signedProperties, signedInfo, _, err := planSignature(goCtx, data, dataCanonicalized, signatureIdPrefix, ctx)
 	if err != nil {
 		return nil, err
 	}
+	// the digests are computed over qualified copies redeclaring the inherited namespaces, placing such a copy
+	// would duplicate the declarations of ds:Signature and xades:QualifyingProperties
+	for _, el := range []*etree.Element{signedInfo, signedProperties} {
+		if el != nil && declaresNamespace(el) {
+			return nil, fmt.Errorf("xades: %v placed in the signature declares a namespace", el.Tag)
+		}
+	}
+
+	//SignatureValue
+	qualifiedSignedInfo := createQualifiedSignedInfo(signedInfo, ctx.XmlDsigPrefix)
+	var signatureValueText string
+	if ctx.Signer != nil {
+		signatureValueText, err = ctx.Signer.CanonicalizeAndSign(qualifiedSignedInfo, &ctx.Canonicalizer)
+	} else if ctx.HMAC != nil {
+		signatureValueText, err = hmacSignatureValue(qualifiedSignedInfo, ctx.Canonicalizer, ctx.Hash, ctx.HMAC.Key)
+	} else if signer := registeredSigner(signatureMethodIdentifier(ctx)); signer != nil {
+		signatureValueText, err = signatureValueWithSignerFunc(qualifiedSignedInfo, &ctx.Canonicalizer, ctx.Hash, ctx.KeyStore.signer(), signerRand(ctx.Rand), signer)
+	} else if isEd25519(ctx.KeyStore.signer()) {
+		signatureValueText, err = SignatureValueWithSigner(qualifiedSignedInfo, &ctx.Canonicalizer, 0, ctx.KeyStore.signer(), ctx.Rand)
+	} else if isECDSA(ctx.KeyStore.signer()) {
+		signatureValueText, err = ecdsaSignatureValue(qualifiedSignedInfo, &ctx.Canonicalizer, ctx.Hash, ctx.KeyStore.signer(), signerRand(ctx.Rand))
+	} else if ctx.DsigContext != nil {
+		signatureValueText, err = SignatureValueWithContext(qualifiedSignedInfo, &ctx.Canonicalizer, ctx.DsigContext)
+	} else if ctx.Rand != nil || ctx.KeyStore.Signer != nil {
+		signatureValueText, err = SignatureValueWithSigner(qualifiedSignedInfo, &ctx.Canonicalizer, ctx.Hash, ctx.KeyStore.signer(), signerRand(ctx.Rand))
+	} else {
+		signatureValueText, err = NewRSASigner(&ctx.KeyStore, ctx.Hash).CanonicalizeAndSign(qualifiedSignedInfo, &ctx.Canonicalizer)
+	}
+	if err != nil {
+		return nil, wrapPhase(ErrSignatureValue, err)
+	}
+
+	signatureValue := createSignatureValue(wrapBase64(signatureValueText, ctx.Base64LineWidth), ctx.XmlDsigPrefix)
+	if ctx.SignatureValueID != "" {
+		signatureValue.Attr = append(signatureValue.Attr, idAttr(ctx.IdAttribute, ctx.SignatureValueID))
+	}
+	children := []etree.Token{signedInfo, signatureValue}
+	if ctx.HMAC != nil {
+		if keyInfo := createHMACKeyInfo(ctx.HMAC, ctx.XmlDsigPrefix); keyInfo != nil {
+			children = append(children, keyInfo)
+		}
+	} else {
+		keyInfo, err := createSignatureKeyInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, keyInfo)
+	}
+	if !ctx.PlainXMLDSig {
+		children = append(children, createObject(signedProperties, signatureIdPrefix, ctx))
+	}
 
 	signature := etree.Element{
 		Space: ctx.XmlDsigPrefix,
 		Tag:   dsig.SignatureTag,
 		Attr: []etree.Attr{
-			{Key: "Id", Value: signatureIdPrefix + "Signature"},
+			idAttr(ctx.IdAttribute, signatureId(signatureIdPrefix, ctx)),
 			//{Key: "xmlns", Value: dsig.Namespace},
 			{Space: "xmlns", Key: ctx.XmlDsigPrefix, Value: dsig.Namespace},
 		},
-		Child: []etree.Token{signedInfo, signatureValue, keyInfo, object},
+		Child: children,
 	}
+	linkChildren(&signature)
 	return &signature, nil
 }
 
+// linkChildren set parent and index of every token below el, tokens placed in Child literals carry neither
+// and etree navigation (Parent, Index, InsertChildAt, namespace resolution) would otherwise misbehave
+func linkChildren(el *etree.Element) {
+	children := append([]etree.Token(nil), el.Child...)
+	for len(el.Child) > 0 {
+		el.RemoveChildAt(len(el.Child) - 1)
+	}
+	for _, token := range children {
+		el.AddChild(token)
+		if child, ok := token.(*etree.Element); ok {
+			linkChildren(child)
+		}
+	}
+}
+
+// prepareSigningContext return a copy of ctx whose canonicalizers honour the configured inclusive namespace prefix lists
+func prepareSigningContext(ctx *SigningContext) (*SigningContext, error) {
+	prepared := *ctx
+
+	if err := ctx.SecurityPolicy.checkHashes(ctx); err != nil {
+		return nil, err
+	}
+	if ctx.KeyStore.Cert != nil {
+		if prepared.KeyStore.CertBinary == nil {
+			prepared.KeyStore.CertBinary = ctx.KeyStore.Cert.Raw
+		} else if !bytes.Equal(ctx.KeyStore.CertBinary, ctx.KeyStore.Cert.Raw) {
+			return nil, errors.New("xades: KeyStore.CertBinary is not the DER encoding of KeyStore.Cert")
+		}
+	} else if ctx.KeyStore.CertBinary != nil {
+		cert, err := x509.ParseCertificate(ctx.KeyStore.CertBinary)
+		if err != nil {
+			return nil, fmt.Errorf("xades: parsing KeyStore.CertBinary: %w", err)
+		}
+		prepared.KeyStore.Cert = cert
+	} else if ctx.HMAC == nil {
+		return nil, errors.New("xades: KeyStore has no certificate, set Cert or CertBinary")
+	}
+	if ctx.Signer != nil && (ctx.DsigContext != nil || ctx.HMAC != nil) {
+		return nil, errors.New("xades: Signer cannot be combined with DsigContext or HMAC")
+	}
+	if ctx.HMAC != nil {
+		if err := checkHMAC(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkSignatureKey(ctx); err != nil {
+		return nil, err
+	}
+	if ctx.KeyInfoContext.RequireChain && len(ctx.KeyStore.CertChain) == 0 {
+		return nil, errors.New("xades: KeyInfoContext.RequireChain is set but KeyStore.CertChain is empty")
+	}
+	if ctx.KeyInfoContext.SignKeyInfo && ctx.KeyInfoID == "" {
+		return nil, errors.New("xades: KeyInfoContext.SignKeyInfo requires KeyInfoID, the Id its reference points at")
+	}
+	if ctx.KeyInfoContext.SignKeyInfo && (ctx.PlainXMLDSig || ctx.HMAC != nil) {
+		return nil, errors.New("xades: KeyInfoContext.SignKeyInfo requires a XAdES signature with a certificate")
+	}
+	if ctx.PlainXMLDSig && (ctx.PropertiesContext.DataObjectFormat != nil || ctx.PropertiesContext.AllDataObjectsTimeStamp != nil ||
+		ctx.PropertiesContext.IndividualDataObjectsTimeStamp != nil) {
+		return nil, errors.New("xades: PlainXMLDSig signature cannot carry DataObjectFormat or data object time-stamps")
+	}
+	if ctx.PlainXMLDSig && ctx.qualifyingPropertiesURI != "" {
+		return nil, errors.New("xades: PlainXMLDSig signature has no QualifyingProperties to reference")
+	}
+	var err error
+	if prepared.Canonicalizer, err = inclusiveNamespacesCanonicalizer(defaultCanonicalizer(ctx.Canonicalizer), ctx.InclusiveNamespaces); err != nil {
+		return nil, err
+	}
+	if prepared.DataContext.Canonicalizer, err = inclusiveNamespacesCanonicalizer(defaultCanonicalizer(ctx.DataContext.Canonicalizer), ctx.DataContext.InclusiveNamespaces); err != nil {
+		return nil, err
+	}
+	if prepared.PropertiesContext.Canonicalizer, err = inclusiveNamespacesCanonicalizer(defaultCanonicalizer(ctx.PropertiesContext.Canonicalizer), ctx.PropertiesContext.InclusiveNamespaces); err != nil {
+		return nil, err
+	}
+	return &prepared, nil
+}
+
+// defaultCanonicalizer return canonicalizer, or exclusive c14n without prefix list when it is unset
+func defaultCanonicalizer(canonicalizer dsig.Canonicalizer) dsig.Canonicalizer {
+	if canonicalizer == nil {
+		return dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	}
+	return canonicalizer
+}
+
+// inclusiveNamespacesCanonicalizer return exclusive canonicalizer of the same algorithm as canonicalizer using prefixList
+func inclusiveNamespacesCanonicalizer(canonicalizer dsig.Canonicalizer, prefixList string) (dsig.Canonicalizer, error) {
+	if prefixList == "" {
+		return canonicalizer, nil
+	}
+	switch canonicalizer.Algorithm() {
+	case dsig.CanonicalXML10ExclusiveAlgorithmId:
+		return exclusiveCanonicalizer(prefixList, false), nil
+	case dsig.CanonicalXML10ExclusiveWithCommentsAlgorithmId:
+		return exclusiveCanonicalizer(prefixList, true), nil
+	}
+	return nil, fmt.Errorf("xades: inclusive namespaces %q require exclusive canonicalization, got %v", prefixList, canonicalizer.Algorithm())
+}
+
+// CanonicalizerFor return canonicalizer implementing the canonicalization algorithm algURI: inclusive c14n 1.0
+// and 1.1 and exclusive c14n 1.0, each with or without comments. Exclusive canonicalizers have an empty
+// InclusiveNamespaces prefix list, see SignedDataContext.InclusiveNamespaces
+func CanonicalizerFor(algURI string) (dsig.Canonicalizer, error) {
+	return canonicalizerForAlgorithm(algURI, "")
+}
+
+// canonicalizerForAlgorithm return canonicalizer implementing the canonicalization algorithm identifier,
+// prefixList applies to exclusive c14n only
+func canonicalizerForAlgorithm(algorithm string, prefixList string) (dsig.Canonicalizer, error) {
+	switch dsig.AlgorithmID(algorithm) {
+	case dsig.CanonicalXML10ExclusiveAlgorithmId:
+		return exclusiveCanonicalizer(prefixList, false), nil
+	case dsig.CanonicalXML10ExclusiveWithCommentsAlgorithmId:
+		return exclusiveCanonicalizer(prefixList, true), nil
+	case dsig.CanonicalXML10RecAlgorithmId:
+		return dsig.MakeC14N10RecCanonicalizer(), nil
+	case dsig.CanonicalXML10WithCommentsAlgorithmId:
+		return dsig.MakeC14N10WithCommentsCanonicalizer(), nil
+	case dsig.CanonicalXML11AlgorithmId:
+		return dsig.MakeC14N11Canonicalizer(), nil
+	case dsig.CanonicalXML11WithCommentsAlgorithmId:
+		return dsig.MakeC14N11WithCommentsCanonicalizer(), nil
+	default:
+		return nil, fmt.Errorf("xades: unsupported canonicalization algorithm %q", algorithm)
+	}
+}
+
+// createInclusiveNamespaces create ec:InclusiveNamespaces with prefixList
+func createInclusiveNamespaces(prefixList string) *etree.Element {
+	inclusiveNamespaces := etree.Element{
+		Space: inclusiveNamespacesPrefix,
+		Tag:   dsig.InclusiveNamespacesTag,
+		Attr: []etree.Attr{
+			{Space: "xmlns", Key: inclusiveNamespacesPrefix, Value: dsig.CanonicalXML10ExclusiveAlgorithmId.String()},
+			{Key: dsig.PrefixListAttr, Value: prefixList},
+		},
+	}
+	return &inclusiveNamespaces
+}
+
+// canonicalizeInContext canonicalize a copy of el carrying the namespace declarations in scope at el,
+// so that an element inside a document canonicalizes as it would when detached
+func canonicalizeInContext(canonicalizer dsig.Canonicalizer, el *etree.Element) ([]byte, error) {
+	nsCtx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(nsCtx, el)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalizer.Canonicalize(detached)
+}
+
+// validateReferenceURI check that an enveloped same-document reference "#id" or "#xpointer(id('id'))" resolves to
+// signedData, the element whose digest is computed, and that signedData of an enveloped whole-document reference
+// is the document element
+func validateReferenceURI(signedData *etree.Element, ctx *SignedDataContext) error {
+	if !ctx.IsEnveloped {
+		return nil
+	}
+	if isWholeDocumentURI(ctx.ReferenceURI) {
+		if documentElement(signedData) != signedData {
+			return fmt.Errorf("xades: reference URI %q selects the whole document, but <%v> is not its root element", ctx.ReferenceURI, signedData.FullTag())
+		}
+		return nil
+	}
+	if !strings.HasPrefix(ctx.ReferenceURI, "#") {
+		return nil
+	}
+	id, _ := referenceURIId(ctx.ReferenceURI)
+	if id == "" {
+		return nil
+	}
+	if elementId(signedData) != id {
+		return fmt.Errorf("xades: reference URI %q does not match the Id of the signed element <%v>", ctx.ReferenceURI, signedData.FullTag())
+	}
+	return nil
+}
+
+// isWholeDocumentURI tell whether uri dereferences to the document containing the signature
+func isWholeDocumentURI(uri string) bool {
+	return uri == "" || uri == "#xpointer(/)"
+}
+
+// documentElement return the topmost element above el, el itself when it is the root or detached.
+// The parent of the root of an etree.Document is the unnamed document node
+func documentElement(el *etree.Element) *etree.Element {
+	for parent := el.Parent(); parent != nil && parent.Tag != ""; parent = el.Parent() {
+		el = parent
+	}
+	return el
+}
+
+// referenceURIId return Id referenced by the same-document uri, empty for the whole document or an external uri.
+// keepComments tells whether the dereferenced content keeps its comments: XML DSig removes them for the
+// empty and the bare name "#id" URIs, XPointer URIs "#xpointer(/)" and "#xpointer(id('id'))" retain them
+func referenceURIId(uri string) (id string, keepComments bool) {
+	switch {
+	case uri == "":
+		return "", false
+	case !strings.HasPrefix(uri, "#"):
+		return "", true
+	case uri == "#xpointer(/)":
+		return "", true
+	case strings.HasPrefix(uri, "#xpointer(id(") && strings.HasSuffix(uri, "))"):
+		return strings.Trim(uri[len("#xpointer(id("):len(uri)-2], `'"`), true
+	}
+	return uri[1:], false
+}
+
+// canonicalizeReference canonicalize el in its namespace context like canonicalizeInContext, as dereferenced by a
+// reference: comments are left out unless keepComments, and so is the descendant excluded, ignored when nil or not
+// inside el
+func canonicalizeReference(canonicalizer dsig.Canonicalizer, el *etree.Element, excluded *etree.Element, keepComments bool) ([]byte, error) {
+
+	detached, err := dereference(el, excluded, keepComments)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalizer.Canonicalize(detached)
+}
+
+// dereference return a copy of el carrying the namespace declarations in scope, without the descendant excluded
+// and, unless keepComments, without comments
+func dereference(el *etree.Element, excluded *etree.Element, keepComments bool) (*etree.Element, error) {
+
+	var path []int
+	for ancestor := excluded; ancestor != el; ancestor = ancestor.Parent() {
+		if ancestor == nil {
+			path = nil
+			break
+		}
+		path = append([]int{ancestor.Index()}, path...)
+	}
+
+	nsCtx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(nsCtx, el)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(path) > 0 {
+		container := detached
+		for _, index := range path[:len(path)-1] {
+			container = container.Child[index].(*etree.Element)
+		}
+		container.RemoveChildAt(path[len(path)-1])
+	}
+	if !keepComments {
+		removeComments(detached)
+	}
+	return detached, nil
+}
+
+// withoutSignatures return a copy of el carrying the namespace declarations in scope, without the ds:Signature
+// elements below it, as selected by the XPath transform of ExcludeSignatures
+func withoutSignatures(el *etree.Element) (*etree.Element, error) {
+	detached, err := dereference(el, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	removeSignatures(detached)
+	return detached, nil
+}
+
+// removeSignatures remove the ds:Signature elements below el
+func removeSignatures(el *etree.Element) {
+	for i := len(el.Child) - 1; i >= 0; i-- {
+		if child, ok := el.Child[i].(*etree.Element); ok {
+			if child.Tag == dsig.SignatureTag && child.NamespaceURI() == dsig.Namespace {
+				el.RemoveChildAt(i)
+			} else {
+				removeSignatures(child)
+			}
+		}
+	}
+}
+
+// removeComments remove the comments below el
+func removeComments(el *etree.Element) {
+	for i := len(el.Child) - 1; i >= 0; i-- {
+		switch token := el.Child[i].(type) {
+		case *etree.Comment:
+			el.RemoveChildAt(i)
+		case *etree.Element:
+			removeComments(token)
+		}
+	}
+}
+
+// elementId return value of the Id, ID, id or xml:id attribute of the element
+func elementId(el *etree.Element) string {
+	if attr := elementIdAttr(el); attr != nil {
+		return attr.Value
+	}
+	return ""
+}
+
+// elementIdAttr return the Id, ID or xml:id attribute of el, nil when it has none
+func elementIdAttr(el *etree.Element) *etree.Attr {
+	for i, attr := range el.Attr {
+		if (attr.Space == "" || attr.Space == "xml") && strings.EqualFold(attr.Key, "id") {
+			return &el.Attr[i]
+		}
+	}
+	return nil
+}
+
+// idAttributeName return the name of the Id attribute of el, "Id" when it has none
+func idAttributeName(el *etree.Element) string {
+	if attr := elementIdAttr(el); attr != nil {
+		return attr.FullKey()
+	}
+	return idAttributeOrDefault("")
+}
+
+// declaresNamespace tell whether el carries a namespace declaration
+func declaresNamespace(el *etree.Element) bool {
+	for _, attr := range el.Attr {
+		if attr.Space == "xmlns" || (attr.Space == "" && attr.Key == "xmlns") {
+			return true
+		}
+	}
+	return false
+}
+
+// idAttributeOrDefault return name, or "Id" when it is empty
+func idAttributeOrDefault(name string) string {
+	if name == "" {
+		return "Id"
+	}
+	return name
+}
+
+// idAttr return Id attribute named name, "Id" when empty, possibly prefixed as "xml:id"
+func idAttr(name string, value string) etree.Attr {
+	name = idAttributeOrDefault(name)
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return etree.Attr{Space: name[:i], Key: name[i+1:], Value: value}
+	}
+	return etree.Attr{Key: name, Value: value}
+}
+
+// createQualifiedSignedInfo return a copy of signedInfo declaring the ds namespace it inherits from ds:Signature.
+// The copy is canonicalized for the signature only, signedInfo itself is the element placed in the signature
 func createQualifiedSignedInfo(signedInfo *etree.Element, xmlDsigPrefix string) *etree.Element {
 	qualifiedSignedInfo := signedInfo.Copy()
 	qualifiedSignedInfo.Attr = append(qualifiedSignedInfo.Attr, etree.Attr{Space: "xmlns", Key: xmlDsigPrefix, Value: dsig.Namespace})
 	return qualifiedSignedInfo
 }
-func createSignedInfo(digestValueDataText string, digestValuePropertiesText string, ctx *SigningContext) *etree.Element {
+
+// createSignedInfo create SignedInfo with the data reference, the SignedProperties reference unless PlainXMLDSig and
+// the KeyInfo reference when digestValueKeyInfoText is set
+func createSignedInfo(digestValueDataText string, digestValuePropertiesText string, digestValueKeyInfoText string, signatureIdPrefix string, dataCanonicalized bool, ctx *SigningContext) *etree.Element {
 
 	var transformEnvSign etree.Element
-	if ctx.DataContext.IsEnveloped {
+	if ctx.DataContext.IsEnveloped && ctx.DataContext.ExcludeSignatures {
+		transformEnvSign = *createXPathExcludeSignaturesTransform(ctx.XmlDsigPrefix)
+	} else if ctx.DataContext.IsEnveloped {
 		transformEnvSign = etree.Element{
 			Space: ctx.XmlDsigPrefix,
 			Tag:   dsig.TransformTag,
@@ -203,6 +1002,9 @@ func createSignedInfo(digestValueDataText string, digestValuePropertiesText stri
 			{Key: dsig.AlgorithmAttr, Value: ctx.DataContext.Canonicalizer.Algorithm().String()}, // "http://www.w3.org/2001/10/xml-exc-c14n#"},
 		},
 	}
+	if ctx.DataContext.InclusiveNamespaces != "" {
+		transformData.AddChild(createInclusiveNamespaces(ctx.DataContext.InclusiveNamespaces))
+	}
 
 	transformProperties := etree.Element{
 		Space: ctx.XmlDsigPrefix,
@@ -211,21 +1013,40 @@ func createSignedInfo(digestValueDataText string, digestValuePropertiesText stri
 			{Key: dsig.AlgorithmAttr, Value: ctx.PropertiesContext.Canonicalizer.Algorithm().String()}, // "http://www.w3.org/2001/10/xml-exc-c14n#"},
 		},
 	}
+	if ctx.PropertiesContext.InclusiveNamespaces != "" {
+		transformProperties.AddChild(createInclusiveNamespaces(ctx.PropertiesContext.InclusiveNamespaces))
+	}
 
 	transformsData := etree.Element{
 		Space: ctx.XmlDsigPrefix,
 		Tag:   dsig.TransformsTag,
 	}
-	if ctx.DataContext.IsEnveloped {
-		transformsData.AddChild(&transformEnvSign)
+	for _, transform := range dataTransforms(&ctx.DataContext) {
+		switch transform {
+		case EnvelopedTransform:
+			transformsData.AddChild(&transformEnvSign)
+		case Base64DecodeTransform:
+			transformsData.AddChild(&etree.Element{
+				Space: ctx.XmlDsigPrefix,
+				Tag:   dsig.TransformTag,
+				Attr: []etree.Attr{
+					{Key: dsig.AlgorithmAttr, Value: Base64TransformAlgorithmId},
+				},
+			})
+		case CanonicalizationTransform:
+			transformsData.AddChild(&transformData)
+		case XSLTStylesheetTransform:
+			// the stylesheet was parsed when transforming the data
+			transformXSLT, _ := createXSLTTransform(ctx.DataContext.XSLTStylesheet, ctx.XmlDsigPrefix)
+			transformsData.AddChild(transformXSLT)
+		}
 	}
-	transformsData.AddChild(&transformData)
 
 	digestMethodData := etree.Element{
 		Space: ctx.XmlDsigPrefix,
 		Tag:   dsig.DigestMethodTag,
 		Attr: []etree.Attr{
-			{Key: dsig.AlgorithmAttr, Value: digestAlgorithmIdentifiers[ctx.DataContext.Hash]},
+			{Key: dsig.AlgorithmAttr, Value: digestAlgorithmURI(ctx.DataContext.Hash)},
 		},
 	}
 
@@ -233,7 +1054,7 @@ func createSignedInfo(digestValueDataText string, digestValuePropertiesText stri
 		Space: ctx.XmlDsigPrefix,
 		Tag:   dsig.DigestMethodTag,
 		Attr: []etree.Attr{
-			{Key: dsig.AlgorithmAttr, Value: digestAlgorithmIdentifiers[ctx.PropertiesContext.Hash]},
+			{Key: dsig.AlgorithmAttr, Value: digestAlgorithmURI(ctx.PropertiesContext.Hash)},
 		},
 	}
 
@@ -262,44 +1083,111 @@ func createSignedInfo(digestValueDataText string, digestValuePropertiesText stri
 			{Key: dsig.AlgorithmAttr, Value: ctx.Canonicalizer.Algorithm().String()},
 		},
 	}
+	if ctx.InclusiveNamespaces != "" {
+		canonicalizationMethod.AddChild(createInclusiveNamespaces(ctx.InclusiveNamespaces))
+	}
 
 	signatureMethod := etree.Element{
 		Space: ctx.XmlDsigPrefix,
 		Tag:   dsig.SignatureMethodTag,
 		Attr: []etree.Attr{
-			{Key: dsig.AlgorithmAttr, Value: signatureMethodIdentifiers[ctx.Hash]},
+			{Key: dsig.AlgorithmAttr, Value: signatureMethodIdentifier(ctx)},
 		},
 	}
 
 	referenceData := etree.Element{
 		Space: ctx.XmlDsigPrefix,
 		Tag:   dsig.ReferenceTag,
-		Attr: []etree.Attr{
-			{Key: dsig.URIAttr, Value: ctx.DataContext.ReferenceURI},
-		},
 		Child: []etree.Token{&transformsData, &digestMethodData, &digestValueData},
 	}
+	if !dataCanonicalized || len(transformsData.Child) == 0 {
+		referenceData.Child = []etree.Token{&digestMethodData, &digestValueData}
+	}
+	if referenceId := dataReferenceId(signatureIdPrefix, ctx); referenceId != "" {
+		referenceData.Attr = append(referenceData.Attr, idAttr(ctx.IdAttribute, referenceId))
+	}
+	referenceData.CreateAttr(dsig.URIAttr, ctx.DataContext.ReferenceURI)
+	if ctx.DataContext.ReferenceType != "" {
+		referenceData.CreateAttr("Type", ctx.DataContext.ReferenceType)
+	}
 
-	signatureIdPrefix, _ := createSignatureIdPrefix(ctx)
 	referenceProperties := etree.Element{
 		Space: ctx.XmlDsigPrefix,
 		Tag:   dsig.ReferenceTag,
 		Attr: []etree.Attr{
-			{Key: dsig.URIAttr, Value: fmt.Sprintf("#%vSignedProperties", signatureIdPrefix)},
-			{Key: "Type", Value: "http://uri.etsi.org/01903#SignedProperties"},
+			{Key: dsig.URIAttr, Value: ctx.qualifyingPropertiesURI + "#" + signedPropertiesId(signatureIdPrefix, ctx)},
+			{Key: "Type", Value: signedPropertiesReferenceType(ctx)},
 		},
 		Child: []etree.Token{&transformsProperties, &digestMethodProperties, &digestValueProperties},
 	}
+	if ctx.SignedPropertiesReferenceID != "" {
+		referenceProperties.Attr = append([]etree.Attr{idAttr(ctx.IdAttribute, ctx.SignedPropertiesReferenceID)}, referenceProperties.Attr...)
+	}
 
 	signedInfo := etree.Element{
 		Space: ctx.XmlDsigPrefix,
 		Tag:   dsig.SignedInfoTag,
 		Child: []etree.Token{&canonicalizationMethod, &signatureMethod, &referenceData, &referenceProperties},
 	}
+	if ctx.SignedInfoID != "" {
+		signedInfo.Attr = append(signedInfo.Attr, idAttr(ctx.IdAttribute, ctx.SignedInfoID))
+	}
+	if ctx.PlainXMLDSig {
+		signedInfo.Child = signedInfo.Child[:3]
+	}
+	if digestValueKeyInfoText != "" {
+		// KeyInfo is digested as SignedProperties is
+		digestValueKeyInfo := digestValueProperties.Copy()
+		digestValueKeyInfo.SetText(digestValueKeyInfoText)
+		signedInfo.AddChild(&etree.Element{
+			Space: ctx.XmlDsigPrefix,
+			Tag:   dsig.ReferenceTag,
+			Attr:  []etree.Attr{{Key: dsig.URIAttr, Value: "#" + ctx.KeyInfoID}},
+			Child: []etree.Token{transformsProperties.Copy(), digestMethodProperties.Copy(), digestValueKeyInfo},
+		})
+	}
 
 	return &signedInfo
 }
 
+// createXPathExcludeSignaturesTransform create XPath transform removing every ds:Signature
+func createXPathExcludeSignaturesTransform(xmlDsigPrefix string) *etree.Element {
+	xpath := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   xpathTag,
+	}
+	xpath.SetText(fmt.Sprintf("not(ancestor-or-self::*[local-name()='%v' and namespace-uri()='%v'])", dsig.SignatureTag, dsig.Namespace))
+
+	transform := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   dsig.TransformTag,
+		Attr: []etree.Attr{
+			{Key: dsig.AlgorithmAttr, Value: xpathTransformAlgorithmId},
+		},
+		Child: []etree.Token{&xpath},
+	}
+	return &transform
+}
+
+// wrapBase64 insert a line feed every width characters of base64encoded, width 0 leaves it on a single line
+func wrapBase64(base64encoded string, width int) string {
+	if width <= 0 || len(base64encoded) <= width {
+		return base64encoded
+	}
+	var builder strings.Builder
+	for i := 0; i < len(base64encoded); i += width {
+		if i > 0 {
+			builder.WriteByte('\n')
+		}
+		end := i + width
+		if end > len(base64encoded) {
+			end = len(base64encoded)
+		}
+		builder.WriteString(base64encoded[i:end])
+	}
+	return builder.String()
+}
+
 func createSignatureValue(base64Signature string, xmlDsigPrefix string) *etree.Element {
 	signatureValue := etree.Element{
 		Space: xmlDsigPrefix,
@@ -309,47 +1197,258 @@ func createSignatureValue(base64Signature string, xmlDsigPrefix string) *etree.E
 	return &signatureValue
 }
 
-func createKeyInfo(keyStore *MemoryX509KeyStore, xmlDsigPrefix string) *etree.Element {
+// createSignatureKeyInfo create ds:KeyInfo of the signature of ctx with Id KeyInfoID
+func createSignatureKeyInfo(ctx *SigningContext) (*etree.Element, error) {
+	keyInfo, err := createKeyInfo(&ctx.KeyStore, &ctx.KeyInfoContext, ctx.IssuerNameFormat, ctx.Base64LineWidth, ctx.XmlDsigPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.KeyInfoID != "" {
+		keyInfo.Attr = append(keyInfo.Attr, idAttr(ctx.IdAttribute, ctx.KeyInfoID))
+	}
+	return keyInfo, nil
+}
 
-	x509Cerificate := etree.Element{
+// createKeyInfo create ds:KeyInfo of keyStore, served from certCache unless a custom issuerNameFormat renders
+// its X509IssuerSerial
+func createKeyInfo(keyStore *MemoryX509KeyStore, keyInfoCtx *KeyInfoContext, issuerNameFormat IssuerNameFormat, lineWidth int, xmlDsigPrefix string) (*etree.Element, error) {
+
+	if keyInfoCtx.IncludeX509IssuerSerial && issuerNameFormat != nil {
+		return newKeyInfo(keyStore, keyInfoCtx, issuerNameFormat, lineWidth, xmlDsigPrefix)
+	}
+	key := newKeyInfoCacheKey(keyStore, keyInfoCtx, lineWidth, xmlDsigPrefix)
+	if keyInfo := cachedKeyInfo(keyStore, key); keyInfo != nil {
+		return keyInfo, nil
+	}
+	keyInfo, err := newKeyInfo(keyStore, keyInfoCtx, nil, lineWidth, xmlDsigPrefix)
+	if err != nil {
+		return nil, err
+	}
+	storeKeyInfo(keyStore, key, keyInfo)
+	return keyInfo, nil
+}
+
+// newKeyInfo build ds:KeyInfo of keyStore with the children selected by keyInfoCtx
+func newKeyInfo(keyStore *MemoryX509KeyStore, keyInfoCtx *KeyInfoContext, issuerNameFormat IssuerNameFormat, lineWidth int, xmlDsigPrefix string) (*etree.Element, error) {
+
+	if keyInfoCtx.OmitX509Data && !keyInfoCtx.IncludeKeyValue && keyInfoCtx.KeyName == "" {
+		return nil, errors.New("xades: KeyInfo would be empty, OmitX509Data requires IncludeKeyValue or KeyName")
+	}
+
+	keyInfo := etree.Element{
 		Space: xmlDsigPrefix,
-		Tag:   dsig.X509CertificateTag,
+		Tag:   dsig.KeyInfoTag,
 	}
-	x509Cerificate.SetText(base64.StdEncoding.EncodeToString(keyStore.CertBinary))
+
+	if keyInfoCtx.KeyName != "" {
+		keyInfo.AddChild(createKeyName(keyInfoCtx.KeyName, xmlDsigPrefix))
+	}
+
+	if keyInfoCtx.IncludeKeyValue {
+		keyValue, err := createKeyValue(keyStore, xmlDsigPrefix)
+		if err != nil {
+			return nil, err
+		}
+		keyInfo.AddChild(keyValue)
+	}
+
+	if keyInfoCtx.OmitX509Data {
+		return &keyInfo, nil
+	}
+
+	x509Data, err := createX509Data(keyStore, keyInfoCtx, issuerNameFormat, lineWidth, xmlDsigPrefix)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo.AddChild(x509Data)
+	return &keyInfo, nil
+}
+
+// createX509Data create ds:X509Data, children are ordered IssuerSerial, SKI, SubjectName, Certificate.
+// Certificates are wrapped at lineWidth
+func createX509Data(keyStore *MemoryX509KeyStore, keyInfoCtx *KeyInfoContext, issuerNameFormat IssuerNameFormat, lineWidth int, xmlDsigPrefix string) (*etree.Element, error) {
 
 	x509Data := etree.Element{
 		Space: xmlDsigPrefix,
 		Tag:   dsig.X509DataTag,
-		Child: []etree.Token{&x509Cerificate},
 	}
 
-	for _, cert := range keyStore.CertChain {
+	if keyInfoCtx.IncludeX509IssuerSerial {
+		x509IssuerSerial := createIssuerSerial(keyStore.Cert, issuerNameFormat, xmlDsigPrefix, xmlDsigPrefix, x509IssuerSerialTag)
+		x509Data.AddChild(x509IssuerSerial)
+	}
+
+	if keyInfoCtx.IncludeX509SKI {
+		if len(keyStore.Cert.SubjectKeyId) == 0 {
+			return nil, errors.New("xades: IncludeX509SKI is set but the certificate has no subject key identifier extension")
+		}
+		x509SKI := etree.Element{
+			Space: xmlDsigPrefix,
+			Tag:   x509SKITag,
+		}
+		x509SKI.SetText(base64.StdEncoding.EncodeToString(keyStore.Cert.SubjectKeyId))
+		x509Data.AddChild(&x509SKI)
+	}
+
+	if keyInfoCtx.IncludeX509SubjectName {
+		x509SubjectName := etree.Element{
+			Space: xmlDsigPrefix,
+			Tag:   x509SubjectNameTag,
+		}
+		x509SubjectName.SetText(keyStore.Cert.Subject.String())
+		x509Data.AddChild(&x509SubjectName)
+	}
+
+	if keyInfoCtx.OmitX509Certificate {
+		if len(x509Data.Child) == 0 {
+			return nil, errors.New("xades: X509Data would be empty, OmitX509Certificate requires another X509Data child")
+		}
+		return &x509Data, nil
+	}
+
+	x509Cerificate := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   dsig.X509CertificateTag,
+	}
+	x509Cerificate.SetText(wrapBase64(certBase64(keyStore.Cert, keyStore.CertBinary), lineWidth))
+	x509Data.AddChild(&x509Cerificate)
+
+	chain := keyStore.CertChain
+	if keyInfoCtx.OrderCertChain {
+		var err error
+		if chain, err = orderCertChain(keyStore.Cert, chain); err != nil {
+			return nil, err
+		}
+	}
+	for _, cert := range chain {
+		if keyInfoCtx.ExcludeRootCertificate && isSelfSigned(cert) {
+			continue
+		}
 		x509CerificateChain := etree.Element{
 			Space: xmlDsigPrefix,
 			Tag:   dsig.X509CertificateTag,
 		}
-		x509Cerificate.SetText(base64.StdEncoding.EncodeToString(cert.Raw))
+		x509CerificateChain.SetText(wrapBase64(certBase64(cert, cert.Raw), lineWidth))
 		x509Data.AddChild(&x509CerificateChain)
 	}
 
-	keyInfo := etree.Element{
+	return &x509Data, nil
+}
+
+// orderCertChain return chain ordered from the issuer of leaf upwards, every certificate of chain must be on that path
+func orderCertChain(leaf *x509.Certificate, chain []*x509.Certificate) ([]*x509.Certificate, error) {
+
+	remaining := append([]*x509.Certificate(nil), chain...)
+	ordered := make([]*x509.Certificate, 0, len(chain))
+	for cert := leaf; len(remaining) > 0 && !isSelfSigned(cert); {
+		issuer := -1
+		for i, candidate := range remaining {
+			if isIssuedBy(cert, candidate) {
+				issuer = i
+				break
+			}
+		}
+		if issuer < 0 {
+			break
+		}
+		cert = remaining[issuer]
+		ordered = append(ordered, cert)
+		remaining = append(remaining[:issuer], remaining[issuer+1:]...)
+	}
+	if len(remaining) > 0 {
+		return nil, fmt.Errorf("xades: broken certificate chain, %q is not on the path of %q", remaining[0].Subject.String(), leaf.Subject.String())
+	}
+	return ordered, nil
+}
+
+// isIssuedBy tells whether the issuer name of cert is the subject of issuer and issuer signed cert
+func isIssuedBy(cert *x509.Certificate, issuer *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return isIssuedBy(cert, cert)
+}
+
+// createIssuerSerial create issuer serial element with ds:X509IssuerName and ds:X509SerialNumber children, the
+// issuer name rendered by format, GoIssuerName when nil
+func createIssuerSerial(cert *x509.Certificate, format IssuerNameFormat, space string, xmlDsigPrefix string, tag string) *etree.Element {
+	issuerName, serialNumber := certIssuerSerial(cert)
+	if format != nil {
+		issuerName = format(cert)
+	}
+	x509IssuerName := etree.Element{
 		Space: xmlDsigPrefix,
-		Tag:   dsig.KeyInfoTag,
-		Child: []etree.Token{&x509Data},
+		Tag:   x509IssuerNameTag,
+	}
+	x509IssuerName.SetText(issuerName)
+	x509SerialNumber := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   x509SerialNumberTag,
+	}
+	x509SerialNumber.SetText(serialNumber)
+
+	issuerSerial := etree.Element{
+		Space: space,
+		Tag:   tag,
+		Child: []etree.Token{&x509IssuerName, &x509SerialNumber},
 	}
-	return &keyInfo
+	return &issuerSerial
 }
 
-func createObject(signedProperties *etree.Element, ctx *SigningContext) *etree.Element {
+// createKeyName create ds:KeyName with name
+func createKeyName(name string, xmlDsigPrefix string) *etree.Element {
+	keyName := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   keyNameTag,
+	}
+	keyName.SetText(name)
+	return &keyName
+}
+
+// createKeyValue create ds:KeyValue with the RSA public key of the certificate
+func createKeyValue(keyStore *MemoryX509KeyStore, xmlDsigPrefix string) (*etree.Element, error) {
+
+	publicKey, ok := keyStore.Cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("xades: KeyValue requires an RSA public key, got %T", keyStore.Cert.PublicKey)
+	}
+
+	// big.Int.Bytes returns the minimal big-endian form, leading zero octets are already stripped
+	modulus := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   modulusTag,
+	}
+	modulus.SetText(base64.StdEncoding.EncodeToString(publicKey.N.Bytes()))
+
+	exponent := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   exponentTag,
+	}
+	exponent.SetText(base64.StdEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()))
+
+	rsaKeyValue := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   rsaKeyValueTag,
+		Child: []etree.Token{&modulus, &exponent},
+	}
+
+	keyValue := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   keyValueTag,
+		Child: []etree.Token{&rsaKeyValue},
+	}
+	return &keyValue, nil
+}
 
-	signatureIdPrefix, _ := createSignatureIdPrefix(ctx)
+func createObject(signedProperties *etree.Element, signatureIdPrefix string, ctx *SigningContext) *etree.Element {
 
 	qualifyingProperties := etree.Element{
 		Space: Prefix,
 		Tag:   QualifyingPropertiesTag,
 		Attr: []etree.Attr{
 			{Space: "xmlns", Key: Prefix, Value: Namespace},
-			{Key: targetAttr, Value: fmt.Sprintf("#%vSignature", signatureIdPrefix)},
+			{Key: targetAttr, Value: "#" + signatureId(signatureIdPrefix, ctx)},
 		},
 		Child: []etree.Token{signedProperties},
 	}
@@ -358,14 +1457,20 @@ func createObject(signedProperties *etree.Element, ctx *SigningContext) *etree.E
 		Tag:   "Object",
 		Child: []etree.Token{&qualifyingProperties},
 	}
+	if ctx.ObjectID != "" {
+		object.Attr = append(object.Attr, idAttr(ctx.IdAttribute, ctx.ObjectID))
+	}
 	return &object
 }
 
+// createQualifiedSignedProperties return a copy of signedProperties declaring the ds and xades namespaces it
+// inherits from its ancestors. The copy is canonicalized for the digest only, signedProperties itself is the
+// element placed in the signature
 func createQualifiedSignedProperties(signedProperties *etree.Element, xmlDsigPrefix string) *etree.Element {
 
 	qualifiedSignedProperties := signedProperties.Copy()
 	qualifiedSignedProperties.Attr = append(
-		signedProperties.Attr,
+		qualifiedSignedProperties.Attr,
 		etree.Attr{Space: "xmlns", Key: xmlDsigPrefix, Value: dsig.Namespace},
 		etree.Attr{Space: "xmlns", Key: Prefix, Value: Namespace},
 	)
@@ -373,14 +1478,161 @@ func createQualifiedSignedProperties(signedProperties *etree.Element, xmlDsigPre
 	return qualifiedSignedProperties
 }
 
-func createSignedProperties(keystore *MemoryX509KeyStore, signTime time.Time, ctx *SigningContext) *etree.Element {
+func createSignedProperties(keystore *MemoryX509KeyStore, signTime time.Time, signatureIdPrefix string, ctx *SigningContext) (*etree.Element, error) {
 	xmlDsigPrefix := ctx.XmlDsigPrefix
 
+	signingCertificateTag := SigningCertificateTag
+	if ctx.PropertiesContext.UseSigningCertificateV2 {
+		signingCertificateTag = SigningCertificateV2Tag
+	}
+	signingCertificate := etree.Element{
+		Space: Prefix,
+		Tag:   signingCertificateTag,
+	}
+
+	certificates := []*x509.Certificate{keystore.Cert}
+	if ctx.PropertiesContext.SigningCertificateChain {
+		chain, err := orderCertChain(keystore.Cert, keystore.CertChain)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, chain...)
+	}
+	for i, certificate := range certificates {
+		certBinary := certificate.Raw
+		if i == 0 {
+			certBinary = keystore.CertBinary
+		}
+		cert := createCert(certificate, certBinary, certDigestHash(ctx), ctx.IssuerNameFormat, xmlDsigPrefix)
+		if ctx.PropertiesContext.UseSigningCertificateV2 {
+			var err error
+			if cert, err = createCertV2(certificate, certBinary, certDigestHash(ctx), xmlDsigPrefix); err != nil {
+				return nil, err
+			}
+		}
+		signingCertificate.AddChild(cert)
+	}
+
+	signingTime := etree.Element{
+		Space: Prefix,
+		Tag:   SigningTimeTag,
+	}
+	signingTime.SetText(signTime.Format(timeFormat))
+
+	signedSignatureProperties := etree.Element{
+		Space: Prefix,
+		Tag:   SignedSignaturePropertiesTag,
+		Child: []etree.Token{&signingTime, &signingCertificate},
+	}
+	if ctx.PropertiesContext.OmitSigningTime {
+		signedSignatureProperties.Child = []etree.Token{&signingCertificate}
+	}
+	if policy := ctx.PropertiesContext.SignaturePolicy; policy != nil {
+		signaturePolicyIdentifier, err := createSignaturePolicyIdentifier(policy, xmlDsigPrefix)
+		if err != nil {
+			return nil, err
+		}
+		signedSignatureProperties.AddChild(signaturePolicyIdentifier)
+	}
+	if len(ctx.PropertiesContext.ClaimedRoles) > 0 {
+		signedSignatureProperties.AddChild(createSignerRole(ctx.PropertiesContext.ClaimedRoles))
+	}
+
+	signedProperties := etree.Element{
+		Space: Prefix,
+		Tag:   SignedPropertiesTag,
+		Attr: []etree.Attr{
+			idAttr(ctx.IdAttribute, signedPropertiesId(signatureIdPrefix, ctx)),
+		},
+		Child: []etree.Token{&signedSignatureProperties},
+	}
+
+	return &signedProperties, nil
+}
+
+// createSignerRole create xades:SignerRole with xades:ClaimedRoles holding claimedRoles
+func createSignerRole(claimedRoles []string) *etree.Element {
+
+	claimedRolesElement := etree.Element{
+		Space: Prefix,
+		Tag:   ClaimedRolesTag,
+	}
+	for _, role := range claimedRoles {
+		claimedRole := claimedRolesElement.CreateElement(ClaimedRoleTag)
+		claimedRole.Space = Prefix
+		claimedRole.SetText(role)
+	}
+	return &etree.Element{
+		Space: Prefix,
+		Tag:   SignerRoleTag,
+		Child: []etree.Token{&claimedRolesElement},
+	}
+}
+
+// createCertV2 create xades:Cert of SigningCertificateV2 with CertDigest and IssuerSerialV2 of the certificate
+func createCertV2(certificate *x509.Certificate, certBinary []byte, hash crypto.Hash, xmlDsigPrefix string) (*etree.Element, error) {
+
+	certDigest := createDigestAlgAndDigestValue(CertDigestTag, certDigest(certificate, certBinary, hash), hash, xmlDsigPrefix)
+	der, err := certIssuerSerialV2(certificate)
+	if err != nil {
+		return nil, err
+	}
+	issuerSerialV2 := etree.Element{
+		Space: Prefix,
+		Tag:   IssuerSerialV2Tag,
+	}
+	issuerSerialV2.SetText(base64.StdEncoding.EncodeToString(der))
+
+	cert := etree.Element{
+		Space: Prefix,
+		Tag:   CertTag,
+		Child: []etree.Token{certDigest, &issuerSerialV2},
+	}
+	return &cert, nil
+}
+
+// issuerSerial is the IssuerSerial structure of RFC 5035, the issuer GeneralNames holds the directoryName only
+type issuerSerial struct {
+	Issuer       []asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// marshalIssuerSerial return DER encoded IssuerSerial of the certificate
+func marshalIssuerSerial(certificate *x509.Certificate) ([]byte, error) {
+	directoryName := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: certificate.RawIssuer}
+	return asn1.Marshal(issuerSerial{
+		Issuer:       []asn1.RawValue{directoryName},
+		SerialNumber: certificate.SerialNumber,
+	})
+}
+
+// createCert create xades:Cert with CertDigest and IssuerSerial of the certificate
+func createCert(certificate *x509.Certificate, certBinary []byte, hash crypto.Hash, issuerNameFormat IssuerNameFormat, xmlDsigPrefix string) *etree.Element {
+
+	certDigest := createDigestAlgAndDigestValue(CertDigestTag, certDigest(certificate, certBinary, hash), hash, xmlDsigPrefix)
+	issuerSerial := createIssuerSerial(certificate, issuerNameFormat, Prefix, xmlDsigPrefix, IssuerSerialTag)
+
+	cert := etree.Element{
+		Space: Prefix,
+		Tag:   CertTag,
+		Child: []etree.Token{certDigest, issuerSerial},
+	}
+	return &cert
+}
+
+// createDigestAlgAndValue create DigestAlgAndValueType element named tag with ds:DigestMethod and ds:DigestValue of data
+func createDigestAlgAndValue(tag string, data []byte, hash crypto.Hash, xmlDsigPrefix string) *etree.Element {
+	return createDigestAlgAndDigestValue(tag, DigestBytes(data, hash), hash, xmlDsigPrefix)
+}
+
+// createDigestAlgAndDigestValue create DigestAlgAndValueType element named tag with the base64 digest value by hash
+func createDigestAlgAndDigestValue(tag string, value string, hash crypto.Hash, xmlDsigPrefix string) *etree.Element {
+
 	digestMethod := etree.Element{
 		Space: xmlDsigPrefix,
 		Tag:   dsig.DigestMethodTag,
 		Attr: []etree.Attr{
-			{Key: dsig.AlgorithmAttr, Value: digestAlgorithmIdentifiers[crypto.SHA1]},
+			{Key: dsig.AlgorithmAttr, Value: digestAlgorithmURI(hash)},
 		},
 	}
 
@@ -388,83 +1640,293 @@ func createSignedProperties(keystore *MemoryX509KeyStore, signTime time.Time, ct
 		Space: xmlDsigPrefix,
 		Tag:   dsig.DigestValueTag,
 	}
-	hash := sha1.Sum(keystore.CertBinary)
-	digestValue.SetText(base64.StdEncoding.EncodeToString(hash[0:]))
+	digestValue.SetText(value)
 
-	certDigest := etree.Element{
+	digestAlgAndValue := etree.Element{
 		Space: Prefix,
-		Tag:   CertDigestTag,
+		Tag:   tag,
 		Child: []etree.Token{&digestMethod, &digestValue},
 	}
+	return &digestAlgAndValue
+}
 
-	x509IssuerName := etree.Element{
-		Space: xmlDsigPrefix,
-		Tag:   "X509IssuerName",
+// certDigestHash return hash of the SigningCertificate CertDigest
+func certDigestHash(ctx *SigningContext) crypto.Hash {
+	if ctx.CertDigestHash != 0 {
+		return ctx.CertDigestHash
 	}
-	x509IssuerName.SetText(keystore.Cert.Issuer.String())
-	x509SerialNumber := etree.Element{
-		Space: xmlDsigPrefix,
-		Tag:   "X509SerialNumber",
-	}
-	x509SerialNumber.SetText(keystore.Cert.SerialNumber.String())
+	return ctx.PropertiesContext.Hash
+}
 
-	issuerSerial := etree.Element{
+// createSignedDataObjectProperties create xades:SignedDataObjectProperties, nil when no property is configured so a
+// XAdES-BES signature carries no empty container. Children are added in the schema order DataObjectFormat,
+// CommitmentTypeIndication, AllDataObjectsTimeStamp, IndividualDataObjectsTimeStamp
+func createSignedDataObjectProperties(goCtx context.Context, data []byte, dataCanonicalized bool, signatureIdPrefix string, ctx *SigningContext) (*etree.Element, error) {
+
+	signedDataObjectProperties := etree.Element{
 		Space: Prefix,
-		Tag:   IssuerSerialTag,
-		Child: []etree.Token{&x509IssuerName, &x509SerialNumber},
+		Tag:   SignedDataObjectPropertiesTag,
 	}
 
-	cert := etree.Element{
-		Space: Prefix,
-		Tag:   CertTag,
-		Child: []etree.Token{&certDigest, &issuerSerial},
+	if ctx.PropertiesContext.DataObjectFormat != nil {
+		dataObjectFormat, err := createDataObjectFormat(signatureIdPrefix, ctx)
+		if err != nil {
+			return nil, err
+		}
+		signedDataObjectProperties.AddChild(dataObjectFormat)
 	}
 
-	signingCertificate := etree.Element{
-		Space: Prefix,
-		Tag:   SigningCertificateTag,
-		Child: []etree.Token{&cert},
+	if ctx.PropertiesContext.AllDataObjectsTimeStamp != nil {
+		allDataObjectsTimeStamp, err := createAllDataObjectsTimeStamp(goCtx, data, dataCanonicalized, ctx)
+		if err != nil {
+			return nil, err
+		}
+		signedDataObjectProperties.AddChild(allDataObjectsTimeStamp)
 	}
 
-	signingTime := etree.Element{
-		Space: Prefix,
-		Tag:   SigningTimeTag,
+	if ctx.PropertiesContext.IndividualDataObjectsTimeStamp != nil {
+		individualDataObjectsTimeStamp, err := createIndividualDataObjectsTimeStamp(goCtx, data, dataCanonicalized, signatureIdPrefix, ctx)
+		if err != nil {
+			return nil, err
+		}
+		signedDataObjectProperties.AddChild(individualDataObjectsTimeStamp)
 	}
-	signingTime.SetText(signTime.Format("2006-01-02T15:04:05Z"))
 
-	signedSignatureProperties := etree.Element{
-		Space: Prefix,
-		Tag:   SignedSignaturePropertiesTag,
-		Child: []etree.Token{&signingTime, &signingCertificate},
+	if len(signedDataObjectProperties.Child) == 0 {
+		return nil, nil
 	}
+	return &signedDataObjectProperties, nil
+}
 
-	signatureIdPrefix, _ := createSignatureIdPrefix(ctx)
+// createDataObjectFormat create xades:DataObjectFormat whose ObjectReference points at the data reference
+func createDataObjectFormat(signatureIdPrefix string, ctx *SigningContext) (*etree.Element, error) {
 
-	signedProperties := etree.Element{
+	format := ctx.PropertiesContext.DataObjectFormat
+	objectReference := "#" + dataReferenceId(signatureIdPrefix, ctx)
+	if format.ObjectReference != "" && format.ObjectReference != objectReference {
+		return nil, fmt.Errorf("xades: DataObjectFormat ObjectReference %q does not match the data reference Id %q", format.ObjectReference, objectReference[1:])
+	}
+	if format.MimeType == "" && format.Description == "" {
+		return nil, errors.New("xades: DataObjectFormat requires MimeType or Description")
+	}
+
+	dataObjectFormat := etree.Element{
 		Space: Prefix,
-		Tag:   SignedPropertiesTag,
+		Tag:   DataObjectFormatTag,
 		Attr: []etree.Attr{
-			{Key: "Id", Value: signatureIdPrefix + "SignedProperties"},
+			{Key: "ObjectReference", Value: objectReference},
 		},
-		Child: []etree.Token{&signedSignatureProperties},
 	}
+	if format.Description != "" {
+		dataObjectFormat.CreateElement(Prefix + ":Description").SetText(format.Description)
+	}
+	if format.MimeType != "" {
+		dataObjectFormat.CreateElement(Prefix + ":MimeType").SetText(format.MimeType)
+	}
+	if format.Encoding != "" {
+		dataObjectFormat.CreateElement(Prefix + ":Encoding").SetText(format.Encoding)
+	}
+	return &dataObjectFormat, nil
+}
+
+// dataReferenceId return Id of the data reference, generated from signatureIdPrefix when a DataObjectFormat or an
+// IndividualDataObjectsTimeStamp must reference it and DataContext.ReferenceID is empty
+func dataReferenceId(signatureIdPrefix string, ctx *SigningContext) string {
+	if ctx.DataContext.ReferenceID != "" || (ctx.PropertiesContext.DataObjectFormat == nil && ctx.PropertiesContext.IndividualDataObjectsTimeStamp == nil) {
+		return ctx.DataContext.ReferenceID
+	}
+	return signatureIdPrefix + "Reference"
+}
+
+// signedPropertiesReferenceType return Type of the SignedProperties reference
+func signedPropertiesReferenceType(ctx *SigningContext) string {
+	if ctx.SignedPropertiesReferenceType != "" {
+		return ctx.SignedPropertiesReferenceType
+	}
+	return SignedPropertiesType
+}
+
+// isSignedPropertiesReference tell whether reference of sig points at its SignedProperties, by the default Type
+// or, for a Type set with SigningContext.SignedPropertiesReferenceType, by the URI
+func isSignedPropertiesReference(reference *etree.Element, sig *etree.Element) bool {
+	if reference.SelectAttrValue("Type", "") == SignedPropertiesType {
+		return true
+	}
+	qualifyingProperties := findQualifyingProperties(sig)
+	if qualifyingProperties == nil {
+		return false
+	}
+	signedProperties := findChild(qualifyingProperties, SignedPropertiesTag)
+	return signedProperties != nil && reference.SelectAttrValue(dsig.URIAttr, "") == "#"+elementId(signedProperties)
+}
+
+// signatureId return Id of ds:Signature, SignatureID or derived from signatureIdPrefix
+func signatureId(signatureIdPrefix string, ctx *SigningContext) string {
+	if ctx.SignatureID != "" {
+		return ctx.SignatureID
+	}
+	return signatureIdPrefix + "Signature"
+}
+
+// signedPropertiesId return Id of xades:SignedProperties, SignedPropertiesID or derived from signatureIdPrefix
+func signedPropertiesId(signatureIdPrefix string, ctx *SigningContext) string {
+	if ctx.SignedPropertiesID != "" {
+		return ctx.SignedPropertiesID
+	}
+	return signatureIdPrefix + "SignedProperties"
+}
+
+// checkIdCollisions return error when two of the Ids given to the elements of the signature are equal
+func checkIdCollisions(signatureIdPrefix string, ctx *SigningContext) error {
+	ids := []struct{ element, id string }{
+		{dsig.SignatureTag, signatureId(signatureIdPrefix, ctx)},
+		{SignedPropertiesTag, signedPropertiesId(signatureIdPrefix, ctx)},
+		{"Object", ctx.ObjectID},
+		{"data " + dsig.ReferenceTag, dataReferenceId(signatureIdPrefix, ctx)},
+		{dsig.SignedInfoTag, ctx.SignedInfoID},
+		{dsig.SignatureValueTag, ctx.SignatureValueID},
+		{dsig.KeyInfoTag, ctx.KeyInfoID},
+		{"SignedProperties " + dsig.ReferenceTag, ctx.SignedPropertiesReferenceID},
+	}
+	for i, a := range ids {
+		for _, b := range ids[i+1:] {
+			if a.id != "" && a.id == b.id {
+				return fmt.Errorf("xades: %v and %v have the same Id %q", a.element, b.element, a.id)
+			}
+		}
+	}
+	return nil
+}
+
+// signatureMethodIdentifier return SignatureMethod algorithm for the key of ctx, ctx.Hash selects the RSA or ECDSA
+// variant unless ctx.Signer or ctx.DsigContext signs
+func signatureMethodIdentifier(ctx *SigningContext) string {
+	if ctx.Signer != nil {
+		return ctx.Signer.SignatureMethod()
+	}
+	if ctx.HMAC != nil {
+		return hmacSignatureMethodIdentifiers[ctx.Hash]
+	}
+	if isEd25519(ctx.KeyStore.signer()) {
+		return ed25519SignatureMethodIdentifier
+	}
+	if isECDSA(ctx.KeyStore.signer()) {
+		return ecdsaSignatureMethodIdentifiers[ctx.Hash]
+	}
+	if ctx.DsigContext != nil {
+		return ctx.DsigContext.GetSignatureMethodIdentifier()
+	}
+	return hashSignatureMethodIdentifier(ctx.Hash)
+}
+
+// checkSignatureKey check that the key of ctx.KeyStore has a SignatureMethod for ctx.Hash: an RSA, ECDSA or
+// Ed25519 key, or another key signed by the SignerFunc registered for the method of ctx.Hash
+func checkSignatureKey(ctx *SigningContext) error {
+	signer := ctx.KeyStore.signer()
+	if ctx.Signer != nil || ctx.HMAC != nil || signer == nil {
+		return nil
+	}
+	switch signer.Public().(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return nil
+	case *ecdsa.PublicKey:
+		if ecdsaSignatureMethodIdentifiers[ctx.Hash] == "" {
+			return fmt.Errorf("xades: no ECDSA SignatureMethod for hash %v", ctx.Hash)
+		}
+		return nil
+	}
+	if registeredSigner(hashSignatureMethodIdentifier(ctx.Hash)) == nil {
+		return fmt.Errorf("xades: no SignatureMethod for a %T key, register a SignerFunc or set SigningContext.Signer", signer.Public())
+	}
+	return nil
+}
+
+// isEd25519 tell whether signer holds an Ed25519 key
+func isEd25519(signer crypto.Signer) bool {
+	if signer == nil {
+		return false
+	}
+	_, ok := signer.Public().(ed25519.PublicKey)
+	return ok
+}
+
+// isECDSA tell whether signer holds an ECDSA key
+func isECDSA(signer crypto.Signer) bool {
+	if signer == nil {
+		return false
+	}
+	_, ok := signer.Public().(*ecdsa.PublicKey)
+	return ok
+}
+
+// ecdsaSignatureValue sign the canonical element with the ECDSA key and return the signature as the raw
+// concatenation of r and s, each left-padded to the size of the curve order, as XML DSig encodes it
+func ecdsaSignatureValue(element *etree.Element, canonicalizer *dsig.Canonicalizer, hash crypto.Hash, key crypto.Signer, rand io.Reader) (string, error) {
+	canonical, err := (*canonicalizer).Canonicalize(element)
+	if err != nil {
+		return "", err
+	}
+	_hash := newHash(hash)
+	if _, err := _hash.Write(canonical); err != nil {
+		return "", err
+	}
+	der, err := key.Sign(rand, _hash.Sum(nil), hash)
+	if err != nil {
+		return "", err
+	}
+	var signature struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &signature); err != nil {
+		return "", fmt.Errorf("xades: parsing the ECDSA signature: %w", err)
+	}
+	size := (key.Public().(*ecdsa.PublicKey).Curve.Params().N.BitLen() + 7) / 8
+	raw := make([]byte, 2*size)
+	signature.R.FillBytes(raw[:size])
+	signature.S.FillBytes(raw[size:])
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// signatureValueWithSignerFunc calculate signature with a registered SignerFunc
+func signatureValueWithSignerFunc(element *etree.Element, canonicalizer *dsig.Canonicalizer, hash crypto.Hash, key crypto.Signer, rand io.Reader, signer SignerFunc) (string, error) {
+	canonical, err := (*canonicalizer).Canonicalize(element)
+	if err != nil {
+		return "", err
+	}
+	buffer, err := signer(key, rand, canonical, hash)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buffer), nil
+}
 
-	return &signedProperties
+// digestAlgorithmURI return DigestMethod algorithm identifier of hash, empty when unregistered
+func digestAlgorithmURI(hash crypto.Hash) string {
+	uri, _ := digestAlgorithmIdentifier(hash)
+	return uri
 }
 
+// signerRand return rand, or crypto/rand when nil
+func signerRand(rand io.Reader) io.Reader {
+	if rand == nil {
+		return cryptorand.Reader
+	}
+	return rand
+}
+
+// createSignatureIdPrefix create prefix of the generated Ids. When UseSignatureUuid is set and SignatureUuid is nil
+// a new UUID is generated on every call, ctx is not modified so parallel signatures get distinct Ids.
 func createSignatureIdPrefix(ctx *SigningContext) (signatureIdPrefix string, err error) {
 	signatureIdPrefix = ""
 	if ctx.UseSignatureUuid {
-		if ctx.SignatureUuid == nil {
-			signatureUuid, uuidErr := uuid.NewUUID()
+		signatureUuid := ctx.SignatureUuid
+		if signatureUuid == nil {
+			generatedUuid, uuidErr := uuid.NewUUID()
 			if uuidErr != nil {
 				err = uuidErr
 				return
 			}
-			ctx.SignatureUuid = &signatureUuid
-
+			signatureUuid = &generatedUuid
 		}
-		signatureIdPrefix = fmt.Sprintf("Signature-%v-", ctx.SignatureUuid.String())
+		signatureIdPrefix = fmt.Sprintf("Signature-%v-", signatureUuid.String())
 	}
 	return
 }
@@ -1,12 +1,30 @@
 package xades
 
 import (
+	"bytes"
 	"crypto"
-	"crypto/sha1"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/pem"
+	"errors"
+	"flag"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -73,6 +91,8 @@ var (
 	testKeyStore *MemoryX509KeyStore
 )
 
+var update = flag.Bool("update", false, "update golden files in testdata")
+
 func getTestKeyStore() (*MemoryX509KeyStore, error) {
 
 	if testKeyStore != nil {
@@ -127,7 +147,7 @@ func getSigningContextMap(t *testing.T) (ctxMap map[*SigningContext]string) {
 		KeyStore:         *keyStore,
 		UseSignatureUuid: false,
 	}
-	ctxMap[ctx] = "qCBQF0f51nnIa44jR89dgE2KBhnrkq41i0YFYtpIDXQFpzoFubuWLuHbEeP1V8KTImkWkSWzsg2h8sdVaZ7r7E6ABZKyCC4u12aHI/Tzq0yuNP9/VkdIzkKOLRbzPfjQVSZWGjkpOnwA5Q2HsN579oqQovrTikJ+W5At9ux79SOLNmZJFZp5QMC2Hn1fWoBWdXnuwAFLLqhspVpPRZq9qXeVcxwtbWN+Z9KYEt96NLWCgHYAxqrNauN4IJ+dpYPOo3w1NHucsb78PvWCGHlfmBYOgAzGkfqTJ/fqfbBTxeYBWBJKVYvJjlMivLh3Ss/dHSJEvU6pRFLUFXf9D9KHnQ=="
+	ctxMap[ctx] = "jIlM1qagNw82BC8I6xtRnj03L9QeX+hhOeebaEGaU3TfKAjccMlc6ZppgbgMYHXWNVKpk4boBh5nkt9MjYBXTixi9t5gVG7JeAgi2zk67qLwhSkvjfTTsmluw0/zpIkDpUS9lc08p32pcnlZIEPQr4U66W/b26gWGFkSvrKf+MZwliagksDNRo8buXiYDh/BcWhb+IpPB/JEhxzwetT7UHgZ3G0EhnQaZmcgW2kS2bNXnuj2zTjUJIC0vjYBJ+g04kSl/Cq2d5plAQOaM0KsZSjqNtNQGKufcQ74qIuGUJN56acQye7417oFnOWy4HMnXrNkMFLqNSook0tOGpWYqw=="
 
 	ctx = &SigningContext{
 		DataContext: SignedDataContext{
@@ -180,7 +200,7 @@ func getSigningContextNamespacePrefixMap(t *testing.T) (ctxMap map[*SigningConte
 		XmlDsigPrefix:    "ds",
 		UseSignatureUuid: false,
 	}
-	ctxMap[ctx] = "lFQkrk5ZfFxGoIkUR2XMWwFbGhv4n6oLw+/KIUM+JcEnVM8ebr47d7lpM2vviBa5zCR/IgK3nB/CIjPcgA0v5KILKp0K9M7PNL5IikxDVu7l1PVcAUaQG7NhMrwNTiY6g5EhLCIkv04q1jTXWCaCyYdRf1IMpgc1LN6v2CfRIl3xfOqUY/cBsp8jRP8LTtU5H7OeNjVmRjrCyUmKgfTnNJOG0oxhadzqs4/MIJgMoz5090k4NXFRM+JW/g/adXMa45kNcLhkyXEH/co/wRN4UsR9Se/X+gh1bFDhOiqyyzveOKCxWACJR8+vF1ao5LWy+kWGkzUCEg81ouqxqWYgOw=="
+	ctxMap[ctx] = "h64SfEsoEV96QAGy7DBrh/dFHX9Q9ndB36DNhX4MD9s0KojA4BhEqZpO4/QiNITzWe0aGUshE01+iXEnWEA/dBtl/cTH+d99dHAsOcTy/mHr8RpPLUgx18TpuRtfZZ0i4W6K72CnTIqGD6kkWYrRTmk1qmqiu7smsiDVIX6rFNvrlUIPNj8PSSxWms4BYQdfHkTwWN1qCYRoaYE2lLztj242Y2mHhRGJPv65tYyF9+BY/U5v9D3dnTLikEgv9Of8b8H0bUMUPfaZiGsebaHC6YxwB5TtHeBB07gf+uQklwZ4ypn6719F+bFZFddG5ZQC+LnoIdusrzgDuwtSvU6C/g=="
 
 	ctx = &SigningContext{
 		DataContext: SignedDataContext{
@@ -239,7 +259,7 @@ func getSigningContextUuidMap(t *testing.T) (ctxMap map[*SigningContext]string)
 		SignatureUuid:    &signatureUuid,
 	}
 
-	ctxMap[ctx] = "OQzb6KWH5C7++JSqZsuMGf4RAg31hHawGbl6jXbOzUhNutJDxEYKuW6CzhdWAzsPNb04i+Ui+2FKcgJ4yVmPJffgLyVwjVonXTn/T0v22wGgCn8mSj+nVXeD1wodQ50LA/UVaOTOVWMr4TTDRyB+JuInq2zB5MzLNTebesilK+1nl0ou4t0LmzQOCAoKcIriGFAS7vM+wqFxVgyuxNclXmyMOuVZ1qn2hU55MWtjYNp8Ak3wmepXHDUCtwcaOs7TnuAwprBc6ZeODY93gbDfORyZXwTqr1ShOgjcFNu6RcucGFrX4Y54GGSUzq7YAHtU/fGj6D43dkslaUF5MYcSgg=="
+	ctxMap[ctx] = "0vitGgDS+FBQnZcWTANZ1TnJRsr6V3bUKmQpQLkcWmg6NnB89lBBuAlmpo2K+ZqBgHTgyvmCOCMa+1HomHs+QsaZWObMbOfLuVE27ltOgUuN8+gfkwo0+7sE46lTLTE3dnjXOZx8jQ1v2hPE45O+a7th1SgHgOBv6Yox+kT2J+f1nKhxiSzk65ETR5aspJ8byqUZ0EJVEBtLsJ2Pia5isoY0TXqb6o7ssLYyArgrAofzlF/ti68hY/Q1X0H08yQ9bDjb8qaH6L8adRpbPc9pNNRu6p4XGAzkruB50vMdNuBZRbfhcRbrmDCWXyFVPM4rWN4/N1msXb4tSAdAnWYAWg=="
 
 	return
 }
@@ -460,12 +480,13 @@ func testObject(t *testing.T, keyInfo *etree.Element, ctx *SigningContext) {
 	require.NotEmpty(t, digestMethod)
 	algorithmAttr := digestMethod.SelectAttr(":" + dsig.AlgorithmAttr)
 	require.NotEmpty(t, algorithmAttr)
-	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA1], algorithmAttr.Value)
+	require.Equal(t, digestAlgorithmIdentifiers[certDigestHash(ctx)], algorithmAttr.Value)
 
 	digestValue := certDigest.FindElement(xmldsigPrefix + ":" + dsig.DigestValueTag)
 	require.NotEmpty(t, digestValue)
-	hash := sha1.Sum(ctx.KeyStore.CertBinary)
-	require.Equal(t, base64.StdEncoding.EncodeToString(hash[0:]), digestValue.Text())
+	hash := certDigestHash(ctx).New()
+	hash.Write(ctx.KeyStore.CertBinary)
+	require.Equal(t, base64.StdEncoding.EncodeToString(hash.Sum(nil)), digestValue.Text())
 
 	issuerSerial := cert.FindElement(Prefix + ":" + IssuerSerialTag)
 	require.NotEmpty(t, issuerSerial)
@@ -488,3 +509,1282 @@ func testSignatureValue(t *testing.T, signedData *etree.Element, ctx *SigningCon
 	require.NotEmpty(t, signatureValue)
 	require.Equal(t, expectedValue, signatureValue.Text())
 }
+
+func newTestSigningContext(t testing.TB) *SigningContext {
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+
+	signingTime, err := time.Parse("2006-01-02T15:04:05Z", "2020-01-01T00:00:00Z")
+	require.NoError(t, err)
+
+	c14N10ExclusiveCanonicalizer := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	return &SigningContext{
+		DataContext: SignedDataContext{
+			Canonicalizer: c14N10ExclusiveCanonicalizer,
+			Hash:          crypto.SHA256,
+			IsEnveloped:   true,
+			ReferenceURI:  "#signedData",
+		},
+		PropertiesContext: SignedPropertiesContext{
+			Canonicalizer: c14N10ExclusiveCanonicalizer,
+			Hash:          crypto.SHA256,
+			SigninigTime:  signingTime,
+		},
+		Canonicalizer: c14N10ExclusiveCanonicalizer,
+		Hash:          crypto.SHA256,
+		KeyStore:      *keyStore,
+		XmlDsigPrefix: "ds",
+	}
+}
+
+func newTestSignedData(t *testing.T) *etree.Element {
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(testXML)
+	require.NoError(t, err)
+	return doc.Root()
+}
+
+func TestKeyInfoKeyValue(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.KeyInfoContext.IncludeKeyValue = true
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	keyInfo := signature.FindElement("ds:" + dsig.KeyInfoTag)
+	require.NotEmpty(t, keyInfo)
+	require.NotEmpty(t, keyInfo.FindElement("ds:"+dsig.X509DataTag))
+
+	publicKey := ctx.KeyStore.PrivateKey.PublicKey
+	modulus := keyInfo.FindElement("ds:" + keyValueTag + "/ds:" + rsaKeyValueTag + "/ds:" + modulusTag)
+	require.NotEmpty(t, modulus)
+	modulusBytes, err := base64.StdEncoding.DecodeString(modulus.Text())
+	require.NoError(t, err)
+	require.NotEqual(t, byte(0), modulusBytes[0])
+	require.Equal(t, publicKey.N.Bytes(), modulusBytes)
+
+	exponent := keyInfo.FindElement("ds:" + keyValueTag + "/ds:" + rsaKeyValueTag + "/ds:" + exponentTag)
+	require.NotEmpty(t, exponent)
+	require.Equal(t, "AQAB", exponent.Text())
+
+	ctx.KeyInfoContext.OmitX509Data = true
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	keyInfo = signature.FindElement("ds:" + dsig.KeyInfoTag)
+	require.NotEmpty(t, keyInfo.FindElement("ds:"+keyValueTag))
+	require.Nil(t, keyInfo.FindElement("ds:"+dsig.X509DataTag))
+
+	ctx.KeyInfoContext.IncludeKeyValue = false
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+}
+
+func TestKeyInfoKeyName(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	ctx.KeyInfoContext.KeyName = "invoicing-2024"
+
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	children := signature.FindElement("ds:" + dsig.KeyInfoTag).ChildElements()
+	require.Len(t, children, 2)
+	require.Equal(t, "KeyName", children[0].Tag)
+	require.Equal(t, "invoicing-2024", children[0].Text())
+	require.Equal(t, dsig.X509DataTag, children[1].Tag)
+
+	ctx.KeyInfoContext.OmitX509Data = true
+	root, signature := signAndReparse(t, testXML, ctx)
+	children = signature.FindElement("ds:" + dsig.KeyInfoTag).ChildElements()
+	require.Len(t, children, 1)
+	require.Equal(t, "KeyName", children[0].Tag)
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.Error(t, err)
+	_, err = (&VerifyContext{TrustedCert: ctx.KeyStore.Cert}).Verify(signature, root)
+	require.NoError(t, err)
+}
+
+func TestKeyInfoIssuerSerialAndSubjectName(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.KeyInfoContext.IncludeX509IssuerSerial = true
+	ctx.KeyInfoContext.IncludeX509SubjectName = true
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	x509Data := signature.FindElement("ds:" + dsig.KeyInfoTag + "/ds:" + dsig.X509DataTag)
+	require.NotEmpty(t, x509Data)
+
+	children := x509Data.ChildElements()
+	require.Len(t, children, 3)
+	require.Equal(t, x509IssuerSerialTag, children[0].Tag)
+	require.Equal(t, x509SubjectNameTag, children[1].Tag)
+	require.Equal(t, dsig.X509CertificateTag, children[2].Tag)
+
+	require.Equal(t, ctx.KeyStore.Cert.Issuer.String(), children[0].FindElement("ds:"+x509IssuerNameTag).Text())
+	require.Equal(t, ctx.KeyStore.Cert.SerialNumber.String(), children[0].FindElement("ds:"+x509SerialNumberTag).Text())
+	require.Equal(t, ctx.KeyStore.Cert.Subject.String(), children[1].Text())
+}
+
+// newTestKeyStoreFromTemplate issues a self-signed certificate for the test key from template
+func newTestKeyStoreFromTemplate(t *testing.T, template *x509.Certificate) *MemoryX509KeyStore {
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(1)
+	}
+	if template.Subject.CommonName == "" {
+		template.Subject = pkix.Name{CommonName: "Test certificate"}
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		template.NotAfter = time.Date(3020, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if template.KeyUsage == 0 {
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &keyStore.PrivateKey.PublicKey, keyStore.PrivateKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &MemoryX509KeyStore{
+		PrivateKey: keyStore.PrivateKey,
+		Cert:       cert,
+		CertBinary: der,
+	}
+}
+
+func TestKeyInfoX509SKI(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.KeyInfoContext.IncludeX509SKI = true
+	_, err := CreateSignature(signedData, ctx)
+	require.Error(t, err)
+
+	subjectKeyId := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a}
+	ctx.KeyStore = *newTestKeyStoreFromTemplate(t, &x509.Certificate{SubjectKeyId: subjectKeyId})
+	ctx.KeyInfoContext.OmitX509Certificate = true
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	x509Data := signature.FindElement("ds:" + dsig.KeyInfoTag + "/ds:" + dsig.X509DataTag)
+	require.NotEmpty(t, x509Data)
+	children := x509Data.ChildElements()
+	require.Len(t, children, 1)
+	require.Equal(t, x509SKITag, children[0].Tag)
+	require.Equal(t, base64.StdEncoding.EncodeToString(subjectKeyId), children[0].Text())
+
+	ctx.KeyInfoContext.IncludeX509SKI = false
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+}
+
+func TestSignatureGolden(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	signatureUuid, err := uuid.Parse("7837510c-674b-11ee-90e3-000c29c302a8")
+	require.NoError(t, err)
+
+	ctx := newTestSigningContext(t)
+	ctx.UseSignatureUuid = true
+	ctx.SignatureUuid = &signatureUuid
+	ctx.Rand = bytes.NewReader(make([]byte, 1024))
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	doc := etree.NewDocument()
+	doc.SetRoot(signature)
+	actual, err := doc.WriteToBytes()
+	require.NoError(t, err)
+
+	golden := filepath.Join("testdata", "signature.golden")
+	if *update {
+		require.NoError(t, ioutil.WriteFile(golden, actual, 0644))
+	}
+	expected, err := ioutil.ReadFile(golden)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(actual))
+}
+
+func TestReferenceURIMismatch(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.ReferenceURI = "#otherData"
+	_, err := CreateSignature(signedData, ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "#otherData")
+
+	doc := etree.NewDocument()
+	err = doc.ReadFromString(`<root Id="rootData"><child/></root>`)
+	require.NoError(t, err)
+	ctx.DataContext.ReferenceURI = "#rootData"
+	// the digest of child would not cover the rest of the element the URI selects
+	_, err = CreateSignature(doc.Root().SelectElement("child"), ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "#rootData")
+	_, err = CreateSignature(doc.Root(), ctx)
+	require.NoError(t, err)
+
+	ctx.DataContext.IsEnveloped = false
+	ctx.DataContext.ReferenceURI = "#detachedData"
+	_, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+}
+
+func TestCertDigestHash(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.Hash = crypto.SHA512
+	ctx.CertDigestHash = crypto.SHA256
+
+	testSignature(t, signedData, ctx)
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	certDigestPath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag +
+		"/" + Prefix + ":" + SignedSignaturePropertiesTag + "/" + Prefix + ":" + SigningCertificateTag + "/" + Prefix + ":" + CertTag + "/" + Prefix + ":" + CertDigestTag
+	certDigest := signature.FindElement(certDigestPath)
+	require.NotEmpty(t, certDigest)
+	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA256], certDigest.FindElement("ds:"+dsig.DigestMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	reference := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)[1]
+	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA512], reference.FindElement("ds:"+dsig.DigestMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	ctx.CertDigestHash = 0
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA512], signature.FindElement(certDigestPath+"/ds:"+dsig.DigestMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+}
+
+func TestDigestHashMatrix(t *testing.T) {
+	hashes := []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+	certDigestPath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag + "/" + Prefix + ":" + SignedSignaturePropertiesTag +
+		"/" + Prefix + ":" + SigningCertificateTag + "/" + Prefix + ":" + CertTag + "/" + Prefix + ":" + CertDigestTag + "/ds:" + dsig.DigestMethodTag
+
+	for _, dataHash := range hashes {
+		for _, propertiesHash := range hashes {
+			for _, certHash := range hashes {
+				ctx := newTestSigningContext(t)
+				ctx.DataContext.Hash = dataHash
+				ctx.PropertiesContext.Hash = propertiesHash
+				ctx.CertDigestHash = certHash
+				name := fmt.Sprintf("data %v, properties %v, cert %v", dataHash, propertiesHash, certHash)
+
+				root, signature := signAndReparse(t, testXML, ctx)
+				references := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+				require.Equal(t, digestAlgorithmIdentifiers[dataHash], references[0].SelectElement("ds:"+dsig.DigestMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""), name)
+				require.Equal(t, digestAlgorithmIdentifiers[propertiesHash], references[1].SelectElement("ds:"+dsig.DigestMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""), name)
+				require.Equal(t, digestAlgorithmIdentifiers[certHash], signature.FindElement(certDigestPath).SelectAttrValue(dsig.AlgorithmAttr, ""), name)
+				require.Equal(t, signatureMethodIdentifiers[crypto.SHA256], signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""), name)
+
+				_, err := (&VerifyContext{}).Verify(signature, root)
+				require.NoError(t, err, name)
+			}
+		}
+	}
+
+	ctx := newTestSigningContext(t)
+	ctx.Hash = crypto.SHA384
+	root, signature := signAndReparse(t, testXML, ctx)
+	require.Equal(t, signatureMethodIdentifiers[crypto.SHA384], signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+	_, err := (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+}
+
+func TestInclusiveNamespaces(t *testing.T) {
+	const prefixedXML = `<a:root xmlns:a="urn:a" xmlns:b="urn:b" Id="prefixedData"><a:child/></a:root>`
+
+	digest := func(prefixList string) string {
+		doc := etree.NewDocument()
+		require.NoError(t, doc.ReadFromString(prefixedXML))
+		canonicalizer := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(prefixList)
+		digestValue, err := DigestValue(doc.Root(), &canonicalizer, crypto.SHA256)
+		require.NoError(t, err)
+		return digestValue
+	}
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(prefixedXML))
+
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.ReferenceURI = "#prefixedData"
+	ctx.DataContext.InclusiveNamespaces = "b"
+	ctx.PropertiesContext.InclusiveNamespaces = "xades"
+	ctx.InclusiveNamespaces = "ds"
+
+	signature, err := CreateSignature(doc.Root(), ctx)
+	require.NoError(t, err)
+
+	references := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Len(t, references, 2)
+	require.Equal(t, digest("b"), references[0].FindElement("ds:"+dsig.DigestValueTag).Text())
+	require.NotEqual(t, digest(""), digest("b"))
+
+	for _, test := range []struct {
+		path       string
+		prefixList string
+	}{
+		{"ds:" + dsig.SignedInfoTag + "/ds:" + dsig.CanonicalizationMethodTag, "ds"},
+		{"ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "[1]/ds:" + dsig.TransformsTag + "/ds:" + dsig.TransformTag + "[2]", "b"},
+		{"ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "[2]/ds:" + dsig.TransformsTag + "/ds:" + dsig.TransformTag, "xades"},
+	} {
+		inclusiveNamespaces := signature.FindElement(test.path + "/ec:" + dsig.InclusiveNamespacesTag)
+		require.NotEmpty(t, inclusiveNamespaces, test.path)
+		require.Equal(t, test.prefixList, inclusiveNamespaces.SelectAttrValue(dsig.PrefixListAttr, ""))
+		require.Equal(t, dsig.CanonicalXML10ExclusiveAlgorithmId.String(), inclusiveNamespaces.SelectAttrValue("xmlns:ec", ""))
+	}
+
+	ctx.DataContext.Canonicalizer = dsig.MakeC14N11Canonicalizer()
+	_, err = CreateSignature(doc.Root(), ctx)
+	require.Error(t, err)
+}
+
+func TestDigestBytes(t *testing.T) {
+	data := []byte("%PDF-1.4 binary content")
+
+	hash := crypto.SHA256.New()
+	hash.Write(data)
+	require.Equal(t, base64.StdEncoding.EncodeToString(hash.Sum(nil)), DigestBytes(data, crypto.SHA256))
+
+	element := etree.NewElement("data")
+	element.SetText("text")
+	canonicalizer := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	digestValue, err := DigestValue(element.Copy(), &canonicalizer, crypto.SHA256)
+	require.NoError(t, err)
+	require.Equal(t, DigestBytes([]byte("<data>text</data>"), crypto.SHA256), digestValue)
+}
+
+func TestDigestValueWithHashFunc(t *testing.T) {
+	// FNV-1a stands in for a national digest algorithm without a crypto.Hash
+	const fnvURI = "urn:example:digest:fnv128a"
+	element := etree.NewElement("data")
+	element.SetText("text")
+	canonicalizer := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	digestMethod, digestValue, err := DigestValueWithHashFunc(element.Copy(), &canonicalizer, fnv.New128a, fnvURI, "ds")
+	require.NoError(t, err)
+	require.Equal(t, "ds:"+dsig.DigestMethodTag, digestMethod.FullTag())
+	require.Equal(t, fnvURI, digestMethod.SelectAttrValue(dsig.AlgorithmAttr, ""))
+	expected := fnv.New128a()
+	expected.Write([]byte("<data>text</data>"))
+	require.Equal(t, "ds:"+dsig.DigestValueTag, digestValue.FullTag())
+	require.Equal(t, base64.StdEncoding.EncodeToString(expected.Sum(nil)), digestValue.Text())
+
+	// the sha256 constructor matches DigestValue
+	_, digestValue, err = DigestValueWithHashFunc(element.Copy(), &canonicalizer, sha256.New, digestAlgorithmURI(crypto.SHA256), "ds")
+	require.NoError(t, err)
+	sha256Digest, err := DigestValue(element.Copy(), &canonicalizer, crypto.SHA256)
+	require.NoError(t, err)
+	require.Equal(t, sha256Digest, digestValue.Text())
+
+	_, _, err = DigestValueWithHashFunc(element.Copy(), &canonicalizer, fnv.New128a, "", "ds")
+	require.Error(t, err)
+}
+
+func TestDigestBytesEncodings(t *testing.T) {
+	// SHA-256 of "abc", FIPS 180-2 appendix B.1
+	data := []byte("abc")
+	require.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", DigestBytesHex(data, crypto.SHA256))
+	require.Equal(t, "ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0", DigestBytesBase64URL(data, crypto.SHA256))
+	require.Equal(t, "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=", DigestBytes(data, crypto.SHA256))
+}
+
+func TestDigestReader(t *testing.T) {
+	element := newTestSignedData(t)
+	canonicalizer := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	canonical, err := canonicalizer.Canonicalize(element.Copy())
+	require.NoError(t, err)
+
+	expected, err := DigestValue(element.Copy(), &canonicalizer, crypto.SHA256)
+	require.NoError(t, err)
+	digestValue, err := DigestReader(bytes.NewReader(canonical), crypto.SHA256)
+	require.NoError(t, err)
+	require.Equal(t, expected, digestValue)
+
+	_, err = DigestReader(failingReader{}, crypto.SHA256)
+	require.Error(t, err)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+// repeatReader yield pattern over and over without holding more than pattern in memory
+type repeatReader struct {
+	pattern []byte
+	offset  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.pattern[r.offset:])
+		n += copied
+		r.offset = (r.offset + copied) % len(r.pattern)
+	}
+	return n, nil
+}
+
+// BenchmarkDigestReader allocations per operation stay the same whatever the size of the input
+func BenchmarkDigestReader(b *testing.B) {
+	for _, size := range []int64{1 << 20, 64 << 20, 256 << 20} {
+		b.Run(fmt.Sprintf("%dMiB", size>>20), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				r := io.LimitReader(&repeatReader{pattern: []byte("<item>canonical data</item>")}, size)
+				if _, err := DigestReader(r, crypto.SHA256); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSignatureValueBytes(t *testing.T) {
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+
+	data := []byte("%PDF-1.4 binary content")
+	signatureValue, err := SignatureValueBytes(data, crypto.SHA256, keyStore)
+	require.NoError(t, err)
+
+	signature, err := base64.StdEncoding.DecodeString(signatureValue)
+	require.NoError(t, err)
+	digest := sha256.Sum256(data)
+	require.NoError(t, rsa.VerifyPKCS1v15(&keyStore.PrivateKey.PublicKey, crypto.SHA256, digest[:], signature))
+}
+
+func TestDefaultCanonicalizer(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	expected, err := CreateSignature(signedData, newTestSigningContext(t))
+	require.NoError(t, err)
+
+	ctx := newTestSigningContext(t)
+	ctx.Canonicalizer = nil
+	ctx.DataContext.Canonicalizer = nil
+	ctx.PropertiesContext.Canonicalizer = nil
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.Nil(t, ctx.Canonicalizer)
+
+	require.Equal(t, expected.FindElement("ds:"+dsig.SignatureValueTag).Text(), signature.FindElement("ds:"+dsig.SignatureValueTag).Text())
+}
+
+func TestReferenceID(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Nil(t, reference.SelectAttr("Id"))
+
+	ctx.DataContext.ReferenceID = "dataReference"
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	reference = signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Equal(t, "dataReference", reference.SelectAttrValue("Id", ""))
+	require.Equal(t, "#signedData", reference.SelectAttrValue(dsig.URIAttr, ""))
+	require.NotNil(t, signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.ReferenceTag+"[@Id='dataReference']"))
+}
+
+func TestBase64LineWidth(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	expected, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	ctx.Base64LineWidth = 64
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	for _, path := range []string{"ds:" + dsig.SignatureValueTag, "ds:" + dsig.KeyInfoTag + "/ds:" + dsig.X509DataTag + "/ds:" + dsig.X509CertificateTag} {
+		wrapped := signature.FindElement(path).Text()
+		lines := strings.Split(wrapped, "\n")
+		require.True(t, len(lines) > 1, path)
+		for _, line := range lines[:len(lines)-1] {
+			require.Len(t, line, 64)
+		}
+		require.Equal(t, expected.FindElement(path).Text(), strings.Join(lines, ""))
+
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+		require.NoError(t, err)
+		require.NotEmpty(t, decoded)
+	}
+
+	signedInfoPath := "ds:" + dsig.SignedInfoTag
+	canonicalExpected, err := canonicalizeInContext(ctx.Canonicalizer, expected.FindElement(signedInfoPath))
+	require.NoError(t, err)
+	canonical, err := canonicalizeInContext(ctx.Canonicalizer, signature.FindElement(signedInfoPath))
+	require.NoError(t, err)
+	require.Equal(t, canonicalExpected, canonical)
+
+	require.Equal(t, "abcd\nef", wrapBase64("abcdef", 4))
+	require.Equal(t, "abcd", wrapBase64("abcd", 4))
+	require.Equal(t, "abcdef", wrapBase64("abcdef", 0))
+}
+
+func TestConcurrentSignatures(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+	ctx.UseSignatureUuid = true
+
+	const count = 8
+	signatures := make([]*etree.Element, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			signatures[i], errs[i] = CreateSignature(signedData, ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Nil(t, ctx.SignatureUuid)
+	ids := map[string]bool{}
+	for i := 0; i < count; i++ {
+		require.NoError(t, errs[i])
+		id := signatures[i].SelectAttrValue("Id", "")
+		require.False(t, ids[id], "duplicate signature Id %v", id)
+		ids[id] = true
+	}
+}
+
+func TestOverrideIds(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.UseSignatureUuid = true
+	ctx.SignatureID = "SIG0001"
+	ctx.SignedPropertiesID = "SIGPROP0001"
+	ctx.ObjectID = "OBJ0001"
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+
+	require.Equal(t, "SIG0001", signature.SelectAttrValue("Id", ""))
+	object := signature.SelectElement("ds:Object")
+	require.Equal(t, "OBJ0001", object.SelectAttrValue("Id", ""))
+	qualifyingProperties := object.SelectElement(Prefix + ":" + QualifyingPropertiesTag)
+	require.Equal(t, "#SIG0001", qualifyingProperties.SelectAttrValue(targetAttr, ""))
+	require.Equal(t, "SIGPROP0001", qualifyingProperties.SelectElement(Prefix+":"+SignedPropertiesTag).SelectAttrValue("Id", ""))
+	references := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Equal(t, "#SIGPROP0001", references[1].SelectAttrValue(dsig.URIAttr, ""))
+
+	ctx.SignatureID = ""
+	ctx.ObjectID = ""
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(signature.SelectAttrValue("Id", ""), "Signature-"))
+	require.Nil(t, signature.SelectElement("ds:Object").SelectAttr("Id"))
+
+	ctx.ObjectID = "SIGPROP0001"
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SIGPROP0001")
+
+	ctx.ObjectID = "OBJ0001"
+	ctx.SignatureID = "OBJ0001"
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+}
+
+func TestKeyStoreValidate(t *testing.T) {
+	signingTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	keyStore := newTestKeyStoreFromTemplate(t, &x509.Certificate{})
+	require.NoError(t, keyStore.Validate(signingTime))
+
+	keyStore = newTestKeyStoreFromTemplate(t, &x509.Certificate{KeyUsage: x509.KeyUsageContentCommitment})
+	require.NoError(t, keyStore.Validate(signingTime))
+
+	keyStore = newTestKeyStoreFromTemplate(t, &x509.Certificate{KeyUsage: x509.KeyUsageKeyEncipherment})
+	err := keyStore.Validate(signingTime)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "digitalSignature")
+
+	keyStore = newTestKeyStoreFromTemplate(t, &x509.Certificate{
+		NotBefore: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	err = keyStore.Validate(signingTime)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "validity period")
+	require.NoError(t, keyStore.Validate(time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestEd25519Signature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Ed25519 test certificate"},
+		NotBefore:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(3020, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, privateKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ctx := newTestSigningContext(t)
+	ctx.KeyStore = MemoryX509KeyStore{
+		Signer:     privateKey,
+		Cert:       cert,
+		CertBinary: der,
+	}
+
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+
+	signedInfo := signature.SelectElement("ds:" + dsig.SignedInfoTag)
+	require.Equal(t, ed25519SignatureMethodIdentifier, signedInfo.SelectElement("ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	canonical, err := canonicalizeInContext(ctx.Canonicalizer, signedInfo)
+	require.NoError(t, err)
+	signatureValue, err := base64.StdEncoding.DecodeString(signature.SelectElement("ds:" + dsig.SignatureValueTag).Text())
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(publicKey, canonical, signatureValue))
+}
+
+func TestECDSASignature(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ECDSA test certificate"},
+		NotBefore:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(3020, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, privateKey.Public(), privateKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ctx := newTestSigningContext(t)
+	ctx.KeyStore = MemoryX509KeyStore{
+		Signer:     privateKey,
+		Cert:       cert,
+		CertBinary: der,
+	}
+
+	root, signature := signAndReparse(t, testXML, ctx)
+	signedInfo := signature.SelectElement("ds:" + dsig.SignedInfoTag)
+	require.Equal(t, "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256", signedInfo.SelectElement("ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+	signatureValue, err := base64.StdEncoding.DecodeString(signature.SelectElement("ds:" + dsig.SignatureValueTag).Text())
+	require.NoError(t, err)
+	require.Len(t, signatureValue, 96)
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+
+	signatureValue[0] ^= 0xff
+	signature.SelectElement("ds:" + dsig.SignatureValueTag).SetText(base64.StdEncoding.EncodeToString(signatureValue))
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.Error(t, err)
+
+	ctx.KeyStore.Signer = unsupportedSigner{privateKey}
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no SignatureMethod")
+}
+
+// unsupportedSigner signs with a key whose public key type has no SignatureMethod
+type unsupportedSigner struct {
+	crypto.Signer
+}
+
+func (unsupportedSigner) Public() crypto.PublicKey {
+	return "unsupported"
+}
+
+func TestKeyStoreSigner(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	expected, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	ctx.KeyStore.Signer = ctx.KeyStore.PrivateKey
+	ctx.KeyStore.PrivateKey = nil
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.Equal(t, expected.SelectElement("ds:"+dsig.SignatureValueTag).Text(), signature.SelectElement("ds:"+dsig.SignatureValueTag).Text())
+}
+
+func TestOmitSigningTime(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.OmitSigningTime = true
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+
+	signedPropertiesPath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag
+	signedSignatureProperties := signature.FindElement(signedPropertiesPath + "/" + Prefix + ":" + SignedSignaturePropertiesTag)
+	require.Nil(t, signedSignatureProperties.SelectElement(Prefix+":"+SigningTimeTag))
+	require.NotNil(t, signedSignatureProperties.SelectElement(Prefix+":"+SigningCertificateTag))
+
+	canonical, err := canonicalizeInContext(ctx.PropertiesContext.Canonicalizer, signature.FindElement(signedPropertiesPath))
+	require.NoError(t, err)
+	reference := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)[1]
+	require.Equal(t, DigestBytes(canonical, ctx.PropertiesContext.Hash), reference.SelectElement("ds:"+dsig.DigestValueTag).Text())
+}
+
+func TestSigningCertificateV2(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.UseSigningCertificateV2 = true
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+
+	signedSignaturePropertiesPath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag + "/" + Prefix + ":" + SignedSignaturePropertiesTag
+	signedSignatureProperties := signature.FindElement(signedSignaturePropertiesPath)
+	require.Nil(t, signedSignatureProperties.SelectElement(Prefix+":"+SigningCertificateTag))
+	cert := signedSignatureProperties.FindElement(Prefix + ":" + SigningCertificateV2Tag + "/" + Prefix + ":" + CertTag)
+	require.NotNil(t, cert)
+	require.NotNil(t, cert.SelectElement(Prefix+":"+CertDigestTag))
+	require.Nil(t, cert.SelectElement(Prefix+":"+IssuerSerialTag))
+
+	der, err := base64.StdEncoding.DecodeString(cert.SelectElement(Prefix + ":" + IssuerSerialV2Tag).Text())
+	require.NoError(t, err)
+	var decoded issuerSerial
+	rest, err := asn1.Unmarshal(der, &decoded)
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Equal(t, 0, decoded.SerialNumber.Cmp(ctx.KeyStore.Cert.SerialNumber))
+	require.Len(t, decoded.Issuer, 1)
+	require.Equal(t, 4, decoded.Issuer[0].Tag)
+	require.Equal(t, ctx.KeyStore.Cert.RawIssuer, decoded.Issuer[0].Bytes)
+
+	require.NoError(t, VerifySigningCertificate(signature, ctx.KeyStore.Cert))
+
+	ctx.PropertiesContext.UseSigningCertificateV2 = false
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	signedSignatureProperties = signature.FindElement(signedSignaturePropertiesPath)
+	require.Nil(t, signedSignatureProperties.SelectElement(Prefix+":"+SigningCertificateV2Tag))
+	require.NotNil(t, signedSignatureProperties.FindElement(Prefix+":"+SigningCertificateTag+"/"+Prefix+":"+CertTag+"/"+Prefix+":"+IssuerSerialTag))
+}
+
+func TestDsigContext(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	dsigCtx, err := dsig.NewSigningContext(ctx.KeyStore.PrivateKey, [][]byte{ctx.KeyStore.CertBinary})
+	require.NoError(t, err)
+	dsigCtx.Hash = crypto.SHA512
+	ctx.DsigContext = dsigCtx
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	signedInfo := signature.SelectElement("ds:" + dsig.SignedInfoTag)
+	require.Equal(t, signatureMethodIdentifiers[crypto.SHA512], signedInfo.SelectElement("ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	canonical, err := canonicalizeInContext(ctx.Canonicalizer, signedInfo)
+	require.NoError(t, err)
+	signatureValue, err := base64.StdEncoding.DecodeString(signature.SelectElement("ds:" + dsig.SignatureValueTag).Text())
+	require.NoError(t, err)
+	digest := sha512.Sum512(canonical)
+	require.NoError(t, rsa.VerifyPKCS1v15(&ctx.KeyStore.PrivateKey.PublicKey, crypto.SHA512, digest[:], signatureValue))
+}
+
+func TestSignedPropertiesReferenceType(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	ctx := newTestSigningContext(t)
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	reference := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)[1]
+	require.Equal(t, SignedPropertiesType, reference.SelectAttrValue("Type", ""))
+
+	const customType = "http://uri.etsi.org/01903/v1.4.1#SignedProperties"
+	ctx.SignedPropertiesReferenceType = customType
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	reference = signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)[1]
+	require.Equal(t, customType, reference.SelectAttrValue("Type", ""))
+	require.NoError(t, ValidateStructure(signature))
+}
+
+func TestCanonicalizerFor(t *testing.T) {
+	for _, algorithm := range []dsig.AlgorithmID{
+		dsig.CanonicalXML10ExclusiveAlgorithmId,
+		dsig.CanonicalXML10ExclusiveWithCommentsAlgorithmId,
+		dsig.CanonicalXML10RecAlgorithmId,
+		dsig.CanonicalXML10WithCommentsAlgorithmId,
+		dsig.CanonicalXML11AlgorithmId,
+		dsig.CanonicalXML11WithCommentsAlgorithmId,
+	} {
+		canonicalizer, err := CanonicalizerFor(algorithm.String())
+		require.NoError(t, err)
+		require.Equal(t, algorithm, canonicalizer.Algorithm())
+	}
+
+	_, err := CanonicalizerFor("http://www.w3.org/2001/10/xml-exc-c14n#withcomments")
+	require.Error(t, err)
+}
+
+const commentedXML = `<Document Id="signedData"><!-- annotation --><Content>text</Content></Document>`
+
+func TestWithCommentsCanonicalization(t *testing.T) {
+	dataDigest := func(signature *etree.Element) string {
+		return signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "/ds:" + dsig.DigestValueTag).Text()
+	}
+
+	ctx := newTestSigningContext(t)
+	_, signature := signAndReparse(t, commentedXML, ctx)
+	withoutComments := dataDigest(signature)
+
+	for _, canonicalizer := range []dsig.Canonicalizer{
+		dsig.MakeC14N10ExclusiveWithCommentsCanonicalizerWithPrefixList(""),
+		dsig.MakeC14N10WithCommentsCanonicalizer(),
+		dsig.MakeC14N11WithCommentsCanonicalizer(),
+	} {
+		ctx = newTestSigningContext(t)
+		ctx.DataContext.Canonicalizer = canonicalizer
+		ctx.PropertiesContext.Canonicalizer = canonicalizer
+		ctx.Canonicalizer = canonicalizer
+
+		// a bare name reference dereferences to the element without its comments
+		root, signature := signAndReparse(t, commentedXML, ctx)
+		require.Equal(t, withoutComments, dataDigest(signature))
+		_, err := (&VerifyContext{}).Verify(signature, root)
+		require.NoError(t, err)
+
+		ctx.DataContext.ReferenceURI = "#xpointer(id('signedData'))"
+		root, signature = signAndReparse(t, commentedXML, ctx)
+		reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+		transforms := reference.FindElements("ds:" + dsig.TransformsTag + "/ds:" + dsig.TransformTag)
+		require.Equal(t, canonicalizer.Algorithm().String(), transforms[len(transforms)-1].SelectAttrValue(dsig.AlgorithmAttr, ""))
+		require.Equal(t, canonicalizer.Algorithm().String(), signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.CanonicalizationMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+		require.NotEqual(t, withoutComments, dataDigest(signature))
+
+		_, err = (&VerifyContext{}).Verify(signature, root)
+		require.NoError(t, err)
+
+		root.Child[0].(*etree.Comment).Data = " changed "
+		_, err = (&VerifyContext{}).Verify(signature, root)
+		require.Error(t, err)
+	}
+}
+
+func TestLargeSerialNumber(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	// 19 random-looking octets with the high bit set, DER needs a leading zero octet to keep the INTEGER positive
+	serialNumber, ok := new(big.Int).SetString("8f1e2d3c4b5a69788796a5b4c3d2e1f0011223", 16)
+	require.True(t, ok)
+	require.Greater(t, serialNumber.BitLen(), 64)
+	keyStore := newTestKeyStoreFromTemplate(t, &x509.Certificate{SerialNumber: serialNumber})
+
+	ctx := newTestSigningContext(t)
+	ctx.KeyStore = *keyStore
+	ctx.KeyInfoContext.IncludeX509IssuerSerial = true
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	decimal := "3191635324819279143478436952213011730570220067"
+	require.Equal(t, decimal, serialNumber.String())
+	require.Equal(t, decimal, signature.FindElement("ds:"+dsig.KeyInfoTag+"/ds:"+dsig.X509DataTag+"/ds:"+x509IssuerSerialTag+"/ds:"+x509SerialNumberTag).Text())
+	signingCertificatePath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag + "/" + Prefix + ":" + SignedSignaturePropertiesTag + "/" + Prefix + ":"
+	require.Equal(t, decimal, signature.FindElement(signingCertificatePath+SigningCertificateTag+"/"+Prefix+":"+CertTag+"/"+Prefix+":"+IssuerSerialTag+"/ds:"+x509SerialNumberTag).Text())
+
+	ctx.PropertiesContext.UseSigningCertificateV2 = true
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	der, err := base64.StdEncoding.DecodeString(signature.FindElement(signingCertificatePath + SigningCertificateV2Tag + "/" + Prefix + ":" + CertTag + "/" + Prefix + ":" + IssuerSerialV2Tag).Text())
+	require.NoError(t, err)
+	var decoded struct {
+		Issuer       []asn1.RawValue
+		SerialNumber asn1.RawValue
+	}
+	_, err = asn1.Unmarshal(der, &decoded)
+	require.NoError(t, err)
+	require.Equal(t, asn1.TagInteger, decoded.SerialNumber.Tag)
+	require.Equal(t, append([]byte{0}, serialNumber.Bytes()...), decoded.SerialNumber.Bytes)
+	require.NoError(t, VerifySigningCertificate(signature, keyStore.Cert))
+}
+
+// newTestCertificate issues a certificate for the test key from template, signed by parent or self-signed when nil
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate) *x509.Certificate {
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+
+	template.NotBefore = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	template.NotAfter = time.Date(3020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &keyStore.PrivateKey.PublicKey, keyStore.PrivateKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func caTemplate(serialNumber int64, commonName string) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          big.NewInt(serialNumber),
+		Subject:               pkix.Name{CommonName: commonName},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+}
+
+// newTestCertChain issues a root, an intermediate and a signing certificate below it for the test key
+func newTestCertChain(t *testing.T) (root *x509.Certificate, intermediate *x509.Certificate, leaf *x509.Certificate) {
+	root = newTestCertificate(t, caTemplate(1, "Test Root"), nil)
+	intermediate = newTestCertificate(t, caTemplate(2, "Test Intermediate"), root)
+	leaf = newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, intermediate)
+	return root, intermediate, leaf
+}
+
+func TestCertChainOrder(t *testing.T) {
+	signedData := newTestSignedData(t)
+	root, intermediate, leaf := newTestCertChain(t)
+
+	ctx := newTestSigningContext(t)
+	ctx.KeyStore.Cert = leaf
+	ctx.KeyStore.CertBinary = leaf.Raw
+	ctx.KeyStore.CertChain = []*x509.Certificate{root, intermediate}
+
+	chainOf := func(signature *etree.Element) [][]byte {
+		var chain [][]byte
+		for _, el := range signature.FindElements("ds:" + dsig.KeyInfoTag + "/ds:" + dsig.X509DataTag + "/ds:" + dsig.X509CertificateTag) {
+			der, err := base64.StdEncoding.DecodeString(el.Text())
+			require.NoError(t, err)
+			chain = append(chain, der)
+		}
+		return chain
+	}
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{leaf.Raw, root.Raw, intermediate.Raw}, chainOf(signature))
+
+	ctx.KeyInfoContext.OrderCertChain = true
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{leaf.Raw, intermediate.Raw, root.Raw}, chainOf(signature))
+
+	ctx.KeyInfoContext.ExcludeRootCertificate = true
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{leaf.Raw, intermediate.Raw}, chainOf(signature))
+
+	ctx.KeyStore.CertChain = []*x509.Certificate{root}
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Test Root")
+
+	other := newTestCertificate(t, caTemplate(4, "Other Root"), nil)
+	ctx.KeyStore.CertChain = []*x509.Certificate{intermediate, root, other}
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Other Root")
+}
+
+func TestRequireChain(t *testing.T) {
+	root, intermediate, leaf := newTestCertChain(t)
+	ctx := newTestSigningContext(t)
+	ctx.KeyStore.Cert = leaf
+	ctx.KeyStore.CertBinary = leaf.Raw
+	ctx.KeyInfoContext.RequireChain = true
+
+	_, err := CreateSignature(newTestSignedData(t), ctx)
+	require.EqualError(t, err, "xades: KeyInfoContext.RequireChain is set but KeyStore.CertChain is empty")
+
+	ctx.KeyStore.CertChain = []*x509.Certificate{intermediate, root}
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Len(t, signature.FindElements("ds:"+dsig.KeyInfoTag+"/ds:"+dsig.X509DataTag+"/ds:"+dsig.X509CertificateTag), 3)
+}
+
+func TestDataObjectFormat(t *testing.T) {
+	signedData := newTestSignedData(t)
+	dataObjectFormatPath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag + "/" +
+		Prefix + ":" + SignedDataObjectPropertiesTag + "/" + Prefix + ":" + DataObjectFormatTag
+
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.DataObjectFormat = &DataObjectFormat{MimeType: "text/xml", Encoding: "UTF-8"}
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+	require.Empty(t, ctx.DataContext.ReferenceID)
+
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	dataObjectFormat := signature.FindElement(dataObjectFormatPath)
+	require.Equal(t, "Reference", reference.SelectAttrValue("Id", ""))
+	require.Equal(t, "#Reference", dataObjectFormat.SelectAttrValue("ObjectReference", ""))
+	require.Equal(t, "text/xml", dataObjectFormat.SelectElement(Prefix+":MimeType").Text())
+	require.Equal(t, "UTF-8", dataObjectFormat.SelectElement(Prefix+":Encoding").Text())
+
+	dataObjectFormat.CreateAttr("ObjectReference", "#Other")
+	require.Error(t, ValidateStructure(signature))
+
+	ctx.DataContext.ReferenceID = "data-reference"
+	ctx.PropertiesContext.DataObjectFormat.ObjectReference = "#data-reference"
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+	require.Equal(t, "#data-reference", signature.FindElement(dataObjectFormatPath).SelectAttrValue("ObjectReference", ""))
+
+	ctx.PropertiesContext.DataObjectFormat.ObjectReference = "#Reference"
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+
+	ctx.PropertiesContext.DataObjectFormat = &DataObjectFormat{}
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+}
+
+func TestSignedDataObjectProperties(t *testing.T) {
+	signedDataObjectPropertiesPath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag + "/" +
+		Prefix + ":" + SignedDataObjectPropertiesTag
+
+	ctx := newTestSigningContext(t)
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Nil(t, signature.FindElement(signedDataObjectPropertiesPath))
+	signedProperties := signature.FindElement("ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag)
+	require.Len(t, signedProperties.ChildElements(), 1)
+
+	ctx.PropertiesContext.AllDataObjectsTimeStamp = &TimeStampContext{Client: &fakeTimestampClient{}, Hash: crypto.SHA256}
+	ctx.PropertiesContext.DataObjectFormat = &DataObjectFormat{MimeType: "text/xml"}
+	signature, err = CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+	var tags []string
+	for _, child := range signature.FindElement(signedDataObjectPropertiesPath).ChildElements() {
+		tags = append(tags, child.Tag)
+	}
+	require.Equal(t, []string{DataObjectFormatTag, AllDataObjectsTimeStampTag}, tags)
+
+	ctx.PropertiesContext.DataObjectFormat = nil
+	signature, err = CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Len(t, signature.FindElement(signedDataObjectPropertiesPath).ChildElements(), 1)
+}
+
+func TestPlainXMLDSig(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	ctx.PlainXMLDSig = true
+
+	root, signature := signAndReparse(t, testXML, ctx)
+	require.Nil(t, signature.SelectElement("ds:Object"))
+	references := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Len(t, references, 1)
+	require.Equal(t, "#signedData", references[0].SelectAttrValue(dsig.URIAttr, ""))
+
+	result, err := (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+	require.Equal(t, ctx.KeyStore.CertBinary, result.Certificate.Raw)
+
+	certificateStore := &dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{ctx.KeyStore.Cert}}
+	validationContext := dsig.NewDefaultValidationContext(certificateStore)
+	validationContext.IdAttribute = "id"
+	validationContext.Clock = dsig.NewFakeClockAt(ctx.KeyStore.Cert.NotBefore)
+	_, err = validationContext.Validate(root)
+	require.NoError(t, err)
+
+	plan, err := Inspect(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Empty(t, plan.SignedPropertiesCanonical)
+
+	ctx.PropertiesContext.DataObjectFormat = &DataObjectFormat{MimeType: "text/xml"}
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+}
+
+func TestIdAttribute(t *testing.T) {
+	for _, idAttribute := range []string{"ID", "xml:id"} {
+		ctx := newTestSigningContext(t)
+		ctx.IdAttribute = idAttribute
+		ctx.ObjectID = "object"
+		ctx.DataContext.ExcludeSignatures = true
+		ctx.PropertiesContext.DataObjectFormat = &DataObjectFormat{MimeType: "text/xml"}
+
+		root, signature := signAndReparse(t, testXML, ctx)
+		require.NotEmpty(t, signature.SelectAttrValue(idAttribute, ""))
+		require.Empty(t, signature.SelectAttrValue("Id", ""))
+		for _, path := range []string{
+			"ds:Object",
+			"ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag,
+			"ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "[1]",
+		} {
+			el := signature.FindElement(path)
+			require.NotEmpty(t, el, path)
+			require.NotEmpty(t, el.SelectAttrValue(idAttribute, ""), path)
+			require.Nil(t, el.SelectAttr("Id"), path)
+		}
+
+		require.NoError(t, ValidateStructure(signature))
+		_, err := (&VerifyContext{}).Verify(signature, root)
+		require.NoError(t, err)
+
+		require.NoError(t, AddValidationValues(signature, &ValidationValuesContext{OCSPResponses: [][]byte{[]byte("ocsp")}}))
+		values := signature.FindElement(unsignedSignaturePropertiesPath("ds") + "/" + Prefix + ":" + RevocationValuesTag)
+		require.Equal(t, signature.SelectAttrValue(idAttribute, "")+"-"+RevocationValuesTag, values.SelectAttrValue(idAttribute, ""))
+	}
+}
+
+func TestCertBinaryFromCert(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	expected, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+
+	certBinary := ctx.KeyStore.CertBinary
+	ctx.KeyStore.CertBinary = nil
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Nil(t, ctx.KeyStore.CertBinary)
+	for _, path := range []string{
+		"ds:" + dsig.KeyInfoTag + "/ds:" + dsig.X509DataTag + "/ds:" + dsig.X509CertificateTag,
+		"ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag + "/" + Prefix + ":" + SignedSignaturePropertiesTag +
+			"/" + Prefix + ":" + SigningCertificateTag + "/" + Prefix + ":" + CertTag + "/" + Prefix + ":" + CertDigestTag + "/ds:" + dsig.DigestValueTag,
+	} {
+		require.NotEmpty(t, signature.FindElement(path), path)
+		require.Equal(t, expected.FindElement(path).Text(), signature.FindElement(path).Text(), path)
+	}
+
+	stale := newTestKeyStoreFromTemplate(t, &x509.Certificate{})
+	ctx.KeyStore.CertBinary = stale.CertBinary
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+
+	ctx.KeyStore.CertBinary = certBinary
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+}
+
+func TestCertFromCertBinary(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	expected, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+
+	cert := ctx.KeyStore.Cert
+	ctx.KeyStore.Cert = nil
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Nil(t, ctx.KeyStore.Cert)
+	issuerSerialPath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag + "/" + Prefix + ":" + SignedSignaturePropertiesTag +
+		"/" + Prefix + ":" + SigningCertificateTag + "/" + Prefix + ":" + CertTag + "/" + Prefix + ":" + IssuerSerialTag
+	for _, path := range []string{issuerSerialPath + "/ds:" + x509IssuerNameTag, issuerSerialPath + "/ds:" + x509SerialNumberTag} {
+		require.NotEmpty(t, signature.FindElement(path).Text(), path)
+		require.Equal(t, expected.FindElement(path).Text(), signature.FindElement(path).Text(), path)
+	}
+	result, err := (&VerifyContext{}).Verify(signature, newTestSignedData(t))
+	require.NoError(t, err)
+	require.Equal(t, cert.Raw, result.Certificate.Raw)
+
+	ctx.KeyStore.CertBinary = []byte("not a certificate")
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "xades: parsing KeyStore.CertBinary: ")
+
+	ctx.KeyStore.CertBinary = nil
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.EqualError(t, err, "xades: KeyStore has no certificate, set Cert or CertBinary")
+}
+
+func TestSigningCertificateChain(t *testing.T) {
+	root, intermediate, leaf := newTestCertChain(t)
+	ctx := newTestSigningContext(t)
+	ctx.KeyStore.Cert = leaf
+	ctx.KeyStore.CertBinary = leaf.Raw
+	ctx.KeyStore.CertChain = []*x509.Certificate{root, intermediate}
+
+	certsPath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag + "/" +
+		Prefix + ":" + SignedSignaturePropertiesTag + "/" + Prefix + ":%v/" + Prefix + ":" + CertTag
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Len(t, signature.FindElements(fmt.Sprintf(certsPath, SigningCertificateTag)), 1)
+
+	ctx.PropertiesContext.SigningCertificateChain = true
+	for _, v2 := range []bool{false, true} {
+		ctx.PropertiesContext.UseSigningCertificateV2 = v2
+		signature, err = CreateSignature(newTestSignedData(t), ctx)
+		require.NoError(t, err)
+
+		tag := SigningCertificateTag
+		if v2 {
+			tag = SigningCertificateV2Tag
+		}
+		certs := signature.FindElements(fmt.Sprintf(certsPath, tag))
+		require.Len(t, certs, 3)
+		for i, cert := range []*x509.Certificate{leaf, intermediate, root} {
+			digestValue := certs[i].FindElement(Prefix + ":" + CertDigestTag + "/ds:" + dsig.DigestValueTag)
+			require.Equal(t, DigestBytes(cert.Raw, crypto.SHA256), digestValue.Text())
+			if v2 {
+				expected, err := marshalIssuerSerial(cert)
+				require.NoError(t, err)
+				require.Equal(t, base64.StdEncoding.EncodeToString(expected), certs[i].FindElement(Prefix+":"+IssuerSerialV2Tag).Text())
+			} else {
+				require.Equal(t, cert.SerialNumber.String(), certs[i].FindElement(Prefix+":"+IssuerSerialTag+"/ds:"+x509SerialNumberTag).Text())
+			}
+		}
+		require.NoError(t, VerifySigningCertificate(signature, leaf))
+	}
+
+	ctx.KeyStore.CertChain = []*x509.Certificate{root, newTestKeyStoreFromTemplate(t, &x509.Certificate{}).Cert}
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+}
+
+func TestQualifiedCopiesNotPlaced(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	root, signature := signAndReparse(t, testXML, ctx)
+
+	signedInfo := signature.SelectElement("ds:" + dsig.SignedInfoTag)
+	signedProperties := signature.FindElement("ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag)
+	require.False(t, declaresNamespace(signedInfo))
+	require.False(t, declaresNamespace(signedProperties))
+
+	doc := etree.NewDocument()
+	doc.SetRoot(root)
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(serialized, `xmlns:ds="`))
+	require.Equal(t, 1, strings.Count(serialized, `xmlns:xades="`))
+
+	attrs := make([]etree.Attr, len(signedProperties.Attr), len(signedProperties.Attr)+2)
+	copy(attrs, signedProperties.Attr)
+	signedProperties.Attr = attrs
+	qualified := createQualifiedSignedProperties(signedProperties, ctx.XmlDsigPrefix)
+	require.True(t, declaresNamespace(qualified))
+	require.False(t, declaresNamespace(signedProperties))
+	require.Empty(t, attrs[len(attrs):cap(attrs)][0].Key)
+}
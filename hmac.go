@@ -0,0 +1,101 @@
+package xades
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// hmacSignatureMethodIdentifiers are the HMAC SignatureMethod algorithm identifiers of XML DSig and RFC 4051
+var hmacSignatureMethodIdentifiers = map[crypto.Hash]string{
+	crypto.SHA1:   "http://www.w3.org/2000/09/xmldsig#hmac-sha1",
+	crypto.SHA256: "http://www.w3.org/2001/04/xmldsig-more#hmac-sha256",
+	crypto.SHA384: "http://www.w3.org/2001/04/xmldsig-more#hmac-sha384",
+	crypto.SHA512: "http://www.w3.org/2001/04/xmldsig-more#hmac-sha512",
+}
+
+// HMACKeyStore hold the shared secret of a symmetric HMAC signature
+type HMACKeyStore struct {
+	// Key is the shared secret
+	Key []byte
+	// KeyName identifies Key to the receiver as ds:KeyInfo/ds:KeyName, KeyInfo is omitted when empty
+	KeyName string
+}
+
+// checkHMAC return error when the HMAC signature of ctx cannot be created.
+// XAdES binds the signature to a signing certificate, which a shared secret has not, so HMAC requires PlainXMLDSig
+func checkHMAC(ctx *SigningContext) error {
+	if len(ctx.HMAC.Key) == 0 {
+		return errors.New("xades: HMAC requires a Key")
+	}
+	if !ctx.PlainXMLDSig {
+		return errors.New("xades: HMAC signature has no signing certificate, it requires PlainXMLDSig")
+	}
+	if ctx.DsigContext != nil {
+		return errors.New("xades: HMAC cannot be combined with DsigContext")
+	}
+	if _, ok := hmacSignatureMethodIdentifiers[ctx.Hash]; !ok {
+		return fmt.Errorf("xades: unsupported HMAC hash %v", ctx.Hash)
+	}
+	return nil
+}
+
+// hmacSignatureValue return the base64 HMAC with hash and key of element canonicalized by canonicalizer
+func hmacSignatureValue(element *etree.Element, canonicalizer dsig.Canonicalizer, hash crypto.Hash, key []byte) (string, error) {
+	canonical, err := canonicalizer.Canonicalize(element)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(hash.New, key)
+	mac.Write(canonical)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// createHMACKeyInfo create ds:KeyInfo with the ds:KeyName of keyStore, nil without KeyName
+func createHMACKeyInfo(keyStore *HMACKeyStore, xmlDsigPrefix string) *etree.Element {
+	if keyStore.KeyName == "" {
+		return nil
+	}
+	return &etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   dsig.KeyInfoTag,
+		Child: []etree.Token{createKeyName(keyStore.KeyName, xmlDsigPrefix)},
+	}
+}
+
+// hmacHash return hash of the HMAC SignatureMethod algorithm identifier
+func hmacHash(algorithm string) (crypto.Hash, bool) {
+	for hash, identifier := range hmacSignatureMethodIdentifiers {
+		if identifier == algorithm {
+			return hash, true
+		}
+	}
+	return 0, false
+}
+
+// verifyHMACSignatureValue check SignatureValue of sig, an HMAC of the canonical signedInfo, with key
+func verifyHMACSignatureValue(sig *etree.Element, signedInfo *etree.Element, key []byte) error {
+
+	canonical, value, algorithm, err := signedInfoSignatureValue(sig, signedInfo)
+	if err != nil {
+		return err
+	}
+	hash, ok := hmacHash(algorithm)
+	if !ok {
+		return fmt.Errorf("xades: SignatureMethod %q is not an HMAC", algorithm)
+	}
+	if findChild(findChild(signedInfo, dsig.SignatureMethodTag), hmacOutputLengthTag) != nil {
+		return errors.New("xades: truncated HMAC output is not supported")
+	}
+	mac := hmac.New(hash.New, key)
+	mac.Write(canonical)
+	if !hmac.Equal(mac.Sum(nil), value) {
+		return errors.New("xades: SignatureValue does not verify")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package xades
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"encoding/base64"
+	"testing"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMAC(t *testing.T) {
+	key := []byte("shared secret")
+	ctx := newTestSigningContext(t)
+	ctx.KeyStore = MemoryX509KeyStore{}
+	ctx.PlainXMLDSig = true
+	ctx.HMAC = &HMACKeyStore{Key: key, KeyName: "integration-key"}
+
+	root, signature := signAndReparse(t, testXML, ctx)
+	signedInfo := signature.SelectElement("ds:" + dsig.SignedInfoTag)
+	require.Equal(t, "http://www.w3.org/2001/04/xmldsig-more#hmac-sha256", signedInfo.SelectElement("ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+	keyInfo := signature.SelectElement("ds:" + dsig.KeyInfoTag)
+	require.Len(t, keyInfo.ChildElements(), 1)
+	require.Equal(t, "integration-key", keyInfo.SelectElement("ds:KeyName").Text())
+
+	canonical, err := canonicalizeInContext(dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""), signedInfo)
+	require.NoError(t, err)
+	mac := hmac.New(crypto.SHA256.New, key)
+	mac.Write(canonical)
+	require.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), signature.SelectElement("ds:"+dsig.SignatureValueTag).Text())
+
+	result, err := (&VerifyContext{HMACKey: key}).Verify(signature, root)
+	require.NoError(t, err)
+	require.Nil(t, result.Certificate)
+	require.True(t, (&VerifyContext{HMACKey: key}).Report(signature, root).Valid)
+	_, err = (&VerifyContext{HMACKey: []byte("other secret")}).Verify(signature, root)
+	require.Error(t, err)
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.Error(t, err)
+	_, err = (&VerifyContext{HMACKey: key, CheckValidityAtSigningTime: true}).Verify(signature, root)
+	require.Error(t, err)
+
+	ctx.HMAC.KeyName = ""
+	ctx.Hash = crypto.SHA512
+	_, signature = signAndReparse(t, testXML, ctx)
+	require.Nil(t, signature.SelectElement("ds:"+dsig.KeyInfoTag))
+	require.Equal(t, "http://www.w3.org/2001/04/xmldsig-more#hmac-sha512", signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	ctx.PlainXMLDSig = false
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+	ctx.PlainXMLDSig = true
+	ctx.HMAC.Key = nil
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package xades
+
+import (
+	"context"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// SignaturePlan holds the canonical octets and base64 digests a signature would be computed from
+type SignaturePlan struct {
+	// DataCanonical is the output of the data reference transforms, digested with DataContext.Hash
+	DataCanonical []byte
+	DataDigest    string
+	// SignedPropertiesCanonical is the canonical SignedProperties, digested with PropertiesContext.Hash,
+	// both are empty for a PlainXMLDSig signature
+	SignedPropertiesCanonical []byte
+	SignedPropertiesDigest    string
+	// SignedInfoCanonical is the canonical SignedInfo, the octets that are signed. SignedInfoDigest is
+	// their digest with SigningContext.Hash, the value an RSA or ECDSA signature is computed over
+	SignedInfoCanonical []byte
+	SignedInfoDigest    string
+	// KeyInfoCanonical is the canonical KeyInfo, digested with PropertiesContext.Hash, both are empty unless
+	// KeyInfoContext.SignKeyInfo
+	KeyInfoCanonical []byte
+	KeyInfoDigest    string
+}
+
+// Inspect return the plan of the signature CreateSignature would create for signedData, without signing.
+// Time-stamp properties are requested as when signing. Ids and SigningTime match a later signature only when
+// fixed in ctx, e.g. by SignatureUuid and PropertiesContext.SigninigTime. Neither ctx nor signedData is modified.
+func Inspect(signedData *etree.Element, ctx *SigningContext) (*SignaturePlan, error) {
+
+	goCtx := context.Background()
+	ctx, canonicalData, signatureIdPrefix, err := prepareSignedData(goCtx, signedData, ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, _, plan, err := planSignature(goCtx, canonicalData, !ctx.DataContext.OmitTransforms, signatureIdPrefix, ctx)
+	return plan, err
+}
+
+// planSignature create SignedProperties and SignedInfo over the octets of the data reference, ctx is prepared
+func planSignature(goCtx context.Context, data []byte, dataCanonicalized bool, signatureIdPrefix string, ctx *SigningContext) (signedProperties *etree.Element, signedInfo *etree.Element, plan *SignaturePlan, err error) {
+
+	if err := checkIdCollisions(signatureIdPrefix, ctx); err != nil {
+		return nil, nil, nil, err
+	}
+
+	plan = &SignaturePlan{
+		DataCanonical: data,
+		DataDigest:    DigestBytes(data, ctx.DataContext.Hash),
+	}
+
+	if ctx.PlainXMLDSig {
+		return planSignedInfo(nil, signatureIdPrefix, dataCanonicalized, plan, ctx)
+	}
+
+	signingTime := ctx.PropertiesContext.SigninigTime
+	if signingTime.IsZero() {
+		signingTime = time.Now()
+	}
+	signedProperties, err = createSignedProperties(&ctx.KeyStore, signingTime, signatureIdPrefix, ctx)
+	if err != nil {
+		return nil, nil, nil, wrapPhase(ErrPropertiesDigest, err)
+	}
+	signedDataObjectProperties, err := createSignedDataObjectProperties(goCtx, data, dataCanonicalized, signatureIdPrefix, ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if signedDataObjectProperties != nil {
+		signedProperties.AddChild(signedDataObjectProperties)
+	}
+	qualifiedSignedProperties := createQualifiedSignedProperties(signedProperties, ctx.XmlDsigPrefix)
+	plan.SignedPropertiesCanonical, err = ctx.PropertiesContext.Canonicalizer.Canonicalize(qualifiedSignedProperties)
+	if err != nil {
+		return nil, nil, nil, wrapPhase(ErrPropertiesDigest, err)
+	}
+	plan.SignedPropertiesDigest = DigestBytes(plan.SignedPropertiesCanonical, ctx.PropertiesContext.Hash)
+	return planSignedInfo(signedProperties, signatureIdPrefix, dataCanonicalized, plan, ctx)
+}
+
+// planSignedInfo create SignedInfo over the digests of plan and complete plan with its canonical octets
+func planSignedInfo(signedProperties *etree.Element, signatureIdPrefix string, dataCanonicalized bool, plan *SignaturePlan, ctx *SigningContext) (*etree.Element, *etree.Element, *SignaturePlan, error) {
+
+	var err error
+	if ctx.KeyInfoContext.SignKeyInfo {
+		// createSignature places an identical KeyInfo, digested with the ds namespace it inherits declared as SignedInfo is
+		keyInfo, err := createSignatureKeyInfo(ctx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		plan.KeyInfoCanonical, err = ctx.PropertiesContext.Canonicalizer.Canonicalize(createQualifiedSignedInfo(keyInfo, ctx.XmlDsigPrefix))
+		if err != nil {
+			return nil, nil, nil, wrapPhase(ErrSignatureValue, err)
+		}
+		plan.KeyInfoDigest = DigestBytes(plan.KeyInfoCanonical, ctx.PropertiesContext.Hash)
+	}
+	signedInfo := createSignedInfo(plan.DataDigest, plan.SignedPropertiesDigest, plan.KeyInfoDigest, signatureIdPrefix, dataCanonicalized, ctx)
+	// invariant of createSignedInfo, a verifier rejects a SignedInfo out of the schema order
+	if err := checkSignedInfoOrder(signedInfo); err != nil {
+		return nil, nil, nil, err
+	}
+	plan.SignedInfoCanonical, err = ctx.Canonicalizer.Canonicalize(createQualifiedSignedInfo(signedInfo, ctx.XmlDsigPrefix))
+	if err != nil {
+		return nil, nil, nil, wrapPhase(ErrSignatureValue, err)
+	}
+	plan.SignedInfoDigest = DigestBytes(plan.SignedInfoCanonical, ctx.Hash)
+	return signedProperties, signedInfo, plan, nil
+}
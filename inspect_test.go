@@ -0,0 +1,72 @@
+package xades
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+	signatureUuid := uuid.MustParse("f6a8b2e4-1b8c-4c57-9a35-0c1dfd8e2f41")
+	ctx.SignatureUuid = &signatureUuid
+	ctx.UseSignatureUuid = true
+
+	plan, err := Inspect(signedData, ctx)
+	require.NoError(t, err)
+	require.Equal(t, DigestBytes(plan.DataCanonical, ctx.DataContext.Hash), plan.DataDigest)
+	require.Equal(t, DigestBytes(plan.SignedPropertiesCanonical, ctx.PropertiesContext.Hash), plan.SignedPropertiesDigest)
+	require.Equal(t, DigestBytes(plan.SignedInfoCanonical, ctx.Hash), plan.SignedInfoDigest)
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	references := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Equal(t, plan.DataDigest, references[0].SelectElement("ds:"+dsig.DigestValueTag).Text())
+	require.Equal(t, plan.SignedPropertiesDigest, references[1].SelectElement("ds:"+dsig.DigestValueTag).Text())
+
+	signedInfo, err := canonicalizeInContext(ctx.Canonicalizer, signature.SelectElement("ds:"+dsig.SignedInfoTag))
+	require.NoError(t, err)
+	require.Equal(t, string(plan.SignedInfoCanonical), string(signedInfo))
+
+	signatureValue, err := SignatureValueBytes(plan.SignedInfoCanonical, ctx.Hash, &ctx.KeyStore)
+	require.NoError(t, err)
+	require.Equal(t, signatureValue, signature.SelectElement("ds:"+dsig.SignatureValueTag).Text())
+}
+
+// TestCanonicalTestVectors pins the canonical octets the signature of TestSignatureGolden is computed from.
+// The vectors are generated by testdata/c14n.sh with the exclusive c14n of xmllint, never by this test, so they
+// check goxmldsig against an independent canonicalizer
+func TestCanonicalTestVectors(t *testing.T) {
+	signatureUuid, err := uuid.Parse("7837510c-674b-11ee-90e3-000c29c302a8")
+	require.NoError(t, err)
+
+	ctx := newTestSigningContext(t)
+	ctx.UseSignatureUuid = true
+	ctx.SignatureUuid = &signatureUuid
+
+	plan, err := Inspect(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "data.xml"))
+	require.NoError(t, err)
+	require.Equal(t, testXML, string(data), "testdata/data.xml is the input of data.c14n")
+
+	for name, actual := range map[string][]byte{
+		"data.c14n":             plan.DataCanonical,
+		"signedproperties.c14n": plan.SignedPropertiesCanonical,
+		"signedinfo.c14n":       plan.SignedInfoCanonical,
+	} {
+		expected, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(actual), name)
+	}
+
+	signature, err := ioutil.ReadFile(filepath.Join("testdata", "signature.golden"))
+	require.NoError(t, err)
+	require.Contains(t, string(signature), "<ds:DigestValue>"+plan.DataDigest+"</ds:DigestValue>")
+	require.Contains(t, string(signature), "<ds:DigestValue>"+plan.SignedPropertiesDigest+"</ds:DigestValue>")
+}
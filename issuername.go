@@ -0,0 +1,106 @@
+package xades
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"strings"
+)
+
+// IssuerNameFormat render the X509IssuerName text of the IssuerSerial elements naming cert. Validators compare
+// it as a string in different ways, pick the preset a receiver expects: GoIssuerName, RFC2253IssuerName or
+// RFC2253SpacedIssuerName
+type IssuerNameFormat func(cert *x509.Certificate) string
+
+// GoIssuerName render the issuer of cert as crypto/x509 does, the default: RDNs joined by ",", keywords such as
+// SERIALNUMBER beyond those of RFC 2253 and multi-valued RDNs split into one RDN per attribute
+func GoIssuerName(cert *x509.Certificate) string {
+	return cert.Issuer.String()
+}
+
+// RFC2253IssuerName render the issuer of cert by RFC 2253 from its DER encoding, RDNs joined by ",": multi-valued
+// RDNs are kept, attribute types without an RFC 2253 keyword are dotted OIDs with the "#" hex encoded value, and
+// ',', '+', '"', '\', '<', '>', ';', a leading '#' or space and a trailing space are escaped by '\'
+func RFC2253IssuerName(cert *x509.Certificate) string {
+	return rfc2253Name(cert, ",")
+}
+
+// RFC2253SpacedIssuerName render the issuer of cert as RFC2253IssuerName does with RDNs joined by ", "
+func RFC2253SpacedIssuerName(cert *x509.Certificate) string {
+	return rfc2253Name(cert, ", ")
+}
+
+// rfc2253Keywords are the attribute type keywords of RFC 2253 section 2.3 by OID
+var rfc2253Keywords = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.6":                    "C",
+	"2.5.4.9":                    "STREET",
+	"0.9.2342.19200300.100.1.25": "DC",
+	"0.9.2342.19200300.100.1.1":  "UID",
+}
+
+// rawAttributeTypeAndValue is an AttributeTypeAndValue of a distinguished name keeping the encoding of its value
+type rawAttributeTypeAndValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// rawRelativeDistinguishedNameSET is a RelativeDistinguishedName, encoding/asn1 parses a SET by the name suffix
+type rawRelativeDistinguishedNameSET []rawAttributeTypeAndValue
+
+// rfc2253Name render the RawIssuer of cert by RFC 2253 with RDNs joined by separator, the last RDN first. The
+// crypto/x509 rendering is returned when RawIssuer does not parse
+func rfc2253Name(cert *x509.Certificate, separator string) string {
+	var rdns []rawRelativeDistinguishedNameSET
+	if rest, err := asn1.Unmarshal(cert.RawIssuer, &rdns); err != nil || len(rest) > 0 {
+		return cert.Issuer.String()
+	}
+	var builder strings.Builder
+	for i := len(rdns) - 1; i >= 0; i-- {
+		if i < len(rdns)-1 {
+			builder.WriteString(separator)
+		}
+		for j, atv := range rdns[i] {
+			if j > 0 {
+				builder.WriteByte('+')
+			}
+			builder.WriteString(rfc2253AttributeTypeAndValue(atv))
+		}
+	}
+	return builder.String()
+}
+
+// rfc2253AttributeTypeAndValue render atv as type=value, the value as an escaped string when its type has a
+// keyword and it is a string, otherwise as "#" followed by the hex of its DER encoding
+func rfc2253AttributeTypeAndValue(atv rawAttributeTypeAndValue) string {
+	oid := atv.Type.String()
+	keyword, ok := rfc2253Keywords[oid]
+	if ok {
+		var value string
+		if _, err := asn1.Unmarshal(atv.Value.FullBytes, &value); err == nil {
+			return keyword + "=" + escapeRFC2253Value(value)
+		}
+	} else {
+		keyword = oid
+	}
+	return keyword + "=#" + hex.EncodeToString(atv.Value.FullBytes)
+}
+
+// escapeRFC2253Value escape the special characters of the string attribute value by RFC 2253 section 2.4
+func escapeRFC2253Value(value string) string {
+	var builder strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;`, r),
+			i == 0 && (r == '#' || r == ' '),
+			i == len(value)-1 && r == ' ':
+			builder.WriteByte('\\')
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
@@ -0,0 +1,52 @@
+package xades
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuerNameFormat(t *testing.T) {
+	oid := func(arc ...int) asn1.ObjectIdentifier { return append(asn1.ObjectIdentifier{2, 5, 4}, arc...) }
+	rawSubject, err := asn1.Marshal(pkix.RDNSequence{
+		{{Type: oid(6), Value: "EC"}},
+		{{Type: oid(10), Value: "Acme, Inc."}},
+		{{Type: oid(11), Value: "Sales+Billing"}, {Type: oid(3), Value: "#1 Signer "}},
+		{{Type: oid(5), Value: "0992"}},
+	})
+	require.NoError(t, err)
+	keyStore := newTestKeyStoreFromTemplate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "ignored"},
+		RawSubject:   rawSubject,
+	})
+
+	require.Equal(t, `SERIALNUMBER=0992,CN=\#1 Signer\ ,OU=Sales\+Billing,O=Acme\, Inc.,C=EC`, GoIssuerName(keyStore.Cert))
+	require.Equal(t, `2.5.4.5=#130430393932,CN=\#1 Signer\ +OU=Sales\+Billing,O=Acme\, Inc.,C=EC`, RFC2253IssuerName(keyStore.Cert))
+	require.Equal(t, `2.5.4.5=#130430393932, CN=\#1 Signer\ +OU=Sales\+Billing, O=Acme\, Inc., C=EC`, RFC2253SpacedIssuerName(keyStore.Cert))
+
+	for _, format := range []IssuerNameFormat{nil, GoIssuerName, RFC2253IssuerName, RFC2253SpacedIssuerName} {
+		ctx := newTestSigningContext(t)
+		ctx.KeyStore = *keyStore
+		ctx.KeyInfoContext.IncludeX509IssuerSerial = true
+		ctx.IssuerNameFormat = format
+		root, sig := signAndReparse(t, testXML, ctx)
+
+		expected := GoIssuerName(keyStore.Cert)
+		if format != nil {
+			expected = format(keyStore.Cert)
+		}
+		issuerName := findPath(sig, dsig.KeyInfoTag, dsig.X509DataTag, x509IssuerSerialTag, x509IssuerNameTag)
+		require.Equal(t, expected, issuerName.Text())
+		signingCertificate := findPath(findQualifyingProperties(sig), SignedPropertiesTag, SignedSignaturePropertiesTag, SigningCertificateTag)
+		require.Equal(t, expected, findPath(signingCertificate, CertTag, IssuerSerialTag, x509IssuerNameTag).Text())
+
+		_, err := (&VerifyContext{}).Verify(sig, root)
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,177 @@
+package xades
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	ManifestTag  string = "Manifest"
+	ManifestType string = "http://www.w3.org/2000/09/xmldsig#Manifest"
+)
+
+// ManifestEntry is one ds:Reference of a ds:Manifest
+type ManifestEntry struct {
+	URI     string
+	Element *etree.Element
+	Hash    crypto.Hash
+}
+
+// CreateManifest create ds:Manifest with Id id and one ds:Reference per entry. Each element is digested
+// after canonicalization with canonicalizer, which is announced by the reference transform.
+func CreateManifest(id string, entries []ManifestEntry, canonicalizer dsig.Canonicalizer, xmlDsigPrefix string) (*etree.Element, error) {
+
+	if len(entries) == 0 {
+		return nil, errors.New("xades: Manifest requires at least one entry")
+	}
+
+	manifest := etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   ManifestTag,
+		Attr: []etree.Attr{
+			{Key: "Id", Value: id},
+		},
+	}
+
+	for _, entry := range entries {
+		digestAlgorithm, ok := digestAlgorithmIdentifier(entry.Hash)
+		if !ok {
+			return nil, fmt.Errorf("xades: unsupported digest algorithm %v for Manifest reference %q", entry.Hash, entry.URI)
+		}
+		digestValue, err := DigestValue(entry.Element.Copy(), &canonicalizer, entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		reference := manifest.CreateElement(dsig.ReferenceTag)
+		reference.Space = xmlDsigPrefix
+		reference.CreateAttr(dsig.URIAttr, entry.URI)
+
+		transforms := reference.CreateElement(dsig.TransformsTag)
+		transforms.Space = xmlDsigPrefix
+		transform := transforms.CreateElement(dsig.TransformTag)
+		transform.Space = xmlDsigPrefix
+		transform.CreateAttr(dsig.AlgorithmAttr, canonicalizer.Algorithm().String())
+
+		digestMethod := reference.CreateElement(dsig.DigestMethodTag)
+		digestMethod.Space = xmlDsigPrefix
+		digestMethod.CreateAttr(dsig.AlgorithmAttr, digestAlgorithm)
+
+		digestValueElement := reference.CreateElement(dsig.DigestValueTag)
+		digestValueElement.Space = xmlDsigPrefix
+		digestValueElement.SetText(digestValue)
+	}
+
+	return &manifest, nil
+}
+
+// CreateManifestSignature create signature whose single data reference points at a ds:Manifest over entries,
+// with Type ManifestType. The Manifest is placed in its own ds:Object after the QualifyingProperties object and is
+// canonicalized with ctx.DataContext.Canonicalizer, which also canonicalizes the entries.
+// ctx.DataContext.ReferenceURI, ReferenceType and IsEnveloped are ignored, ctx is not modified.
+func CreateManifestSignature(entries []ManifestEntry, ctx *SigningContext) (*etree.Element, error) {
+
+	if ctx.DataContext.Transforms != nil || ctx.DataContext.OmitTransforms {
+		return nil, errors.New("xades: the Manifest reference is canonicalized, Transforms and OmitTransforms do not apply")
+	}
+	ctx, err := prepareSigningContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signatureIdPrefix, err := createSignatureIdPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if err := ctx.SecurityPolicy.checkHash(entry.Hash, "Manifest digest"); err != nil {
+			return nil, err
+		}
+	}
+
+	manifestId := signatureIdPrefix + ManifestTag
+	manifest, err := CreateManifest(manifestId, entries, ctx.DataContext.Canonicalizer, ctx.XmlDsigPrefix)
+	if err != nil {
+		return nil, wrapPhase(ErrDataDigest, err)
+	}
+	manifest.RemoveAttr("Id")
+	manifest.Attr = append(manifest.Attr, idAttr(ctx.IdAttribute, manifestId))
+	qualifiedManifest := manifest.Copy()
+	qualifiedManifest.CreateAttr("xmlns:"+ctx.XmlDsigPrefix, dsig.Namespace)
+	canonicalManifest, err := ctx.DataContext.Canonicalizer.Canonicalize(qualifiedManifest)
+	if err != nil {
+		return nil, wrapPhase(ErrDataDigest, err)
+	}
+
+	ctx.DataContext.ReferenceURI = "#" + manifestId
+	ctx.DataContext.ReferenceType = ManifestType
+	ctx.DataContext.IsEnveloped = false
+	signature, err := createSignature(context.Background(), canonicalManifest, true, signatureIdPrefix, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	object := signature.CreateElement("Object")
+	object.Space = ctx.XmlDsigPrefix
+	object.AddChild(manifest)
+	return signature, nil
+}
+
+// VerifyManifest recompute the digest of every ds:Reference of manifest over the element returned by resolve
+// for its URI, applying the canonicalization transform of the reference
+func VerifyManifest(manifest *etree.Element, resolve func(uri string) (*etree.Element, error)) error {
+
+	for _, reference := range manifest.ChildElements() {
+		if reference.Tag != dsig.ReferenceTag {
+			continue
+		}
+		uri := reference.SelectAttrValue(dsig.URIAttr, "")
+
+		el, err := resolve(uri)
+		if err != nil {
+			return err
+		}
+
+		canonicalizer, err := referenceCanonicalizer(reference)
+		if err != nil {
+			return err
+		}
+
+		digestMethod := findChild(reference, dsig.DigestMethodTag)
+		if digestMethod == nil {
+			return fmt.Errorf("xades: Manifest reference %q has no DigestMethod", uri)
+		}
+		hash, err := digestAlgorithmHash(digestMethod.SelectAttrValue(dsig.AlgorithmAttr, ""))
+		if err != nil {
+			return err
+		}
+
+		digestValue := findChild(reference, dsig.DigestValueTag)
+		if digestValue == nil {
+			return fmt.Errorf("xades: Manifest reference %q has no DigestValue", uri)
+		}
+
+		canonical, err := canonicalizer.Canonicalize(el.Copy())
+		if err != nil {
+			return err
+		}
+		if DigestBytes(canonical, hash) != digestValue.Text() {
+			return fmt.Errorf("xades: digest of Manifest reference %q does not match", uri)
+		}
+	}
+	return nil
+}
+
+// referenceCanonicalizer return canonicalizer of the single canonicalization transform of reference
+func referenceCanonicalizer(reference *etree.Element) (dsig.Canonicalizer, error) {
+	transforms := findChild(reference, dsig.TransformsTag)
+	if transforms == nil || len(transforms.ChildElements()) != 1 {
+		return nil, fmt.Errorf("xades: reference %q must have a single canonicalization transform", reference.SelectAttrValue(dsig.URIAttr, ""))
+	}
+	return methodCanonicalizer(transforms.ChildElements()[0])
+}
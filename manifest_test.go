@@ -0,0 +1,60 @@
+package xades
+
+import (
+	"crypto"
+	"fmt"
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateManifestSignature(t *testing.T) {
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(`<batch><item Id="first">one</item><item Id="second">two</item></batch>`))
+	items := doc.Root().SelectElements("item")
+
+	entries := []ManifestEntry{
+		{URI: "#first", Element: items[0], Hash: crypto.SHA256},
+		{URI: "#second", Element: items[1], Hash: crypto.SHA512},
+	}
+
+	ctx := newTestSigningContext(t)
+	signature, err := CreateManifestSignature(entries, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+	require.Equal(t, "#signedData", ctx.DataContext.ReferenceURI)
+
+	references := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Len(t, references, 2)
+	require.Equal(t, "#"+ManifestTag, references[0].SelectAttrValue(dsig.URIAttr, ""))
+	require.Equal(t, ManifestType, references[0].SelectAttrValue("Type", ""))
+
+	manifest := signature.FindElement("ds:Object/ds:" + ManifestTag)
+	require.NotNil(t, manifest)
+	require.Equal(t, ManifestTag, manifest.SelectAttrValue("Id", ""))
+	manifestReferences := manifest.SelectElements("ds:" + dsig.ReferenceTag)
+	require.Len(t, manifestReferences, 2)
+	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA512], manifestReferences[1].SelectElement("ds:"+dsig.DigestMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	canonicalManifest, err := canonicalizeInContext(ctx.DataContext.Canonicalizer, manifest)
+	require.NoError(t, err)
+	require.Equal(t, DigestBytes(canonicalManifest, crypto.SHA256), references[0].SelectElement("ds:"+dsig.DigestValueTag).Text())
+
+	resolve := func(uri string) (*etree.Element, error) {
+		for _, item := range items {
+			if "#"+elementId(item) == uri {
+				return item, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown %v", uri)
+	}
+	require.NoError(t, VerifyManifest(manifest, resolve))
+
+	items[1].SetText("tampered")
+	require.Error(t, VerifyManifest(manifest, resolve))
+
+	_, err = CreateManifestSignature(nil, ctx)
+	require.Error(t, err)
+}
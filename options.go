@@ -0,0 +1,98 @@
+package xades
+
+import (
+	"crypto"
+	"time"
+
+	"github.com/google/uuid"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// Option configure a SigningContext created by NewSigningContext
+type Option func(*SigningContext)
+
+// NewSigningContext create SigningContext signing with keyStore. Without options SHA-256 and exclusive canonicalization
+// are used everywhere, the ds prefix is used for XML DSig elements and the reference is detached.
+func NewSigningContext(keyStore *MemoryX509KeyStore, opts ...Option) *SigningContext {
+
+	canonicalizer := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	ctx := &SigningContext{
+		DataContext: SignedDataContext{
+			Canonicalizer: canonicalizer,
+			Hash:          crypto.SHA256,
+		},
+		PropertiesContext: SignedPropertiesContext{
+			Canonicalizer: canonicalizer,
+			Hash:          crypto.SHA256,
+		},
+		Canonicalizer: canonicalizer,
+		Hash:          crypto.SHA256,
+		KeyStore:      *keyStore,
+		XmlDsigPrefix: dsig.DefaultPrefix,
+	}
+	for _, opt := range opts {
+		opt(ctx)
+	}
+	return ctx
+}
+
+// WithHash use hash for the data digest, the SignedProperties digest and the signature
+func WithHash(hash crypto.Hash) Option {
+	return func(ctx *SigningContext) {
+		ctx.DataContext.Hash = hash
+		ctx.PropertiesContext.Hash = hash
+		ctx.Hash = hash
+	}
+}
+
+// WithCanonicalizer use canonicalizer for the signed data, SignedProperties and SignedInfo
+func WithCanonicalizer(canonicalizer dsig.Canonicalizer) Option {
+	return func(ctx *SigningContext) {
+		ctx.DataContext.Canonicalizer = canonicalizer
+		ctx.PropertiesContext.Canonicalizer = canonicalizer
+		ctx.Canonicalizer = canonicalizer
+	}
+}
+
+// WithSigningTime set SigningTime instead of the time of signing
+func WithSigningTime(signingTime time.Time) Option {
+	return func(ctx *SigningContext) {
+		ctx.PropertiesContext.SigninigTime = signingTime
+	}
+}
+
+// WithEnveloped mark the signature as enveloped in the signed data
+func WithEnveloped() Option {
+	return func(ctx *SigningContext) {
+		ctx.DataContext.IsEnveloped = true
+	}
+}
+
+// WithReferenceURI set URI of the data reference
+func WithReferenceURI(uri string) Option {
+	return func(ctx *SigningContext) {
+		ctx.DataContext.ReferenceURI = uri
+	}
+}
+
+// WithSignatureUUID derive element Ids from signatureUuid
+func WithSignatureUUID(signatureUuid uuid.UUID) Option {
+	return func(ctx *SigningContext) {
+		ctx.SignatureUuid = &signatureUuid
+		ctx.UseSignatureUuid = true
+	}
+}
+
+// WithXmlDsigPrefix use prefix for XML DSig elements
+func WithXmlDsigPrefix(prefix string) Option {
+	return func(ctx *SigningContext) {
+		ctx.XmlDsigPrefix = prefix
+	}
+}
+
+// WithClaimedRoles add xades:SignerRole claiming roles
+func WithClaimedRoles(roles ...string) Option {
+	return func(ctx *SigningContext) {
+		ctx.PropertiesContext.ClaimedRoles = roles
+	}
+}
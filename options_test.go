@@ -0,0 +1,36 @@
+package xades
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSigningContext(t *testing.T) {
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+
+	signingTime, err := time.Parse("2006-01-02T15:04:05Z", "2020-01-01T00:00:00Z")
+	require.NoError(t, err)
+
+	ctx := NewSigningContext(keyStore,
+		WithHash(crypto.SHA256),
+		WithEnveloped(),
+		WithReferenceURI("#signedData"),
+		WithSigningTime(signingTime),
+	)
+	require.Equal(t, newTestSigningContext(t), ctx)
+
+	signatureUuid := uuid.MustParse("7837510c-674b-11ee-90e3-000c29c302a8")
+	ctx = NewSigningContext(keyStore, WithHash(crypto.SHA512), WithSignatureUUID(signatureUuid), WithXmlDsigPrefix("dsig"))
+	require.Equal(t, crypto.SHA512, ctx.DataContext.Hash)
+	require.Equal(t, crypto.SHA512, ctx.PropertiesContext.Hash)
+	require.Equal(t, crypto.SHA512, ctx.Hash)
+	require.True(t, ctx.UseSignatureUuid)
+	require.Equal(t, signatureUuid, *ctx.SignatureUuid)
+	require.Equal(t, "dsig", ctx.XmlDsigPrefix)
+	require.False(t, ctx.DataContext.IsEnveloped)
+}
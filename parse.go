@@ -0,0 +1,233 @@
+package xades
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// ParsedSignature is the content of a ds:Signature as read by ParseSignature
+type ParsedSignature struct {
+	Id                     string
+	CanonicalizationMethod string
+	SignatureMethod        string
+	References             []ParsedReference
+	SignatureValue         []byte
+	// Certificates are the ds:X509Certificate of KeyInfo in document order, the signing certificate usually first
+	Certificates []*x509.Certificate
+	// SignedProperties is nil when the signature has no embedded xades:SignedProperties
+	SignedProperties *ParsedSignedProperties
+}
+
+// ParsedReference is a ds:Reference of SignedInfo, Transforms lists the Algorithm of each transform
+type ParsedReference struct {
+	Id           string
+	URI          string
+	Type         string
+	Transforms   []string
+	DigestMethod string
+	DigestValue  []byte
+}
+
+// ParsedSignedProperties is the xades:SignedProperties of a signature, fields of absent properties are zero.
+// The signing certificate is the first xades:Cert of SigningCertificate or SigningCertificateV2
+type ParsedSignedProperties struct {
+	Id               string
+	SigningTime      time.Time
+	CertDigestMethod string
+	CertDigestValue  []byte
+	// IssuerName and SerialNumber come from IssuerSerial of SigningCertificate
+	IssuerName   string
+	SerialNumber *big.Int
+	// IssuerSerialV2 is the DER IssuerSerial of SigningCertificateV2
+	IssuerSerialV2 []byte
+}
+
+// ParseSignature read sig into a ParsedSignature. Nothing is verified, base64 and certificates are decoded and a
+// malformed value is an error
+func ParseSignature(sig *etree.Element) (*ParsedSignature, error) {
+
+	if sig.Tag != dsig.SignatureTag {
+		return nil, fmt.Errorf("xades: expected %v element, got <%v>", dsig.SignatureTag, sig.FullTag())
+	}
+	signedInfo := findChild(sig, dsig.SignedInfoTag)
+	if signedInfo == nil {
+		return nil, errors.New("xades: signature has no SignedInfo")
+	}
+
+	parsed := &ParsedSignature{Id: elementId(sig)}
+	if method := findChild(signedInfo, dsig.CanonicalizationMethodTag); method != nil {
+		parsed.CanonicalizationMethod = method.SelectAttrValue(dsig.AlgorithmAttr, "")
+	}
+	if method := findChild(signedInfo, dsig.SignatureMethodTag); method != nil {
+		parsed.SignatureMethod = method.SelectAttrValue(dsig.AlgorithmAttr, "")
+	}
+	for _, reference := range signedInfo.ChildElements() {
+		if reference.Tag != dsig.ReferenceTag {
+			continue
+		}
+		parsedReference, err := parseReference(reference)
+		if err != nil {
+			return nil, err
+		}
+		parsed.References = append(parsed.References, *parsedReference)
+	}
+
+	var err error
+	if signatureValue := findChild(sig, dsig.SignatureValueTag); signatureValue != nil {
+		if parsed.SignatureValue, err = decodeBase64Text(signatureValue, dsig.SignatureValueTag); err != nil {
+			return nil, err
+		}
+	}
+	if keyInfo := findChild(sig, dsig.KeyInfoTag); keyInfo != nil && findChild(keyInfo, dsig.X509DataTag) != nil {
+		if parsed.Certificates, err = extractKeyInfoCertificates(sig); err != nil {
+			return nil, err
+		}
+	}
+	if qualifyingProperties := findQualifyingProperties(sig); qualifyingProperties != nil {
+		if signedProperties := findChild(qualifyingProperties, SignedPropertiesTag); signedProperties != nil {
+			if parsed.SignedProperties, err = parseSignedProperties(signedProperties); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// SignatureSummary is the audit record of the algorithms a signature was created with, as emitted in the XML
+type SignatureSummary struct {
+	CanonicalizationMethod string
+	SignatureMethod        string
+	// References are the ds:Reference of SignedInfo in document order, the data references and the
+	// SignedProperties reference
+	References []ReferenceSummary
+	// CertDigestMethod and SigningTime are zero when the signature has no SignedProperties or they are absent
+	CertDigestMethod string
+	SigningTime      time.Time
+}
+
+// ReferenceSummary is the URI, Type and the algorithms of a ds:Reference
+type ReferenceSummary struct {
+	URI          string
+	Type         string
+	Transforms   []string
+	DigestMethod string
+}
+
+// Summarize return the SignatureSummary of sig, e.g. the Signature CreateSignature returned, see ParseSignature
+func Summarize(sig *etree.Element) (*SignatureSummary, error) {
+
+	parsed, err := ParseSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	summary := &SignatureSummary{
+		CanonicalizationMethod: parsed.CanonicalizationMethod,
+		SignatureMethod:        parsed.SignatureMethod,
+	}
+	for _, reference := range parsed.References {
+		summary.References = append(summary.References, ReferenceSummary{
+			URI:          reference.URI,
+			Type:         reference.Type,
+			Transforms:   reference.Transforms,
+			DigestMethod: reference.DigestMethod,
+		})
+	}
+	if parsed.SignedProperties != nil {
+		summary.CertDigestMethod = parsed.SignedProperties.CertDigestMethod
+		summary.SigningTime = parsed.SignedProperties.SigningTime
+	}
+	return summary, nil
+}
+
+func parseReference(reference *etree.Element) (*ParsedReference, error) {
+
+	parsed := &ParsedReference{
+		Id:   elementId(reference),
+		URI:  reference.SelectAttrValue(dsig.URIAttr, ""),
+		Type: reference.SelectAttrValue("Type", ""),
+	}
+	if transforms := findChild(reference, dsig.TransformsTag); transforms != nil {
+		for _, transform := range transforms.ChildElements() {
+			parsed.Transforms = append(parsed.Transforms, transform.SelectAttrValue(dsig.AlgorithmAttr, ""))
+		}
+	}
+	if digestMethod := findChild(reference, dsig.DigestMethodTag); digestMethod != nil {
+		parsed.DigestMethod = digestMethod.SelectAttrValue(dsig.AlgorithmAttr, "")
+	}
+	if digestValue := findChild(reference, dsig.DigestValueTag); digestValue != nil {
+		var err error
+		if parsed.DigestValue, err = decodeBase64Text(digestValue, fmt.Sprintf("DigestValue of reference %q", parsed.URI)); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+func parseSignedProperties(signedProperties *etree.Element) (*ParsedSignedProperties, error) {
+
+	parsed := &ParsedSignedProperties{Id: elementId(signedProperties)}
+	if signingTime := findPath(signedProperties, SignedSignaturePropertiesTag, SigningTimeTag); signingTime != nil {
+		var err error
+		if parsed.SigningTime, err = parseSigningTime(signingTime); err != nil {
+			return nil, err
+		}
+	}
+
+	cert := findPath(signedProperties, SignedSignaturePropertiesTag, SigningCertificateTag, CertTag)
+	if cert == nil {
+		cert = findPath(signedProperties, SignedSignaturePropertiesTag, SigningCertificateV2Tag, CertTag)
+	}
+	if cert == nil {
+		return parsed, nil
+	}
+
+	var err error
+	if digestMethod := findPath(cert, CertDigestTag, dsig.DigestMethodTag); digestMethod != nil {
+		parsed.CertDigestMethod = digestMethod.SelectAttrValue(dsig.AlgorithmAttr, "")
+	}
+	if digestValue := findPath(cert, CertDigestTag, dsig.DigestValueTag); digestValue != nil {
+		if parsed.CertDigestValue, err = decodeBase64Text(digestValue, "CertDigest DigestValue"); err != nil {
+			return nil, err
+		}
+	}
+	if issuerName := findPath(cert, IssuerSerialTag, x509IssuerNameTag); issuerName != nil {
+		parsed.IssuerName = strings.TrimSpace(issuerName.Text())
+	}
+	if serialNumber := findPath(cert, IssuerSerialTag, x509SerialNumberTag); serialNumber != nil {
+		var ok bool
+		if parsed.SerialNumber, ok = new(big.Int).SetString(strings.TrimSpace(serialNumber.Text()), 10); !ok {
+			return nil, fmt.Errorf("xades: malformed X509SerialNumber %q", serialNumber.Text())
+		}
+	}
+	if issuerSerialV2 := findChild(cert, IssuerSerialV2Tag); issuerSerialV2 != nil {
+		if parsed.IssuerSerialV2, err = decodeBase64Text(issuerSerialV2, IssuerSerialV2Tag); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+func parseSigningTime(signingTime *etree.Element) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, strings.TrimSpace(signingTime.Text()))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("xades: malformed SigningTime: %v", err)
+	}
+	return parsed, nil
+}
+
+// decodeBase64Text decode the base64 text of el, white space from line wrapping is ignored
+func decodeBase64Text(el *etree.Element, name string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(el.Text()), ""))
+	if err != nil {
+		return nil, fmt.Errorf("xades: %v is not valid base64: %v", name, err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,101 @@
+package xades
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSignature(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	ca := newTestKeyStoreFromTemplate(t, &x509.Certificate{})
+	ctx.KeyStore.CertChain = []*x509.Certificate{ca.Cert}
+	ctx.Base64LineWidth = 64
+	_, signature := signAndReparse(t, testXML, ctx)
+
+	parsed, err := ParseSignature(signature)
+	require.NoError(t, err)
+	require.Equal(t, "Signature", parsed.Id)
+	require.Equal(t, dsig.CanonicalXML10ExclusiveAlgorithmId.String(), parsed.CanonicalizationMethod)
+	require.Equal(t, signatureMethodIdentifiers[crypto.SHA256], parsed.SignatureMethod)
+	require.Len(t, parsed.SignatureValue, ctx.KeyStore.PrivateKey.Size())
+
+	require.Len(t, parsed.References, 2)
+	data := parsed.References[0]
+	require.Equal(t, "#signedData", data.URI)
+	require.Equal(t, []string{dsig.EnvelopedSignatureAltorithmId.String(), dsig.CanonicalXML10ExclusiveAlgorithmId.String()}, data.Transforms)
+	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA256], data.DigestMethod)
+	require.Len(t, data.DigestValue, crypto.SHA256.Size())
+	require.Equal(t, SignedPropertiesType, parsed.References[1].Type)
+
+	require.Len(t, parsed.Certificates, 2)
+	require.Equal(t, ctx.KeyStore.CertBinary, parsed.Certificates[0].Raw)
+	require.Equal(t, ca.CertBinary, parsed.Certificates[1].Raw)
+
+	properties := parsed.SignedProperties
+	require.NotNil(t, properties)
+	require.Equal(t, "#"+properties.Id, parsed.References[1].URI)
+	require.True(t, properties.SigningTime.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA256], properties.CertDigestMethod)
+	require.Equal(t, DigestBytes(ctx.KeyStore.CertBinary, crypto.SHA256), base64.StdEncoding.EncodeToString(properties.CertDigestValue))
+	require.Equal(t, ctx.KeyStore.Cert.Issuer.String(), properties.IssuerName)
+	require.Equal(t, 0, ctx.KeyStore.Cert.SerialNumber.Cmp(properties.SerialNumber))
+	require.Nil(t, properties.IssuerSerialV2)
+
+	ctx.PropertiesContext.UseSigningCertificateV2 = true
+	_, signature = signAndReparse(t, testXML, ctx)
+	parsed, err = ParseSignature(signature)
+	require.NoError(t, err)
+	expected, err := marshalIssuerSerial(ctx.KeyStore.Cert)
+	require.NoError(t, err)
+	require.Equal(t, expected, parsed.SignedProperties.IssuerSerialV2)
+	require.Nil(t, parsed.SignedProperties.SerialNumber)
+
+	signature.SelectElement("ds:" + dsig.SignatureValueTag).SetText("not base64!")
+	_, err = ParseSignature(signature)
+	require.Error(t, err)
+	_, err = ParseSignature(signature.SelectElement("ds:" + dsig.SignedInfoTag))
+	require.Error(t, err)
+}
+
+func TestSummarize(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.Hash = crypto.SHA512
+	ctx.CertDigestHash = crypto.SHA384
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+
+	summary, err := Summarize(signature)
+	require.NoError(t, err)
+	require.Equal(t, dsig.CanonicalXML10ExclusiveAlgorithmId.String(), summary.CanonicalizationMethod)
+	require.Equal(t, signatureMethodIdentifiers[crypto.SHA256], summary.SignatureMethod)
+	require.Equal(t, []ReferenceSummary{
+		{
+			URI:          "#signedData",
+			Transforms:   []string{dsig.EnvelopedSignatureAltorithmId.String(), dsig.CanonicalXML10ExclusiveAlgorithmId.String()},
+			DigestMethod: digestAlgorithmIdentifiers[crypto.SHA256],
+		},
+		{
+			URI:          "#SignedProperties",
+			Type:         SignedPropertiesType,
+			Transforms:   []string{dsig.CanonicalXML10ExclusiveAlgorithmId.String()},
+			DigestMethod: digestAlgorithmIdentifiers[crypto.SHA512],
+		},
+	}, summary.References)
+	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA384], summary.CertDigestMethod)
+	require.True(t, summary.SigningTime.Equal(ctx.PropertiesContext.SigninigTime))
+
+	ctx.PlainXMLDSig = true
+	signature, err = CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	summary, err = Summarize(signature)
+	require.NoError(t, err)
+	require.Len(t, summary.References, 1)
+	require.Empty(t, summary.CertDigestMethod)
+	require.True(t, summary.SigningTime.IsZero())
+}
@@ -0,0 +1,66 @@
+package xades
+
+import (
+	"crypto"
+	"fmt"
+)
+
+// SecurityPolicy restricts the algorithms a SigningContext may use, violations fail signature creation
+type SecurityPolicy struct {
+	// DisallowSHA1 rejects SHA-1 as data, SignedProperties, signature, CertDigest, time-stamp imprint or Manifest digest
+	DisallowSHA1 bool
+}
+
+// checkHashes return error when one of the configured hashes of ctx violates its SecurityPolicy
+func (policy *SecurityPolicy) checkHashes(ctx *SigningContext) error {
+	if err := policy.checkHash(ctx.DataContext.Hash, "data digest"); err != nil {
+		return err
+	}
+	if ctx.Signer != nil {
+		// the Signer announces its SignatureMethod, ctx.Hash is not used
+		if hash, ok := signatureMethodHash(ctx.Signer.SignatureMethod()); ok {
+			if err := policy.checkHash(hash, "signature"); err != nil {
+				return err
+			}
+		}
+	} else if err := policy.checkHash(ctx.Hash, "signature"); err != nil {
+		return err
+	}
+	if ctx.DsigContext != nil {
+		if err := policy.checkHash(ctx.DsigContext.Hash, "signature"); err != nil {
+			return err
+		}
+	}
+	if ctx.PlainXMLDSig {
+		return nil
+	}
+	if err := policy.checkHash(ctx.PropertiesContext.Hash, "SignedProperties digest"); err != nil {
+		return err
+	}
+	if err := policy.checkHash(certDigestHash(ctx), "CertDigest"); err != nil {
+		return err
+	}
+	if signaturePolicy := ctx.PropertiesContext.SignaturePolicy; signaturePolicy != nil {
+		if err := policy.checkHash(signaturePolicy.Hash, "SigPolicyHash"); err != nil {
+			return err
+		}
+	}
+	if tsCtx := ctx.PropertiesContext.AllDataObjectsTimeStamp; tsCtx != nil {
+		if err := policy.checkHash(tsCtx.Hash, "AllDataObjectsTimeStamp imprint"); err != nil {
+			return err
+		}
+	}
+	if tsCtx := ctx.PropertiesContext.IndividualDataObjectsTimeStamp; tsCtx != nil {
+		if err := policy.checkHash(tsCtx.Hash, "IndividualDataObjectsTimeStamp imprint"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (policy *SecurityPolicy) checkHash(hash crypto.Hash, use string) error {
+	if policy.DisallowSHA1 && hash == crypto.SHA1 {
+		return fmt.Errorf("xades: SHA-1 %v is disallowed by the security policy", use)
+	}
+	return nil
+}
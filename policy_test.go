@@ -0,0 +1,62 @@
+package xades
+
+import (
+	"crypto"
+	"testing"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityPolicyDisallowSHA1(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	for use, configure := range map[string]func(ctx *SigningContext){
+		"data digest": func(ctx *SigningContext) { ctx.DataContext.Hash = crypto.SHA1 },
+		"SignedProperties digest": func(ctx *SigningContext) {
+			ctx.PropertiesContext.Hash = crypto.SHA1
+			ctx.CertDigestHash = crypto.SHA256
+		},
+		"signature":  func(ctx *SigningContext) { ctx.Hash = crypto.SHA1 },
+		"CertDigest": func(ctx *SigningContext) { ctx.CertDigestHash = crypto.SHA1 },
+		"AllDataObjectsTimeStamp imprint": func(ctx *SigningContext) {
+			ctx.PropertiesContext.AllDataObjectsTimeStamp = &TimeStampContext{Hash: crypto.SHA1}
+		},
+		"goxmldsig signature": func(ctx *SigningContext) {
+			ctx.DsigContext = &dsig.SigningContext{Hash: crypto.SHA1, KeyStore: &ctx.KeyStore}
+		},
+	} {
+		ctx := newTestSigningContext(t)
+		configure(ctx)
+		if ctx.PropertiesContext.AllDataObjectsTimeStamp == nil {
+			_, err := CreateSignature(signedData, ctx)
+			require.NoError(t, err, use)
+		}
+
+		ctx.SecurityPolicy.DisallowSHA1 = true
+		_, err := CreateSignature(signedData, ctx)
+		require.Error(t, err, use)
+		require.Contains(t, err.Error(), "SHA-1", use)
+	}
+
+	ctx := newTestSigningContext(t)
+	ctx.SecurityPolicy.DisallowSHA1 = true
+	_, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	// with a Signer the policy applies to its SignatureMethod, not to ctx.Hash
+	ctx.Hash = crypto.SHA1
+	ctx.Signer = NewRSASigner(&ctx.KeyStore, crypto.SHA256)
+	_, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	ctx.Hash = crypto.SHA256
+	ctx.Signer = NewRSASigner(&ctx.KeyStore, crypto.SHA1)
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SHA-1")
+	ctx.Signer = nil
+
+	_, err = CreateManifestSignature([]ManifestEntry{{URI: "#signedData", Element: signedData, Hash: crypto.SHA1}}, ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Manifest")
+}
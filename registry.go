@@ -0,0 +1,140 @@
+package xades
+
+import (
+	"crypto"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+// SignerFunc compute the raw signature value of the canonical SignedInfo data with key, for a signature method
+// whose encoding differs from the crypto.Signer convention, e.g. GOST or SM2. hash is SigningContext.Hash
+type SignerFunc func(key crypto.Signer, rand io.Reader, data []byte, hash crypto.Hash) ([]byte, error)
+
+// XSLTFunc apply the XSLT stylesheet to input and return the output octets of the transformation
+type XSLTFunc func(stylesheet []byte, input []byte) ([]byte, error)
+
+// algorithmsMu guards digestAlgorithmIdentifiers, signatureMethodIdentifiers, hashConstructors, signerFuncs and xsltEngine
+var algorithmsMu sync.RWMutex
+
+// hashConstructors implement digest algorithms registered with a constructor, for hashes unknown to package crypto
+var hashConstructors = map[crypto.Hash]func() hash.Hash{}
+
+// signerFuncs compute signatures of registered signature methods, by SignatureMethod algorithm identifier
+var signerFuncs = map[string]SignerFunc{}
+
+// xsltEngine applies the XSLT transform, nil when none is registered
+var xsltEngine XSLTFunc
+
+// RegisterDigestMethod register uri as DigestMethod algorithm identifier of h. newHash implements h, when nil
+// h.New is used, so h must be available from package crypto, otherwise an error is returned. h may be a value of
+// crypto.Hash unused by package crypto, e.g. for GOST R 34.11 or SM3. The built-in SHA-1, SHA-256, SHA-384 and
+// SHA-512 entries may be overridden
+func RegisterDigestMethod(h crypto.Hash, uri string, newHash func() hash.Hash) error {
+	if newHash == nil && !h.Available() {
+		return fmt.Errorf("xades: digest method %q requires a constructor, hash %d is not linked into the binary", uri, h)
+	}
+	// deferred first, so the cached certificate digests are dropped once algorithmsMu is released
+	defer resetCertCache()
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	digestAlgorithmIdentifiers[h] = uri
+	if newHash != nil {
+		hashConstructors[h] = newHash
+	} else {
+		delete(hashConstructors, h)
+	}
+	return nil
+}
+
+// RegisterSignatureMethod register uri as SignatureMethod algorithm identifier used when SigningContext.Hash is h
+func RegisterSignatureMethod(h crypto.Hash, uri string) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	signatureMethodIdentifiers[h] = uri
+}
+
+// RegisterSigner register signer to compute SignatureValue for the SignatureMethod algorithm identifier uri,
+// instead of goxmldsig or the crypto.Signer of the key store. It is passed KeyStore.Signer, or KeyStore.PrivateKey
+func RegisterSigner(uri string, signer SignerFunc) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	signerFuncs[uri] = signer
+}
+
+// RegisterXSLTEngine register engine to apply the XSLT transform when signing with SignedDataContext.XSLTStylesheet
+// and verifying references with the transform. The package ships no XSLT engine, the standard library has none, so
+// engine typically wraps libxslt or an external processor; nil unregisters it
+func RegisterXSLTEngine(engine XSLTFunc) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	xsltEngine = engine
+}
+
+// digestAlgorithmIdentifier return DigestMethod algorithm identifier of h
+func digestAlgorithmIdentifier(h crypto.Hash) (string, bool) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	uri, ok := digestAlgorithmIdentifiers[h]
+	return uri, ok
+}
+
+// digestAlgorithmHash return hash identified by the DigestMethod algorithm
+func digestAlgorithmHash(algorithm string) (crypto.Hash, error) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	for h, identifier := range digestAlgorithmIdentifiers {
+		if identifier == algorithm {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("xades: unsupported digest algorithm %q", algorithm)
+}
+
+// hashSignatureMethodIdentifier return SignatureMethod algorithm identifier registered for h
+func hashSignatureMethodIdentifier(h crypto.Hash) string {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	return signatureMethodIdentifiers[h]
+}
+
+// signatureMethodHash return the hash of the SignatureMethod algorithm identifier uri, false when uri is unknown
+// or, as Ed25519, has no separate digest
+func signatureMethodHash(uri string) (crypto.Hash, bool) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	for _, identifiers := range []map[crypto.Hash]string{signatureMethodIdentifiers, ecdsaSignatureMethodIdentifiers} {
+		for h, identifier := range identifiers {
+			if identifier == uri {
+				return h, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// registeredSigner return SignerFunc registered for the SignatureMethod algorithm identifier uri, nil if none
+func registeredSigner(uri string) SignerFunc {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	return signerFuncs[uri]
+}
+
+// registeredXSLTEngine return the XSLTFunc registered by RegisterXSLTEngine, nil if none
+func registeredXSLTEngine() XSLTFunc {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	return xsltEngine
+}
+
+// newHash return a new hash.Hash computing h, from its registered constructor or package crypto
+func newHash(h crypto.Hash) hash.Hash {
+	algorithmsMu.RLock()
+	newHash, ok := hashConstructors[h]
+	algorithmsMu.RUnlock()
+	if ok {
+		return newHash()
+	}
+	return h.New()
+}
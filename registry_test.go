@@ -0,0 +1,97 @@
+package xades
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"io"
+	"testing"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+// testCustomHash stands for a national digest unknown to package crypto, computed here as SHA-256 of the reversed input
+const testCustomHash = crypto.Hash(100)
+
+type reversedHash struct {
+	data []byte
+}
+
+func (h *reversedHash) Write(p []byte) (int, error) {
+	h.data = append(h.data, p...)
+	return len(p), nil
+}
+
+func (h *reversedHash) Sum(b []byte) []byte {
+	reversed := make([]byte, len(h.data))
+	for i, c := range h.data {
+		reversed[len(h.data)-1-i] = c
+	}
+	sum := sha256.Sum256(reversed)
+	return append(b, sum[:]...)
+}
+
+func (h *reversedHash) Reset()         { h.data = nil }
+func (h *reversedHash) Size() int      { return sha256.Size }
+func (h *reversedHash) BlockSize() int { return sha256.BlockSize }
+
+func TestRegisterAlgorithms(t *testing.T) {
+	const digestURI = "urn:test:digest"
+	const signatureURI = "urn:test:signature"
+
+	require.Error(t, RegisterDigestMethod(testCustomHash, digestURI, nil))
+	require.NoError(t, RegisterDigestMethod(testCustomHash, digestURI, func() hash.Hash { return &reversedHash{} }))
+	RegisterSignatureMethod(testCustomHash, signatureURI)
+	var signed []byte
+	RegisterSigner(signatureURI, func(key crypto.Signer, rand io.Reader, data []byte, h crypto.Hash) ([]byte, error) {
+		require.Equal(t, testCustomHash, h)
+		signed = data
+		digest := DigestBytes(data, h)
+		return []byte(digest), nil
+	})
+	defer func() {
+		algorithmsMu.Lock()
+		delete(digestAlgorithmIdentifiers, testCustomHash)
+		delete(signatureMethodIdentifiers, testCustomHash)
+		delete(hashConstructors, testCustomHash)
+		delete(signerFuncs, signatureURI)
+		algorithmsMu.Unlock()
+	}()
+
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.Hash = testCustomHash
+	ctx.PropertiesContext.Hash = testCustomHash
+	ctx.Hash = testCustomHash
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	signedInfo := signature.SelectElement("ds:" + dsig.SignedInfoTag)
+	require.Equal(t, signatureURI, signedInfo.SelectElement("ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+	reference := signedInfo.SelectElement("ds:" + dsig.ReferenceTag)
+	require.Equal(t, digestURI, reference.SelectElement("ds:"+dsig.DigestMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	canonical, err := ctx.DataContext.Canonicalizer.Canonicalize(signedData.Copy())
+	require.NoError(t, err)
+	h := &reversedHash{}
+	h.Write(canonical)
+	require.Equal(t, base64.StdEncoding.EncodeToString(h.Sum(nil)), reference.SelectElement("ds:"+dsig.DigestValueTag).Text())
+
+	canonicalSignedInfo, err := canonicalizeInContext(ctx.Canonicalizer, signedInfo)
+	require.NoError(t, err)
+	require.Equal(t, canonicalSignedInfo, signed)
+	require.Equal(t, base64.StdEncoding.EncodeToString([]byte(DigestBytes(signed, testCustomHash))), signature.SelectElement("ds:"+dsig.SignatureValueTag).Text())
+
+	hashAlgorithm, err := digestAlgorithmHash(digestURI)
+	require.NoError(t, err)
+	require.Equal(t, testCustomHash, hashAlgorithm)
+
+	_, err = (&VerifyContext{}).Verify(signature, signedData)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), signatureURI)
+
+	require.Equal(t, signatureMethodIdentifiers[crypto.SHA256], hashSignatureMethodIdentifier(crypto.SHA256))
+}
@@ -0,0 +1,174 @@
+package xades
+
+import (
+	"errors"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// ErrNotChecked is the outcome of a check of VerificationReport that could not run because a check it depends on failed
+var ErrNotChecked = errors.New("xades: not checked, a check it depends on failed")
+
+// VerificationReport hold the outcome of every check of VerifyContext.Report, a nil error is a passed or not
+// applicable check. VerificationResult is filled as far as the checks went
+type VerificationReport struct {
+	VerificationResult
+	// Valid tells whether every check passed, Verify then succeeds
+	Valid bool
+	// Algorithms is the check of the allow-lists of VerifyContext
+	Algorithms error
+	// DataReferences is the first failed digest of the data references, an error when SignedInfo has none
+	DataReferences error
+	// SignedPropertiesReference is the digest of the SignedProperties reference, nil without one
+	SignedPropertiesReference error
+	// VerifyingCertificate is the selection of TrustedCert or of the signing certificate of KeyInfo
+	VerifyingCertificate error
+	// SignatureValue is the check of SignatureValue over SignedInfo with the public key of Certificate, or with
+	// VerifyContext.HMACKey whose report carries no certificate checks
+	SignatureValue error
+	// CertDigest and IssuerSerial are the checks of the SigningCertificate property against Certificate,
+	// nil without a SignedProperties reference
+	CertDigest   error
+	IssuerSerial error
+	// Validity is the validity of Certificate at ReferenceTime, with CheckValidityAtSigningTime only
+	Validity error
+	// CertificatePath is the check of the path from Certificate to VerifyContext.RootCAs, with RootCAs only
+	CertificatePath error
+	// SignatureTimeStamp is the check of the imprint of the xades:SignatureTimeStamp and, with
+	// VerifyContext.TimeStampRoots, of its token signature, nil without one
+	SignatureTimeStamp error
+}
+
+// Err return the error of the first failed check in the order of the fields, nil when the report is Valid
+func (report *VerificationReport) Err() error {
+	for _, err := range report.checks() {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyErr return the error of the first failed check of Verify, all but SignatureTimeStamp which comes last
+func (report *VerificationReport) verifyErr() error {
+	checks := report.checks()
+	for _, err := range checks[:len(checks)-1] {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (report *VerificationReport) checks() []error {
+	return []error{report.Algorithms, report.DataReferences, report.SignedPropertiesReference, report.VerifyingCertificate,
+		report.SignatureValue, report.CertDigest, report.IssuerSerial, report.Validity, report.CertificatePath, report.SignatureTimeStamp}
+}
+
+// Report run each check of Verify on sig over signedData independently of the others and return their outcome, so a
+// tampered digest is told apart from, e.g., a certificate that is not valid at the signing time. Verify returns the
+// first failed check of the report. A present SignatureTimeStamp is also checked, which Verify does only to take
+// the reference time from
+func (ctx *VerifyContext) Report(sig *etree.Element, signedData *etree.Element) *VerificationReport {
+
+	report := &VerificationReport{}
+	signedInfo := findChild(sig, dsig.SignedInfoTag)
+	if signedInfo == nil {
+		err := errors.New("xades: signature has no SignedInfo")
+		report.Algorithms, report.DataReferences, report.SignedPropertiesReference, report.SignatureValue = err, err, err, err
+	} else {
+		report.Algorithms = ctx.checkAlgorithms(signedInfo)
+		dataReferences := 0
+		for _, reference := range signedInfo.ChildElements() {
+			if reference.Tag != dsig.ReferenceTag {
+				continue
+			}
+			err := verifyReference(reference, sig, signedData, ctx.ResolveURI)
+			if isSignedPropertiesReference(reference, sig) {
+				if report.SignedPropertiesReference == nil {
+					report.SignedPropertiesReference = err
+				}
+				continue
+			}
+			dataReferences++
+			if report.DataReferences == nil {
+				report.DataReferences = err
+			}
+		}
+		if dataReferences == 0 {
+			// a signature digesting nothing but its own properties does not bind signedData
+			report.DataReferences = errors.New("xades: SignedInfo has no data reference")
+		}
+	}
+
+	if ctx.HMACKey != nil {
+		if signedInfo != nil {
+			report.SignatureValue = verifyHMACSignatureValue(sig, signedInfo, ctx.HMACKey)
+		}
+		if ctx.CheckValidityAtSigningTime {
+			report.Validity = errors.New("xades: CheckValidityAtSigningTime requires a certificate, HMACKey has none")
+		}
+		if ctx.RootCAs != nil {
+			report.CertificatePath = errors.New("xades: RootCAs requires a certificate, HMACKey has none")
+		}
+		report.Valid = report.Err() == nil
+		return report
+	}
+
+	keyInfoCert, err := ExtractSigningCertificate(sig)
+	if err == nil {
+		report.KeyInfoCertificate = keyInfoCert
+	}
+	if ctx.TrustedCert != nil {
+		report.Certificate = ctx.TrustedCert
+		report.KeyInfoMatchesTrustedCert = keyInfoCert != nil && keyInfoCert.Equal(ctx.TrustedCert)
+	} else if keyInfoCert != nil {
+		report.Certificate = keyInfoCert
+	} else {
+		report.VerifyingCertificate = err
+	}
+
+	if report.Certificate == nil {
+		report.SignatureValue, report.CertDigest, report.IssuerSerial = ErrNotChecked, ErrNotChecked, ErrNotChecked
+		if ctx.CheckValidityAtSigningTime {
+			report.Validity = ErrNotChecked
+		}
+		if ctx.RootCAs != nil {
+			report.CertificatePath = ErrNotChecked
+		}
+	} else {
+		if signedInfo != nil {
+			report.SignatureValue = verifySignatureValue(sig, signedInfo, report.Certificate)
+		}
+		if ctx.CheckValidityAtSigningTime {
+			report.ReferenceTime, report.Validity = ctx.checkValidityAtReferenceTime(sig, report.Certificate)
+		}
+		if ctx.RootCAs != nil {
+			report.ReferenceTime, report.Chains, report.CertificatePath = ctx.verifyCertificatePath(sig, report.Certificate, report.ReferenceTime)
+		}
+		if signedInfo == nil {
+			report.CertDigest, report.IssuerSerial = ErrNotChecked, ErrNotChecked
+		} else if hasSignedPropertiesReference(signedInfo, sig) {
+			report.CertDigest = checkCertDigest(sig, report.Certificate)
+			certRef, signingCertificateTag := findSigningCertificateRef(sig, report.Certificate)
+			if certRef == nil {
+				report.IssuerSerial = ErrNotChecked
+			} else {
+				report.IssuerSerial = checkIssuerSerial(certRef, signingCertificateTag, report.Certificate)
+			}
+		}
+	}
+
+	if qualifyingProperties := findQualifyingProperties(sig); qualifyingProperties != nil &&
+		findPath(qualifyingProperties, UnsignedPropertiesTag, UnsignedSignaturePropertiesTag, SignatureTimeStampTag) != nil {
+		if ctx.TimeStampRoots != nil {
+			_, report.SignatureTimeStamp = verifyTrustedSignatureTimeStamp(sig, ctx.TimeStampRoots)
+		} else {
+			_, report.SignatureTimeStamp = VerifySignatureTimeStamp(sig)
+		}
+	}
+
+	report.Valid = report.Err() == nil
+	return report
+}
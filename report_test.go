@@ -0,0 +1,80 @@
+package xades
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerificationReport(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	keyStore := newTestKeyStoreFromTemplate(t, &x509.Certificate{
+		NotBefore: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	ctx.KeyStore = *keyStore
+	ctx.PropertiesContext.SigninigTime = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	verifyCtx := &VerifyContext{CheckValidityAtSigningTime: true}
+
+	root, signature := signAndReparse(t, testXML, ctx)
+	report := verifyCtx.Report(signature, root)
+	require.True(t, report.Valid)
+	require.NoError(t, report.Err())
+	require.Equal(t, keyStore.Cert.Raw, report.Certificate.Raw)
+	require.True(t, ctx.PropertiesContext.SigninigTime.Equal(report.ReferenceTime))
+
+	root.SelectElement("xid").SetText("tampered")
+	report = verifyCtx.Report(signature, root)
+	require.False(t, report.Valid)
+	require.Error(t, report.DataReferences)
+	require.NoError(t, report.SignedPropertiesReference)
+	require.NoError(t, report.SignatureValue)
+	require.NoError(t, report.CertDigest)
+	require.NoError(t, report.Validity)
+	_, err := verifyCtx.Verify(signature, root)
+	require.Equal(t, err, report.Err())
+
+	ctx.PropertiesContext.SigninigTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	root, signature = signAndReparse(t, testXML, ctx)
+	require.NoError(t, AddSignatureTimeStamp(context.Background(), signature, &TimeStampContext{
+		Client:        &derTimestampClient{genTime: time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC)},
+		Hash:          crypto.SHA256,
+		Canonicalizer: dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""),
+	}))
+	report = verifyCtx.Report(signature, root)
+	require.False(t, report.Valid)
+	require.Contains(t, report.Validity.Error(), "validity period")
+	require.NoError(t, report.SignatureTimeStamp)
+	for _, err := range []error{report.Algorithms, report.DataReferences, report.SignedPropertiesReference, report.SignatureValue, report.CertDigest, report.IssuerSerial} {
+		require.NoError(t, err)
+	}
+
+	other := newTestKeyStoreFromTemplate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Other certificate"}})
+	report = (&VerifyContext{TrustedCert: other.Cert, AllowedDigestMethods: []string{digestAlgorithmIdentifiers[crypto.SHA512]}}).Report(signature, root)
+	require.False(t, report.Valid)
+	require.Error(t, report.Algorithms)
+	require.NoError(t, report.DataReferences)
+	require.NoError(t, report.SignatureValue)
+	require.Error(t, report.CertDigest)
+	require.Equal(t, ErrNotChecked, report.IssuerSerial)
+
+	signatureValue := findChild(signature, dsig.SignatureValueTag)
+	signatureValue.SetText("AAAA" + signatureValue.Text()[4:])
+	report = (&VerifyContext{}).Report(signature, root)
+	require.Error(t, report.SignatureValue)
+	require.NoError(t, report.DataReferences)
+	require.NoError(t, report.CertDigest)
+	require.NoError(t, report.IssuerSerial)
+
+	findChild(signature, dsig.KeyInfoTag).Child = nil
+	report = (&VerifyContext{}).Report(signature, root)
+	require.Error(t, report.VerifyingCertificate)
+	require.Equal(t, ErrNotChecked, report.SignatureValue)
+	require.Equal(t, ErrNotChecked, report.CertDigest)
+}
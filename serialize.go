@@ -0,0 +1,64 @@
+package xades
+
+import (
+	"strings"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const serializeIndent = "  "
+
+// SerializeSignature serialize signature element, with indent the element is pretty-printed
+// except for SignedInfo and the elements a ds:Reference of SignedInfo or of a ds:Manifest points at, e.g.
+// SignedProperties, a signed KeyInfo or an enveloped ds:Object, whose content is covered by a digest and is written
+// verbatim. The passed element is never modified.
+func SerializeSignature(sig *etree.Element, indent bool) (string, error) {
+	signature := sig.Copy()
+	if indent {
+		indentElement(signature, 0, referencedIds(signature))
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(signature)
+	return doc.WriteToString()
+}
+
+// referencedIds return the Ids that the same-document ds:Reference elements below el point at
+func referencedIds(el *etree.Element) map[string]bool {
+	ids := map[string]bool{}
+	for _, reference := range el.FindElements(".//" + dsig.ReferenceTag) {
+		if id, _ := referenceURIId(reference.SelectAttrValue(dsig.URIAttr, "")); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// isDigestedElement report whether whitespace inside el would change a digest of the signature, ids are the
+// Ids its references point at
+func isDigestedElement(el *etree.Element, ids map[string]bool) bool {
+	if el.Tag == dsig.SignedInfoTag || el.Tag == SignedPropertiesTag {
+		return true
+	}
+	id := elementId(el)
+	return id != "" && ids[id]
+}
+
+// indentElement insert indentation between child elements of el, skipping digested sub-trees and mixed content
+func indentElement(el *etree.Element, depth int, ids map[string]bool) {
+	if isDigestedElement(el, ids) || len(el.ChildElements()) == 0 {
+		return
+	}
+	for _, token := range el.Child {
+		if _, ok := token.(*etree.Element); !ok {
+			return
+		}
+	}
+
+	for _, child := range el.ChildElements() {
+		el.InsertChildAt(child.Index(), etree.NewText("\n"+strings.Repeat(serializeIndent, depth+1)))
+		indentElement(child, depth+1, ids)
+	}
+	el.AddChild(etree.NewText("\n" + strings.Repeat(serializeIndent, depth)))
+}
@@ -0,0 +1,74 @@
+package xades
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerializeSignature(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	original, err := SerializeSignature(signature, false)
+	require.NoError(t, err)
+
+	indented, err := SerializeSignature(signature, true)
+	require.NoError(t, err)
+	require.NotEqual(t, original, indented)
+	require.Contains(t, indented, "\n  <ds:SignedInfo>")
+
+	compact, err := SerializeSignature(signature, false)
+	require.NoError(t, err)
+	require.Equal(t, original, compact)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(indented))
+	originalDoc := etree.NewDocument()
+	require.NoError(t, originalDoc.ReadFromString(original))
+
+	for _, path := range []string{"ds:" + dsig.SignedInfoTag, "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag} {
+		expected, err := canonicalizeInContext(ctx.Canonicalizer, originalDoc.Root().FindElement(path))
+		require.NoError(t, err)
+		actual, err := canonicalizeInContext(ctx.Canonicalizer, doc.Root().FindElement(path))
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(actual))
+	}
+}
+
+func TestSerializeSignatureKeepsReferencedElements(t *testing.T) {
+	reparse := func(signature *etree.Element) *etree.Element {
+		indented, err := SerializeSignature(signature, true)
+		require.NoError(t, err)
+		doc := etree.NewDocument()
+		require.NoError(t, doc.ReadFromString(indented))
+		return doc.Root()
+	}
+
+	// the SRI preset signs KeyInfo
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(`<factura id="comprobante"><infoTributaria><ambiente>1</ambiente></infoTributaria></factura>`))
+	signature, err := SignElementByID(doc, SRIComprobanteId, SRIPreset(keyStore))
+	require.NoError(t, err)
+	indented := reparse(signature)
+	require.Equal(t, "\n  ", indented.Child[0].(*etree.CharData).Data)
+	doc.Root().RemoveChild(signature)
+	doc.Root().AddChild(indented)
+	_, err = (&VerifyContext{}).Verify(indented, doc.Root())
+	require.NoError(t, err)
+
+	// the data of an enveloping signature is a ds:Object
+	data := etree.NewElement("data")
+	data.CreateElement("value").SetText("1")
+	signature, err = CreateEnvelopingSignature(data, "payload", newTestSigningContext(t))
+	require.NoError(t, err)
+	indented = reparse(signature)
+	_, err = (&VerifyContext{}).Verify(indented, indented)
+	require.NoError(t, err)
+}
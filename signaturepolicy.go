@@ -0,0 +1,185 @@
+package xades
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	Prefix141    string = "xades141"
+	Namespace141 string = "http://uri.etsi.org/01903/v1.4.1#"
+)
+
+const (
+	SignaturePolicyIdentifierTag string = "SignaturePolicyIdentifier"
+	SignaturePolicyIdTag         string = "SignaturePolicyId"
+	SigPolicyIdTag               string = "SigPolicyId"
+	IdentifierTag                string = "Identifier"
+	DescriptionTag               string = "Description"
+	SigPolicyHashTag             string = "SigPolicyHash"
+	SigPolicyQualifiersTag       string = "SigPolicyQualifiers"
+	SigPolicyQualifierTag        string = "SigPolicyQualifier"
+	SPURITag                     string = "SPURI"
+	SignaturePolicyStoreTag      string = "SignaturePolicyStore"
+	SPDocSpecificationTag        string = "SPDocSpecification"
+	SignaturePolicyDocumentTag   string = "SignaturePolicyDocument"
+	SigPolDocLocalURITag         string = "SigPolDocLocalURI"
+)
+
+// SignaturePolicy identify the explicit signature policy of xades:SignaturePolicyIdentifier
+type SignaturePolicy struct {
+	// Identifier of the policy, e.g. "urn:oid:1.2.3" with Qualifier "OIDAsURN"; Qualifier is omitted when empty
+	Identifier  string
+	Qualifier   string
+	Description string
+	// Document is the policy document, SigPolicyHash is its digest with Hash
+	Document []byte
+	Hash     crypto.Hash
+	// Digest is the base64 SigPolicyHash digest value with Hash, published by the policy issuer, used instead of
+	// the digest of Document when set
+	Digest string
+	// SPURI is the location of the policy document, omitted when empty
+	SPURI string
+}
+
+// createSignaturePolicyIdentifier create xades:SignaturePolicyIdentifier/SignaturePolicyId of policy
+func createSignaturePolicyIdentifier(policy *SignaturePolicy, xmlDsigPrefix string) (*etree.Element, error) {
+
+	if policy.Identifier == "" {
+		return nil, errors.New("xades: SignaturePolicy requires an Identifier")
+	}
+	if _, ok := digestAlgorithmIdentifier(policy.Hash); !ok {
+		return nil, fmt.Errorf("xades: unsupported digest algorithm %v for SigPolicyHash", policy.Hash)
+	}
+
+	signaturePolicyIdentifier := etree.Element{
+		Space: Prefix,
+		Tag:   SignaturePolicyIdentifierTag,
+	}
+	signaturePolicyId := signaturePolicyIdentifier.CreateElement(SignaturePolicyIdTag)
+	signaturePolicyId.Space = Prefix
+	signaturePolicyId.AddChild(createObjectIdentifier(SigPolicyIdTag, Prefix, policy.Identifier, policy.Qualifier, policy.Description))
+	if policy.Digest != "" {
+		signaturePolicyId.AddChild(createDigestAlgAndDigestValue(SigPolicyHashTag, policy.Digest, policy.Hash, xmlDsigPrefix))
+	} else {
+		signaturePolicyId.AddChild(createDigestAlgAndValue(SigPolicyHashTag, policy.Document, policy.Hash, xmlDsigPrefix))
+	}
+
+	if policy.SPURI != "" {
+		qualifiers := signaturePolicyId.CreateElement(SigPolicyQualifiersTag)
+		qualifiers.Space = Prefix
+		qualifier := qualifiers.CreateElement(SigPolicyQualifierTag)
+		qualifier.Space = Prefix
+		spuri := qualifier.CreateElement(SPURITag)
+		spuri.Space = Prefix
+		spuri.SetText(policy.SPURI)
+	}
+	return &signaturePolicyIdentifier, nil
+}
+
+// createObjectIdentifier create an element of the xades ObjectIdentifierType in namespace prefix space
+func createObjectIdentifier(tag string, space string, identifier string, qualifier string, description string) *etree.Element {
+
+	objectIdentifier := etree.Element{
+		Space: space,
+		Tag:   tag,
+	}
+	identifierElement := objectIdentifier.CreateElement(IdentifierTag)
+	identifierElement.Space = Prefix
+	if qualifier != "" {
+		identifierElement.CreateAttr("Qualifier", qualifier)
+	}
+	identifierElement.SetText(identifier)
+	if description != "" {
+		descriptionElement := objectIdentifier.CreateElement(DescriptionTag)
+		descriptionElement.Space = Prefix
+		descriptionElement.SetText(description)
+	}
+	return &objectIdentifier
+}
+
+// SignaturePolicyStoreContext configure the XAdES 1.4.1 SignaturePolicyStore property
+type SignaturePolicyStoreContext struct {
+	// SPDocSpecification identifies the technical specification of the policy document, e.g. an OID URN
+	SPDocSpecification string
+	// Document is the policy document embedded as SignaturePolicyDocument, it must match SigPolicyHash
+	Document []byte
+	// LocalURI references a local copy of the policy document as SigPolDocLocalURI, when Document is nil
+	LocalURI string
+}
+
+// AddSignaturePolicyStore add xades141:SignaturePolicyStore to the UnsignedSignatureProperties of signature,
+// which must identify its policy by SignaturePolicyIdentifier/SignaturePolicyId
+func AddSignaturePolicyStore(signature *etree.Element, storeCtx *SignaturePolicyStoreContext) error {
+
+	if storeCtx.SPDocSpecification == "" {
+		return errors.New("xades: SignaturePolicyStore requires an SPDocSpecification")
+	}
+	if (storeCtx.Document == nil) == (storeCtx.LocalURI == "") {
+		return errors.New("xades: SignaturePolicyStore requires either the policy Document or its LocalURI")
+	}
+
+	var signaturePolicyId *etree.Element
+	if qualifyingProperties := findQualifyingProperties(signature); qualifyingProperties != nil {
+		if signedProperties := findChild(qualifyingProperties, SignedPropertiesTag); signedProperties != nil {
+			signaturePolicyId = findPath(signedProperties, SignedSignaturePropertiesTag, SignaturePolicyIdentifierTag, SignaturePolicyIdTag)
+		}
+	}
+	if signaturePolicyId == nil {
+		return errors.New("xades: signature has no SignaturePolicyId to store the policy document of")
+	}
+	if storeCtx.Document != nil {
+		if err := checkSigPolicyHash(signaturePolicyId, storeCtx.Document); err != nil {
+			return err
+		}
+	}
+
+	signaturePolicyStore := etree.Element{
+		Space: Prefix141,
+		Tag:   SignaturePolicyStoreTag,
+		Attr: []etree.Attr{
+			{Space: "xmlns", Key: Prefix141, Value: Namespace141},
+		},
+	}
+	signaturePolicyStore.AddChild(createObjectIdentifier(SPDocSpecificationTag, Prefix141, storeCtx.SPDocSpecification, "", ""))
+	if storeCtx.Document != nil {
+		document := signaturePolicyStore.CreateElement(SignaturePolicyDocumentTag)
+		document.Space = Prefix141
+		document.SetText(base64.StdEncoding.EncodeToString(storeCtx.Document))
+	} else {
+		localURI := signaturePolicyStore.CreateElement(SigPolDocLocalURITag)
+		localURI.Space = Prefix141
+		localURI.SetText(storeCtx.LocalURI)
+	}
+
+	unsignedSignatureProperties, err := findOrCreateUnsignedSignatureProperties(signature)
+	if err != nil {
+		return err
+	}
+	unsignedSignatureProperties.AddChild(&signaturePolicyStore)
+	return nil
+}
+
+// checkSigPolicyHash return error when the SigPolicyHash of signaturePolicyId is not the digest of document
+func checkSigPolicyHash(signaturePolicyId *etree.Element, document []byte) error {
+
+	digestMethod := findPath(signaturePolicyId, SigPolicyHashTag, dsig.DigestMethodTag)
+	digestValue := findPath(signaturePolicyId, SigPolicyHashTag, dsig.DigestValueTag)
+	if digestMethod == nil || digestValue == nil {
+		return errors.New("xades: SignaturePolicyId has no SigPolicyHash")
+	}
+	hash, err := digestAlgorithmHash(digestMethod.SelectAttrValue(dsig.AlgorithmAttr, ""))
+	if err != nil {
+		return err
+	}
+	if DigestBytes(document, hash) != strings.TrimSpace(digestValue.Text()) {
+		return errors.New("xades: policy document does not match SigPolicyHash")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package xades
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignaturePolicyStore(t *testing.T) {
+	policyDocument := []byte("<policy>signature policy</policy>")
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.SignaturePolicy = &SignaturePolicy{
+		Identifier: "urn:oid:1.2.3.4",
+		Qualifier:  "OIDAsURN",
+		Document:   policyDocument,
+		Hash:       crypto.SHA256,
+		SPURI:      "https://example.com/policy.xml",
+	}
+	signedData := newTestSignedData(t)
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+
+	signedSignatureProperties := findPath(findQualifyingProperties(signature), SignedPropertiesTag, SignedSignaturePropertiesTag)
+	children := signedSignatureProperties.ChildElements()
+	require.Len(t, children, 3)
+	require.Equal(t, SignaturePolicyIdentifierTag, children[2].Tag)
+	signaturePolicyId := findChild(children[2], SignaturePolicyIdTag)
+	identifier := findPath(signaturePolicyId, SigPolicyIdTag, IdentifierTag)
+	require.Equal(t, "urn:oid:1.2.3.4", identifier.Text())
+	require.Equal(t, "OIDAsURN", identifier.SelectAttrValue("Qualifier", ""))
+	require.Equal(t, DigestBytes(policyDocument, crypto.SHA256), findPath(signaturePolicyId, SigPolicyHashTag, dsig.DigestValueTag).Text())
+	require.Equal(t, "https://example.com/policy.xml", findPath(signaturePolicyId, SigPolicyQualifiersTag, SigPolicyQualifierTag, SPURITag).Text())
+
+	require.Error(t, AddSignaturePolicyStore(signature, &SignaturePolicyStoreContext{SPDocSpecification: "urn:oid:1.2", Document: []byte("other")}))
+	require.Error(t, AddSignaturePolicyStore(signature, &SignaturePolicyStoreContext{SPDocSpecification: "urn:oid:1.2"}))
+
+	tsCtx := &TimeStampContext{
+		Client:        &fakeTimestampClient{},
+		Hash:          crypto.SHA256,
+		Canonicalizer: dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""),
+		SignedData:    signedData,
+	}
+	err = NewUnsignedPropertiesBuilder(signature).
+		ArchiveTimeStamp(tsCtx).
+		SignaturePolicyStore(&SignaturePolicyStoreContext{SPDocSpecification: "urn:oid:1.2.5", Document: policyDocument}).
+		SignatureTimeStamp(tsCtx).
+		Build(context.Background())
+	require.NoError(t, err)
+
+	unsignedSignatureProperties := signature.FindElement(unsignedSignaturePropertiesPath("ds"))
+	var tags []string
+	for _, child := range unsignedSignatureProperties.ChildElements() {
+		tags = append(tags, child.Tag)
+	}
+	require.Equal(t, []string{SignatureTimeStampTag, SignaturePolicyStoreTag, ArchiveTimeStampTag}, tags)
+
+	doc := etree.NewDocument()
+	doc.SetRoot(newTestSignedData(t))
+	require.NoError(t, AppendSignature(doc.Root(), signature))
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+	store := parsed.Root().FindElement("ds:" + dsig.SignatureTag + "/ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" +
+		UnsignedPropertiesTag + "/" + Prefix + ":" + UnsignedSignaturePropertiesTag + "/" + Prefix141 + ":" + SignaturePolicyStoreTag)
+	require.NotNil(t, store)
+	require.Equal(t, Namespace141, store.NamespaceURI())
+	specIdentifier := findPath(store, SPDocSpecificationTag, IdentifierTag)
+	require.Equal(t, Namespace, specIdentifier.NamespaceURI())
+	require.Equal(t, "urn:oid:1.2.5", specIdentifier.Text())
+	require.Equal(t, base64.StdEncoding.EncodeToString(policyDocument), findChild(store, SignaturePolicyDocumentTag).Text())
+	_, err = (&VerifyContext{}).Verify(parsed.Root().SelectElement("ds:"+dsig.SignatureTag), parsed.Root())
+	require.NoError(t, err)
+
+	signature, err = CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.NoError(t, AddSignaturePolicyStore(signature, &SignaturePolicyStoreContext{SPDocSpecification: "urn:oid:1.2.5", LocalURI: "policy.xml"}))
+	require.Equal(t, "policy.xml", signature.FindElement(unsignedSignaturePropertiesPath("ds")+"/"+Prefix141+":"+SignaturePolicyStoreTag+"/"+Prefix141+":"+SigPolDocLocalURITag).Text())
+
+	ctx.PropertiesContext.SignaturePolicy = nil
+	signature, err = CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Error(t, AddSignaturePolicyStore(signature, &SignaturePolicyStoreContext{SPDocSpecification: "urn:oid:1.2.5", LocalURI: "policy.xml"}))
+}
@@ -0,0 +1,37 @@
+package xades
+
+import (
+	"crypto"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// Signer computes the SignatureValue of a signature, see SigningContext.Signer. It is the seam to replace the
+// signing backend, e.g. by a fake in tests or a remote signing service
+type Signer interface {
+	// SignatureMethod return the SignatureMethod algorithm identifier written in SignedInfo
+	SignatureMethod() string
+	// CanonicalizeAndSign return the base64 SignatureValue of signedInfo canonicalized with canonicalizer
+	CanonicalizeAndSign(signedInfo *etree.Element, canonicalizer *dsig.Canonicalizer) (base64encoded string, err error)
+}
+
+// NewRSASigner create Signer computing RSA PKCS #1 v1.5 signatures with hash and the PrivateKey of keyStore,
+// as a SigningContext does without Signer
+func NewRSASigner(keyStore *MemoryX509KeyStore, hash crypto.Hash) Signer {
+	return &rsaSigner{keyStore: keyStore, hash: hash}
+}
+
+// rsaSigner is the Signer of NewRSASigner
+type rsaSigner struct {
+	keyStore *MemoryX509KeyStore
+	hash     crypto.Hash
+}
+
+func (s *rsaSigner) SignatureMethod() string {
+	return hashSignatureMethodIdentifier(s.hash)
+}
+
+func (s *rsaSigner) CanonicalizeAndSign(signedInfo *etree.Element, canonicalizer *dsig.Canonicalizer) (string, error) {
+	return SignatureValue(signedInfo, canonicalizer, s.hash, s.keyStore)
+}
@@ -0,0 +1,53 @@
+package xades
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+type constantSigner struct {
+	method string
+	signed []byte
+}
+
+func (s *constantSigner) SignatureMethod() string {
+	return s.method
+}
+
+func (s *constantSigner) CanonicalizeAndSign(signedInfo *etree.Element, canonicalizer *dsig.Canonicalizer) (string, error) {
+	canonical, err := (*canonicalizer).Canonicalize(signedInfo)
+	s.signed = canonical
+	return base64.StdEncoding.EncodeToString([]byte("signature")), err
+}
+
+func TestSigner(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	expected, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+
+	// the default signature is the one of NewRSASigner, PKCS #1 v1.5 is deterministic
+	ctx.Signer = NewRSASigner(&ctx.KeyStore, ctx.Hash)
+	signature, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Equal(t, expected.SelectElement("ds:"+dsig.SignatureValueTag).Text(), signature.SelectElement("ds:"+dsig.SignatureValueTag).Text())
+	_, err = (&VerifyContext{}).Verify(signature, newTestSignedData(t))
+	require.NoError(t, err)
+
+	signer := &constantSigner{method: "urn:example:signature-method"}
+	ctx.Signer = signer
+	plan, err := Inspect(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	signature, err = CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	require.Equal(t, plan.SignedInfoCanonical, signer.signed)
+	require.Equal(t, "c2lnbmF0dXJl", signature.SelectElement("ds:"+dsig.SignatureValueTag).Text())
+	require.Equal(t, signer.method, signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	ctx.DsigContext = dsig.NewDefaultSigningContext(&ctx.KeyStore)
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.EqualError(t, err, "xades: Signer cannot be combined with DsigContext or HMAC")
+}
@@ -0,0 +1,71 @@
+package xades
+
+import (
+	"crypto"
+	"fmt"
+
+	"github.com/google/uuid"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// SRIComprobanteId is the id attribute of the root element of an SRI comprobante electrónico, e.g.
+// <factura id="comprobante" version="1.1.0">, the element the SRIPreset signature envelopes
+const SRIComprobanteId string = "comprobante"
+
+// SRIPreset create SigningContext emitting the signature the SRI (Servicio de Rentas Internas, Ecuador) requires on
+// a comprobante electrónico, as specified by the Ficha Técnica de Comprobantes Electrónicos, Esquema Offline,
+// version 2.21: XAdES-BES of the v1.3.2 namespace, an enveloped signature of the comprobante referenced as
+// "#comprobante", RSA-SHA1 and SHA-1 digests, inclusive c14n, which is exact as comprobantes declare no namespaces,
+// and a KeyInfo carrying the certificate and the RSA KeyValue that a reference of SignedInfo signs. Ids follow the
+// SRI sample signatures, each with its own random number: Signature<n>, Signature-SignedInfo<n>,
+// SignedPropertiesID<n> on the SignedProperties reference, Reference-ID-<n> on the data reference,
+// SignatureValue<n>, Certificate<n> on KeyInfo and <Signature Id>-SignedProperties<n>, <Signature Id>-Object<n>.
+// The data reference comes first in SignedInfo, followed by the SignedProperties and KeyInfo references, and the
+// comprobante is described by a DataObjectFormat "contenido comprobante" of MIME type text/xml.
+// Sign with SignElementByID(doc, SRIComprobanteId, ctx) or CreateSignature of the root. opts are applied last.
+func SRIPreset(keyStore *MemoryX509KeyStore, opts ...Option) *SigningContext {
+
+	canonicalizer := dsig.MakeC14N10RecCanonicalizer()
+	signatureId := fmt.Sprintf("Signature%d", sriIdNumber())
+	ctx := &SigningContext{
+		DataContext: SignedDataContext{
+			Canonicalizer: canonicalizer,
+			Hash:          crypto.SHA1,
+			ReferenceURI:  "#" + SRIComprobanteId,
+			ReferenceID:   fmt.Sprintf("Reference-ID-%d", sriIdNumber()),
+			IsEnveloped:   true,
+		},
+		PropertiesContext: SignedPropertiesContext{
+			Canonicalizer: canonicalizer,
+			Hash:          crypto.SHA1,
+			DataObjectFormat: &DataObjectFormat{
+				Description: "contenido comprobante",
+				MimeType:    "text/xml",
+			},
+		},
+		KeyInfoContext: KeyInfoContext{
+			IncludeKeyValue: true,
+			SignKeyInfo:     true,
+		},
+		Canonicalizer:               canonicalizer,
+		Hash:                        crypto.SHA1,
+		KeyStore:                    *keyStore,
+		XmlDsigPrefix:               dsig.DefaultPrefix,
+		SignatureID:                 signatureId,
+		SignedInfoID:                fmt.Sprintf("Signature-SignedInfo%d", sriIdNumber()),
+		SignedPropertiesID:          fmt.Sprintf("%v-SignedProperties%d", signatureId, sriIdNumber()),
+		SignedPropertiesReferenceID: fmt.Sprintf("SignedPropertiesID%d", sriIdNumber()),
+		SignatureValueID:            fmt.Sprintf("SignatureValue%d", sriIdNumber()),
+		KeyInfoID:                   fmt.Sprintf("Certificate%d", sriIdNumber()),
+		ObjectID:                    fmt.Sprintf("%v-Object%d", signatureId, sriIdNumber()),
+	}
+	for _, opt := range opts {
+		opt(ctx)
+	}
+	return ctx
+}
+
+// sriIdNumber return a random number of at most six digits for the Ids of SRIPreset
+func sriIdNumber() uint32 {
+	return uuid.New().ID() % 1000000
+}
@@ -0,0 +1,60 @@
+package xades
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSRIPreset(t *testing.T) {
+	const comprobanteXML = `<factura id="comprobante" version="1.1.0"><infoTributaria><ambiente>1</ambiente><razonSocial>Distribuidora S.A.</razonSocial></infoTributaria></factura>`
+
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(comprobanteXML))
+	ctx := SRIPreset(keyStore)
+	signature, err := SignElementByID(doc, SRIComprobanteId, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+	signature = parsed.Root().SelectElement("ds:" + dsig.SignatureTag)
+	_, err = (&VerifyContext{}).Verify(signature, parsed.Root())
+	require.NoError(t, err)
+
+	require.Regexp(t, `^Signature\d+$`, signature.SelectAttrValue("Id", ""))
+	require.Regexp(t, `^Signature-SignedInfo\d+$`, findChild(signature, dsig.SignedInfoTag).SelectAttrValue("Id", ""))
+	require.Regexp(t, `^SignatureValue\d+$`, findChild(signature, dsig.SignatureValueTag).SelectAttrValue("Id", ""))
+	require.Regexp(t, `^Certificate\d+$`, findChild(signature, dsig.KeyInfoTag).SelectAttrValue("Id", ""))
+	require.Regexp(t, `^`+ctx.SignatureID+`-Object\d+$`, findChild(signature, "Object").SelectAttrValue("Id", ""))
+	require.Regexp(t, `^`+ctx.SignatureID+`-SignedProperties\d+$`, findPath(findQualifyingProperties(signature), SignedPropertiesTag).SelectAttrValue("Id", ""))
+	require.NotNil(t, findPath(signature, dsig.KeyInfoTag, keyValueTag))
+
+	references := findChild(signature, dsig.SignedInfoTag).SelectElements("ds:" + dsig.ReferenceTag)
+	require.Len(t, references, 3)
+	require.Regexp(t, `^Reference-ID-\d+$`, references[0].SelectAttrValue("Id", ""))
+	require.Equal(t, "#comprobante", references[0].SelectAttrValue(dsig.URIAttr, ""))
+	require.Regexp(t, `^SignedPropertiesID\d+$`, references[1].SelectAttrValue("Id", ""))
+	require.Equal(t, "#"+ctx.KeyInfoID, references[2].SelectAttrValue(dsig.URIAttr, ""))
+	for _, reference := range references {
+		require.Equal(t, "http://www.w3.org/2000/09/xmldsig#sha1", findChild(reference, dsig.DigestMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+	}
+	require.Equal(t, "http://www.w3.org/2000/09/xmldsig#rsa-sha1", findPath(signature, dsig.SignedInfoTag, dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+	dataObjectFormat := findPath(findQualifyingProperties(signature), SignedPropertiesTag, SignedDataObjectPropertiesTag, DataObjectFormatTag)
+	require.Equal(t, "#"+ctx.DataContext.ReferenceID, dataObjectFormat.SelectAttrValue("ObjectReference", ""))
+
+	// the signed KeyInfo cannot be swapped
+	findPath(signature, dsig.KeyInfoTag, keyValueTag).Parent().RemoveChild(findPath(signature, dsig.KeyInfoTag, keyValueTag))
+	_, err = (&VerifyContext{}).Verify(signature, parsed.Root())
+	require.EqualError(t, err, `xades: digest of reference "#`+ctx.KeyInfoID+`" does not match`)
+
+	ctx.KeyInfoID = ""
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.EqualError(t, err, "xades: KeyInfoContext.SignKeyInfo requires KeyInfoID, the Id its reference points at")
+}
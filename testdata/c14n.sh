@@ -0,0 +1,20 @@
+#!/bin/sh
+# Regenerate the canonical test vectors of TestCanonicalTestVectors with the exclusive c14n of libxml2's xmllint,
+# an implementation independent of goxmldsig:
+#
+#	sh testdata/c14n.sh
+#
+# data.xml is testXML of goxades_test.go. SignedInfo and SignedProperties are cut out of signature.golden and given
+# the namespace declarations in scope at their place, exclusive c14n renders those that are visibly utilized only.
+# Run it again whenever signature.golden is updated by go test -run TestSignatureGolden -update.
+set -e
+cd "$(dirname "$0")"
+
+ds='xmlns:ds="http://www.w3.org/2000/09/xmldsig#"'
+xades='xmlns:xades="http://uri.etsi.org/01903/v1.3.2#"'
+
+xmllint --exc-c14n data.xml > data.c14n
+sed -e 's|.*\(<ds:SignedInfo>.*</ds:SignedInfo>\).*|\1|' -e "s|^<ds:SignedInfo>|<ds:SignedInfo $ds>|" signature.golden |
+	xmllint --exc-c14n - > signedinfo.c14n
+sed -e 's|.*\(<xades:SignedProperties .*</xades:SignedProperties>\).*|\1|' -e "s|^<xades:SignedProperties |<xades:SignedProperties $ds $xades |" signature.golden |
+	xmllint --exc-c14n - > signedproperties.c14n
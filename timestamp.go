@@ -0,0 +1,470 @@
+package xades
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// TimestampClient obtains RFC 3161 time-stamp tokens from a time-stamping authority
+type TimestampClient interface {
+	// Timestamp return DER encoded TimeStampToken for the message imprint digest computed by hash
+	Timestamp(ctx context.Context, digest []byte, hash crypto.Hash) ([]byte, error)
+}
+
+// TimeStampContext configure a XAdES time-stamp property
+type TimeStampContext struct {
+	Client TimestampClient
+	// Hash used for the message imprint sent to the time-stamping authority, independent of the hashes of the signature
+	Hash crypto.Hash
+	// Canonicalizer of the time-stamped elements, announced by the ds:CanonicalizationMethod of the time-stamp.
+	// AllDataObjectsTimeStamp and IndividualDataObjectsTimeStamp use the data reference canonicalizer instead
+	Canonicalizer dsig.Canonicalizer
+	// Includes lists the time-stamped elements of SignatureTimeStamp and ArchiveTimeStamp explicitly, a xades:Include
+	// pointing at the Id of each in the order they are concatenated, instead of leaving them implicit. Time-stamping
+	// fails when one of them has no Id. IndividualDataObjectsTimeStamp always includes the data reference
+	Includes bool
+	// XPointerIncludes writes the Include URIs as "#xpointer(id('Id'))" instead of "#Id"
+	XPointerIncludes bool
+	// SignedData is what the data references of the signature resolve against for ArchiveTimeStamp, as signedData
+	// of VerifyContext.Verify. The document element above the signature is used when nil
+	SignedData *etree.Element
+	// ResolveURI returns the content of the external data references for ArchiveTimeStamp, see VerifyContext
+	ResolveURI func(uri string) ([]byte, error)
+}
+
+// referencedDataAttr is the attribute of xades:Include telling that the time-stamp covers the data a ds:Reference
+// points at rather than the ds:Reference element
+const referencedDataAttr = "referencedData"
+
+// createAllDataObjectsTimeStamp create xades:AllDataObjectsTimeStamp.
+//
+// The time-stamped octet stream is the concatenation, in the order of the references in SignedInfo,
+// of the output of each data reference's transforms, i.e. the bytes digested for that reference.
+// The SignedProperties reference is excluded. When the data reference is canonicalized with
+// DataContext.Canonicalizer it is announced by the ds:CanonicalizationMethod child, data digested
+// as is or base64 decoded goes without ds:CanonicalizationMethod.
+func createAllDataObjectsTimeStamp(goCtx context.Context, data []byte, dataCanonicalized bool, ctx *SigningContext) (*etree.Element, error) {
+
+	tsCtx := ctx.PropertiesContext.AllDataObjectsTimeStamp
+	if tsCtx.Client == nil {
+		return nil, errors.New("xades: AllDataObjectsTimeStamp requires a TimestampClient")
+	}
+
+	var canonicalizer dsig.Canonicalizer
+	if dataCanonicalized && (!ctx.DataContext.Base64Transform || ctx.DataContext.Base64DecodedXML) && ctx.DataContext.XSLTStylesheet == nil {
+		canonicalizer = ctx.DataContext.Canonicalizer
+	}
+	return createXAdESTimeStamp(goCtx, AllDataObjectsTimeStampTag, data, canonicalizer, tsCtx, ctx.XmlDsigPrefix)
+}
+
+// createIndividualDataObjectsTimeStamp create xades:IndividualDataObjectsTimeStamp over the data reference, which its
+// xades:Include points at. The time-stamped octet stream is the output of the transforms of the data reference, as
+// for createAllDataObjectsTimeStamp
+func createIndividualDataObjectsTimeStamp(goCtx context.Context, data []byte, dataCanonicalized bool, signatureIdPrefix string, ctx *SigningContext) (*etree.Element, error) {
+
+	tsCtx := ctx.PropertiesContext.IndividualDataObjectsTimeStamp
+	if tsCtx.Client == nil {
+		return nil, errors.New("xades: IndividualDataObjectsTimeStamp requires a TimestampClient")
+	}
+
+	var canonicalizer dsig.Canonicalizer
+	if dataCanonicalized && (!ctx.DataContext.Base64Transform || ctx.DataContext.Base64DecodedXML) && ctx.DataContext.XSLTStylesheet == nil {
+		canonicalizer = ctx.DataContext.Canonicalizer
+	}
+	timeStamp, err := createXAdESTimeStamp(goCtx, IndividualDataObjectsTimeStampTag, data, canonicalizer, tsCtx, ctx.XmlDsigPrefix)
+	if err != nil {
+		return nil, err
+	}
+	insertIncludes(timeStamp, []string{dataReferenceId(signatureIdPrefix, ctx)}, true, tsCtx)
+	return timeStamp, nil
+}
+
+// insertIncludes insert a xades:Include pointing at each of ids first in timeStamp, as xades:Include precedes
+// ds:CanonicalizationMethod. referencedData is written when the ids are those of ds:Reference elements whose data
+// is time-stamped
+func insertIncludes(timeStamp *etree.Element, ids []string, referencedData bool, tsCtx *TimeStampContext) {
+	for i, id := range ids {
+		include := etree.Element{
+			Space: Prefix,
+			Tag:   IncludeTag,
+			Attr:  []etree.Attr{{Key: dsig.URIAttr, Value: includeURI(id, tsCtx)}},
+		}
+		if referencedData {
+			include.CreateAttr(referencedDataAttr, "true")
+		}
+		timeStamp.InsertChildAt(i, &include)
+	}
+}
+
+// includeURI return the xades:Include URI pointing at id, an XPointer when tsCtx.XPointerIncludes
+func includeURI(id string, tsCtx *TimeStampContext) string {
+	if tsCtx.XPointerIncludes {
+		return "#xpointer(id('" + id + "'))"
+	}
+	return "#" + id
+}
+
+// includeIds return the Ids of elements for the xades:Include of the time-stamp named tag, nil unless
+// tsCtx.Includes
+func includeIds(tag string, elements []*etree.Element, tsCtx *TimeStampContext) ([]string, error) {
+	if !tsCtx.Includes {
+		return nil, nil
+	}
+	ids := make([]string, 0, len(elements))
+	for _, el := range elements {
+		id := elementId(el)
+		if id == "" {
+			return nil, fmt.Errorf("xades: %v Include requires an Id on %v", tag, el.Tag)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// checkIncludes check that the xades:Include elements of timeStamp, if any, point at the Ids of elements in order
+func checkIncludes(timeStamp *etree.Element, elements []*etree.Element) error {
+	var uris []string
+	for _, include := range timeStamp.ChildElements() {
+		if include.Tag == IncludeTag {
+			uris = append(uris, include.SelectAttrValue(dsig.URIAttr, ""))
+		}
+	}
+	if len(uris) == 0 {
+		return nil
+	}
+	if len(uris) != len(elements) {
+		return fmt.Errorf("xades: %v has %d Include elements for %d time-stamped elements", timeStamp.Tag, len(uris), len(elements))
+	}
+	for i, uri := range uris {
+		if id, _ := referenceURIId(uri); id == "" || id != elementId(elements[i]) {
+			return fmt.Errorf("xades: %v Include %q does not point at %v", timeStamp.Tag, uri, elements[i].Tag)
+		}
+	}
+	return nil
+}
+
+// createXAdESTimeStamp time-stamp data and create XAdESTimeStampType element named tag,
+// ds:CanonicalizationMethod is omitted when canonicalizer is nil
+func createXAdESTimeStamp(goCtx context.Context, tag string, data []byte, canonicalizer dsig.Canonicalizer, tsCtx *TimeStampContext, xmlDsigPrefix string) (*etree.Element, error) {
+
+	_hash := newHash(tsCtx.Hash)
+	_, err := _hash.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := tsCtx.Client.Timestamp(goCtx, _hash.Sum(nil), tsCtx.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	timeStamp := etree.Element{
+		Space: Prefix,
+		Tag:   tag,
+	}
+	if canonicalizer != nil {
+		canonicalizationMethod := timeStamp.CreateElement(dsig.CanonicalizationMethodTag)
+		canonicalizationMethod.Space = xmlDsigPrefix
+		canonicalizationMethod.CreateAttr(dsig.AlgorithmAttr, canonicalizer.Algorithm().String())
+	}
+
+	encapsulatedTimeStamp := timeStamp.CreateElement(EncapsulatedTimeStampTag)
+	encapsulatedTimeStamp.Space = Prefix
+	encapsulatedTimeStamp.SetText(base64.StdEncoding.EncodeToString(token))
+
+	return &timeStamp, nil
+}
+
+// AddSignatureTimeStamp add xades:SignatureTimeStamp to the UnsignedSignatureProperties of signature, upgrading it to XAdES-T.
+//
+// The time-stamped octet stream is the ds:SignatureValue element canonicalized with tsCtx.Canonicalizer in the
+// context of signature, i.e. with the namespace declarations in scope, and the imprint is its digest by tsCtx.Hash.
+// The line feeds of a wrapped SignatureValue are part of the element content and so of the octets.
+func AddSignatureTimeStamp(goCtx context.Context, signature *etree.Element, tsCtx *TimeStampContext) error {
+
+	if tsCtx.Client == nil {
+		return errors.New("xades: SignatureTimeStamp requires a TimestampClient")
+	}
+	if tsCtx.Canonicalizer == nil {
+		return errors.New("xades: SignatureTimeStamp requires a Canonicalizer")
+	}
+
+	signatureValue := findChild(signature, dsig.SignatureValueTag)
+	if signatureValue == nil {
+		return fmt.Errorf("xades: SignatureTimeStamp requires %v in signature", dsig.SignatureValueTag)
+	}
+	data, err := canonicalizeInContext(tsCtx.Canonicalizer, signatureValue)
+	if err != nil {
+		return err
+	}
+
+	ids, err := includeIds(SignatureTimeStampTag, []*etree.Element{signatureValue}, tsCtx)
+	if err != nil {
+		return err
+	}
+
+	unsignedSignatureProperties, err := findOrCreateUnsignedSignatureProperties(signature)
+	if err != nil {
+		return err
+	}
+	signatureTimeStamp, err := createXAdESTimeStamp(goCtx, SignatureTimeStampTag, data, tsCtx.Canonicalizer, tsCtx, signature.Space)
+	if err != nil {
+		return err
+	}
+	insertIncludes(signatureTimeStamp, ids, false, tsCtx)
+	unsignedSignatureProperties.AddChild(signatureTimeStamp)
+	return nil
+}
+
+// AddArchiveTimeStamp add xades:ArchiveTimeStamp to the UnsignedSignatureProperties of signature, upgrading it to XAdES-A.
+//
+// The time-stamped octet stream follows ETSI TS 101 903 §8.2.1: the output of each ds:Reference of ds:SignedInfo in
+// order, the octets it digests, resolved against tsCtx.SignedData and tsCtx.ResolveURI, then, each canonicalized
+// with tsCtx.Canonicalizer in the context of signature, ds:SignedInfo, ds:SignatureValue, ds:KeyInfo, every child
+// of xades:UnsignedSignatureProperties present before the call and every ds:Object but the one of
+// xades:QualifyingProperties, in document order. With tsCtx.Includes the references are included with referencedData.
+func AddArchiveTimeStamp(goCtx context.Context, signature *etree.Element, tsCtx *TimeStampContext) error {
+
+	if tsCtx.Client == nil {
+		return errors.New("xades: ArchiveTimeStamp requires a TimestampClient")
+	}
+	if tsCtx.Canonicalizer == nil {
+		return errors.New("xades: ArchiveTimeStamp requires a Canonicalizer")
+	}
+
+	elements := []*etree.Element{}
+	for _, tag := range []string{dsig.SignedInfoTag, dsig.SignatureValueTag, dsig.KeyInfoTag} {
+		el := findChild(signature, tag)
+		if el == nil {
+			return fmt.Errorf("xades: ArchiveTimeStamp requires %v in signature", tag)
+		}
+		elements = append(elements, el)
+	}
+
+	qualifyingProperties := findQualifyingProperties(signature)
+	if qualifyingProperties == nil {
+		return errors.New("xades: signature has no QualifyingProperties")
+	}
+	signedData := tsCtx.SignedData
+	if signedData == nil {
+		signedData = documentElement(signature)
+	}
+	var references []*etree.Element
+	var data []byte
+	for _, reference := range elements[0].ChildElements() {
+		if reference.Tag != dsig.ReferenceTag {
+			continue
+		}
+		output, err := referenceOutput(reference, signature, signedData, tsCtx.ResolveURI)
+		if err != nil {
+			return err
+		}
+		references = append(references, reference)
+		data = append(data, output...)
+	}
+
+	unsignedSignatureProperties, err := findOrCreateUnsignedSignatureProperties(signature)
+	if err != nil {
+		return err
+	}
+	elements = append(elements, unsignedSignatureProperties.ChildElements()...)
+	for _, object := range signature.ChildElements() {
+		if object.Tag == "Object" && object != qualifyingProperties.Parent() {
+			elements = append(elements, object)
+		}
+	}
+	referenceIds, err := includeIds(ArchiveTimeStampTag, references, tsCtx)
+	if err != nil {
+		return err
+	}
+	ids, err := includeIds(ArchiveTimeStampTag, elements, tsCtx)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range elements {
+		canonical, err := canonicalizeInContext(tsCtx.Canonicalizer, el)
+		if err != nil {
+			return err
+		}
+		data = append(data, canonical...)
+	}
+
+	archiveTimeStamp, err := createXAdESTimeStamp(goCtx, ArchiveTimeStampTag, data, tsCtx.Canonicalizer, tsCtx, signature.Space)
+	if err != nil {
+		return err
+	}
+	insertIncludes(archiveTimeStamp, ids, false, tsCtx)
+	insertIncludes(archiveTimeStamp, referenceIds, true, tsCtx)
+	unsignedSignatureProperties.AddChild(archiveTimeStamp)
+	return nil
+}
+
+// TimeStampToken is the TSTInfo of a RFC 3161 time-stamp token as read by ParseTimeStampToken
+type TimeStampToken struct {
+	Policy       asn1.ObjectIdentifier
+	SerialNumber *big.Int
+	GenTime      time.Time
+	// Hash is the algorithm of MessageImprint, the digest of the time-stamped octets
+	Hash           crypto.Hash
+	MessageImprint []byte
+}
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+var imprintHashes = map[string]crypto.Hash{
+	"1.3.14.3.2.26":          crypto.SHA1,
+	"2.16.840.1.101.3.4.2.4": crypto.SHA224,
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+// contentInfo, signedData and tstInfo are the leading fields of the RFC 5652 and RFC 3161 structures,
+// later fields such as certificates, signerInfos, accuracy and nonce are not read
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	SignedData  signedData `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,tag:0"`
+	}
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashedMessage []byte
+	}
+	SerialNumber *big.Int
+	GenTime      time.Time `asn1:"generalized"`
+}
+
+// ParseTimeStampToken read the TSTInfo of the DER encoded RFC 3161 TimeStampToken token.
+// The CMS signature of the time-stamping authority is not verified
+func ParseTimeStampToken(token []byte) (*TimeStampToken, error) {
+
+	var content contentInfo
+	rest, err := asn1.Unmarshal(token, &content)
+	if err != nil {
+		return nil, fmt.Errorf("xades: parsing TimeStampToken: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("xades: trailing data after TimeStampToken")
+	}
+	if !content.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("xades: TimeStampToken content type %v is not signed data", content.ContentType)
+	}
+	encapContentInfo := content.SignedData.EncapContentInfo
+	if !encapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("xades: TimeStampToken encapsulated content type %v is not TSTInfo", encapContentInfo.EContentType)
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(encapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("xades: parsing TSTInfo: %w", err)
+	}
+	hash, ok := imprintHashes[info.MessageImprint.HashAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("xades: unsupported message imprint algorithm %v", info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	return &TimeStampToken{
+		Policy:         info.Policy,
+		SerialNumber:   info.SerialNumber,
+		GenTime:        info.GenTime,
+		Hash:           hash,
+		MessageImprint: info.MessageImprint.HashedMessage,
+	}, nil
+}
+
+// VerifySignatureTimeStamp check the xades:SignatureTimeStamp of signature: the message imprint of its token must be
+// the digest of ds:SignatureValue canonicalized with the announced ds:CanonicalizationMethod, as computed by
+// AddSignatureTimeStamp, and its xades:Include, if any, must point at ds:SignatureValue. The token is returned for
+// its GenTime. The CMS signature of the time-stamping authority is not verified, callers check it and the TSA
+// certificate with VerifyTimeStampToken
+func VerifySignatureTimeStamp(signature *etree.Element) (*TimeStampToken, error) {
+	token, _, err := verifySignatureTimeStampImprint(signature)
+	return token, err
+}
+
+// verifyTrustedSignatureTimeStamp check the xades:SignatureTimeStamp of signature as VerifySignatureTimeStamp does
+// and the CMS signature of its token, see VerifyTimeStampToken
+func verifyTrustedSignatureTimeStamp(signature *etree.Element, roots *x509.CertPool) (*TimeStampToken, error) {
+	_, der, err := verifySignatureTimeStampImprint(signature)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyTimeStampToken(der, roots)
+}
+
+// verifySignatureTimeStampImprint return the token of the xades:SignatureTimeStamp of signature, parsed and DER
+// encoded, once its message imprint is checked
+func verifySignatureTimeStampImprint(signature *etree.Element) (*TimeStampToken, []byte, error) {
+
+	qualifyingProperties := findQualifyingProperties(signature)
+	if qualifyingProperties == nil {
+		return nil, nil, errors.New("xades: signature has no QualifyingProperties")
+	}
+	signatureTimeStamp := findPath(qualifyingProperties, UnsignedPropertiesTag, UnsignedSignaturePropertiesTag, SignatureTimeStampTag)
+	if signatureTimeStamp == nil {
+		return nil, nil, errors.New("xades: signature has no SignatureTimeStamp")
+	}
+	encapsulatedTimeStamp := findChild(signatureTimeStamp, EncapsulatedTimeStampTag)
+	if encapsulatedTimeStamp == nil {
+		return nil, nil, errors.New("xades: SignatureTimeStamp has no EncapsulatedTimeStamp")
+	}
+	der, err := decodeBase64Text(encapsulatedTimeStamp, EncapsulatedTimeStampTag)
+	if err != nil {
+		return nil, nil, err
+	}
+	token, err := ParseTimeStampToken(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	canonicalizationMethod := findChild(signatureTimeStamp, dsig.CanonicalizationMethodTag)
+	if canonicalizationMethod == nil {
+		return nil, nil, errors.New("xades: SignatureTimeStamp has no CanonicalizationMethod")
+	}
+	canonicalizer, err := methodCanonicalizer(canonicalizationMethod)
+	if err != nil {
+		return nil, nil, err
+	}
+	signatureValue := findChild(signature, dsig.SignatureValueTag)
+	if signatureValue == nil {
+		return nil, nil, fmt.Errorf("xades: signature has no %v", dsig.SignatureValueTag)
+	}
+	if err := checkIncludes(signatureTimeStamp, []*etree.Element{signatureValue}); err != nil {
+		return nil, nil, err
+	}
+	data, err := canonicalizeInContext(canonicalizer, signatureValue)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(digestSum(data, token.Hash), token.MessageImprint) {
+		return nil, nil, errors.New("xades: SignatureTimeStamp message imprint does not match the SignatureValue")
+	}
+	return token, der, nil
+}
@@ -0,0 +1,522 @@
+package xades
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTimestampClient struct {
+	digests [][]byte
+	hashes  []crypto.Hash
+}
+
+func (c *fakeTimestampClient) Timestamp(ctx context.Context, digest []byte, hash crypto.Hash) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.digests = append(c.digests, digest)
+	c.hashes = append(c.hashes, hash)
+	return append([]byte("token:"), digest...), nil
+}
+
+func TestAllDataObjectsTimeStamp(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	client := &fakeTimestampClient{}
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.AllDataObjectsTimeStamp = &TimeStampContext{
+		Client: client,
+		Hash:   crypto.SHA256,
+	}
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	canonical, err := ctx.DataContext.Canonicalizer.Canonicalize(signedData)
+	require.NoError(t, err)
+	digest := sha256.Sum256(canonical)
+	require.Len(t, client.digests, 1)
+	require.Equal(t, digest[:], client.digests[0])
+	require.Equal(t, crypto.SHA256, client.hashes[0])
+
+	timeStamp := signature.FindElement("ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag +
+		"/" + Prefix + ":" + SignedDataObjectPropertiesTag + "/" + Prefix + ":" + AllDataObjectsTimeStampTag)
+	require.NotEmpty(t, timeStamp)
+
+	canonicalizationMethod := timeStamp.FindElement("ds:" + dsig.CanonicalizationMethodTag)
+	require.NotEmpty(t, canonicalizationMethod)
+	require.Equal(t, ctx.DataContext.Canonicalizer.Algorithm().String(), canonicalizationMethod.SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	encapsulatedTimeStamp := timeStamp.FindElement(Prefix + ":" + EncapsulatedTimeStampTag)
+	require.NotEmpty(t, encapsulatedTimeStamp)
+	require.Equal(t, base64.StdEncoding.EncodeToString(append([]byte("token:"), digest[:]...)), encapsulatedTimeStamp.Text())
+
+	ctx.PropertiesContext.AllDataObjectsTimeStamp.Client = nil
+	_, err = CreateSignature(signedData, ctx)
+	require.Error(t, err)
+}
+
+func TestIndividualDataObjectsTimeStamp(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	client := &fakeTimestampClient{}
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.IndividualDataObjectsTimeStamp = &TimeStampContext{
+		Client: client,
+		Hash:   crypto.SHA256,
+	}
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+
+	canonical, err := ctx.DataContext.Canonicalizer.Canonicalize(signedData)
+	require.NoError(t, err)
+	digest := sha256.Sum256(canonical)
+	require.Equal(t, [][]byte{digest[:]}, client.digests)
+
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Equal(t, "Reference", reference.SelectAttrValue("Id", ""))
+	timeStamp := signature.FindElement("ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag +
+		"/" + Prefix + ":" + SignedDataObjectPropertiesTag + "/" + Prefix + ":" + IndividualDataObjectsTimeStampTag)
+	require.NotNil(t, timeStamp)
+	var tags []string
+	for _, child := range timeStamp.ChildElements() {
+		tags = append(tags, child.Tag)
+	}
+	require.Equal(t, []string{IncludeTag, dsig.CanonicalizationMethodTag, EncapsulatedTimeStampTag}, tags)
+	require.Equal(t, "#Reference", timeStamp.SelectElement(Prefix+":"+IncludeTag).SelectAttrValue(dsig.URIAttr, ""))
+
+	timeStamp.SelectElement(Prefix+":"+IncludeTag).CreateAttr(dsig.URIAttr, "#Other")
+	require.EqualError(t, ValidateStructure(signature), `xades: IndividualDataObjectsTimeStamp Include "#Other" does not match the Id of a data reference`)
+
+	ctx.DataContext.ReferenceID = "data"
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.Equal(t, "#data", signature.FindElement(".//"+Prefix+":"+IncludeTag).SelectAttrValue(dsig.URIAttr, ""))
+
+	ctx.PropertiesContext.IndividualDataObjectsTimeStamp.Client = nil
+	_, err = CreateSignature(signedData, ctx)
+	require.EqualError(t, err, "xades: IndividualDataObjectsTimeStamp requires a TimestampClient")
+}
+
+func TestCreateSignatureContextCancelled(t *testing.T) {
+	signedData := newTestSignedData(t)
+
+	client := &fakeTimestampClient{}
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.AllDataObjectsTimeStamp = &TimeStampContext{
+		Client: client,
+		Hash:   crypto.SHA256,
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := CreateSignatureContext(cancelled, signedData, ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, client.digests)
+
+	_, err = CreateSignatureContext(context.Background(), signedData, ctx)
+	require.NoError(t, err)
+	require.Len(t, client.digests, 1)
+}
+
+func TestAddArchiveTimeStamp(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, AddValidationValues(signature, &ValidationValuesContext{OCSPResponses: [][]byte{[]byte("ocsp")}}))
+	object := signature.CreateElement("ds:Object")
+	object.CreateElement("data").SetText("object")
+
+	client := &fakeTimestampClient{}
+	tsCtx := &TimeStampContext{
+		Client:        client,
+		Hash:          crypto.SHA256,
+		Canonicalizer: dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""),
+		SignedData:    signedData,
+	}
+
+	// the output of each reference is the data its DigestValue covers
+	exclusive := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	dataOutput, err := canonicalizeInContext(exclusive, signedData)
+	require.NoError(t, err)
+	propertiesOutput, err := canonicalizeInContext(exclusive, signature.FindElement("ds:Object/"+Prefix+":"+QualifyingPropertiesTag+"/"+Prefix+":"+SignedPropertiesTag))
+	require.NoError(t, err)
+	references := signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Len(t, references, 2)
+	for i, output := range [][]byte{dataOutput, propertiesOutput} {
+		require.Equal(t, DigestBytes(output, crypto.SHA256), references[i].FindElement("ds:"+dsig.DigestValueTag).Text())
+	}
+
+	expected := append(append([]byte(nil), dataOutput...), propertiesOutput...)
+	for _, path := range []string{
+		"ds:" + dsig.SignedInfoTag,
+		"ds:" + dsig.SignatureValueTag,
+		"ds:" + dsig.KeyInfoTag,
+		unsignedSignaturePropertiesPath("ds") + "/" + Prefix + ":" + CertificateValuesTag,
+		unsignedSignaturePropertiesPath("ds") + "/" + Prefix + ":" + RevocationValuesTag,
+	} {
+		canonical, err := canonicalizeInContext(tsCtx.Canonicalizer, signature.FindElement(path))
+		require.NoError(t, err)
+		expected = append(expected, canonical...)
+	}
+	canonical, err := canonicalizeInContext(tsCtx.Canonicalizer, object)
+	require.NoError(t, err)
+	expected = append(expected, canonical...)
+
+	require.NoError(t, AddArchiveTimeStamp(context.Background(), signature, tsCtx))
+
+	digest := sha256.Sum256(expected)
+	require.Len(t, client.digests, 1)
+	require.Equal(t, digest[:], client.digests[0])
+
+	children := signature.FindElement(unsignedSignaturePropertiesPath("ds")).ChildElements()
+	require.Len(t, children, 3)
+	require.Equal(t, ArchiveTimeStampTag, children[2].Tag)
+	require.NotEmpty(t, children[2].FindElement(Prefix+":"+EncapsulatedTimeStampTag))
+
+	// the data reference does not resolve without the signed data
+	tsCtx.SignedData = nil
+	require.Error(t, AddArchiveTimeStamp(context.Background(), signature, tsCtx))
+	tsCtx.Client = nil
+	require.Error(t, AddArchiveTimeStamp(context.Background(), signature, tsCtx))
+}
+
+func TestAddSignatureTimeStamp(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+	ctx.Hash = crypto.SHA1
+	ctx.Base64LineWidth = 64
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	client := &fakeTimestampClient{}
+	tsCtx := &TimeStampContext{
+		Client:        client,
+		Hash:          crypto.SHA256,
+		Canonicalizer: dsig.MakeC14N10RecCanonicalizer(),
+	}
+	require.NoError(t, AddSignatureTimeStamp(context.Background(), signature, tsCtx))
+
+	expected := `<ds:SignatureValue xmlns:ds="` + dsig.Namespace + `">` + signature.SelectElement("ds:"+dsig.SignatureValueTag).Text() + `</ds:SignatureValue>`
+	digest := sha256.Sum256([]byte(expected))
+	require.Len(t, client.digests, 1)
+	require.Equal(t, digest[:], client.digests[0])
+	require.Equal(t, crypto.SHA256, client.hashes[0])
+
+	timeStamp := signature.FindElement(unsignedSignaturePropertiesPath("ds") + "/" + Prefix + ":" + SignatureTimeStampTag)
+	require.NotEmpty(t, timeStamp)
+	canonicalizationMethod := timeStamp.FindElement("ds:" + dsig.CanonicalizationMethodTag)
+	require.NotEmpty(t, canonicalizationMethod)
+	require.Equal(t, dsig.CanonicalXML10RecAlgorithmId.String(), canonicalizationMethod.SelectAttrValue(dsig.AlgorithmAttr, ""))
+	require.NotEmpty(t, timeStamp.FindElement(Prefix+":"+EncapsulatedTimeStampTag))
+
+	tsCtx.Canonicalizer = nil
+	require.Error(t, AddSignatureTimeStamp(context.Background(), signature, tsCtx))
+}
+
+// derTimestampClient return minimal DER TimeStampTokens with a nonce after genTime, unsigned unless the
+// certificate and key of a time-stamping authority are set, see newTestTSA
+type derTimestampClient struct {
+	genTime time.Time
+	tsaCert *x509.Certificate
+	tsaKey  crypto.Signer
+}
+
+func (c *derTimestampClient) Timestamp(ctx context.Context, digest []byte, hash crypto.Hash) ([]byte, error) {
+	info := struct {
+		Version        int
+		Policy         asn1.ObjectIdentifier
+		MessageImprint struct {
+			HashAlgorithm pkix.AlgorithmIdentifier
+			HashedMessage []byte
+		}
+		SerialNumber *big.Int
+		GenTime      time.Time `asn1:"generalized"`
+		Nonce        *big.Int
+	}{
+		Version:      1,
+		Policy:       asn1.ObjectIdentifier{1, 2, 3},
+		SerialNumber: big.NewInt(42),
+		GenTime:      c.genTime,
+		Nonce:        big.NewInt(7),
+	}
+	info.MessageImprint.HashAlgorithm.Algorithm = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	info.MessageImprint.HashedMessage = digest
+	eContent, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	emptySet := asn1.RawValue{Tag: asn1.TagSet, IsCompound: true}
+	token := struct {
+		ContentType asn1.ObjectIdentifier
+		SignedData  struct {
+			Version          int
+			DigestAlgorithms asn1.RawValue
+			EncapContentInfo struct {
+				EContentType asn1.ObjectIdentifier
+				EContent     []byte `asn1:"explicit,tag:0"`
+			}
+			Certificates asn1.RawValue `asn1:"optional"`
+			SignerInfos  asn1.RawValue
+		} `asn1:"explicit,tag:0"`
+	}{ContentType: oidSignedData}
+	token.SignedData.Version = 3
+	token.SignedData.DigestAlgorithms = emptySet
+	token.SignedData.EncapContentInfo.EContentType = oidTSTInfo
+	token.SignedData.EncapContentInfo.EContent = eContent
+	token.SignedData.SignerInfos = emptySet
+	if c.tsaCert != nil {
+		sha256Algorithm, err := asn1.Marshal(pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}})
+		if err != nil {
+			return nil, err
+		}
+		signerInfo, err := c.signerInfo(eContent)
+		if err != nil {
+			return nil, err
+		}
+		token.SignedData.DigestAlgorithms = asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: sha256Algorithm}
+		token.SignedData.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: c.tsaCert.Raw}
+		token.SignedData.SignerInfos = asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signerInfo}
+	}
+	return asn1.Marshal(token)
+}
+
+// signerInfo return the DER encoded SignerInfo of the time-stamping authority over eContent, with the content-type
+// and message-digest signed attributes
+func (c *derTimestampClient) signerInfo(eContent []byte) ([]byte, error) {
+	attribute := func(oid asn1.ObjectIdentifier, value interface{}) ([]byte, error) {
+		encoded, err := asn1.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(struct {
+			Type   asn1.ObjectIdentifier
+			Values asn1.RawValue
+		}{oid, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: encoded}})
+	}
+	contentType, err := attribute(oidContentTypeAttr, oidTSTInfo)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(eContent)
+	messageDigest, err := attribute(oidMessageDigestAttr, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	attributes := append(contentType, messageDigest...)
+	signedAttrs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attributes})
+	if err != nil {
+		return nil, err
+	}
+	signedAttrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := c.tsaKey.Sign(rand.Reader, signedAttrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct {
+		Version int
+		SID     struct {
+			Issuer       asn1.RawValue
+			SerialNumber *big.Int
+		}
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttrs        asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+	}{
+		Version: 1,
+		SID: struct {
+			Issuer       asn1.RawValue
+			SerialNumber *big.Int
+		}{asn1.RawValue{FullBytes: c.tsaCert.RawIssuer}, c.tsaCert.SerialNumber},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}},
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attributes},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}, Parameters: asn1.NullRawValue},
+		Signature:          signature,
+	})
+}
+
+// newTestTSA issue the certificate of a time-stamping authority below a new root for the test key and return the
+// roots and a client signing its tokens at genTime
+func newTestTSA(t *testing.T, genTime time.Time) (*x509.CertPool, *derTimestampClient) {
+	keyStore, err := getTestKeyStore()
+	require.NoError(t, err)
+	root := newTestCertificate(t, caTemplate(10, "Test TSA Root"), nil)
+	tsaCert := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(11),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, root)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return roots, &derTimestampClient{genTime: genTime, tsaCert: tsaCert, tsaKey: keyStore.PrivateKey}
+}
+
+func TestVerifySignatureTimeStamp(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+	ctx.Base64LineWidth = 64
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	_, err = VerifySignatureTimeStamp(signature)
+	require.Error(t, err)
+
+	genTime := time.Date(2020, 1, 1, 0, 0, 1, 0, time.UTC)
+	require.NoError(t, AddSignatureTimeStamp(context.Background(), signature, &TimeStampContext{
+		Client:        &derTimestampClient{genTime: genTime},
+		Hash:          crypto.SHA256,
+		Canonicalizer: dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""),
+	}))
+
+	token, err := VerifySignatureTimeStamp(signature)
+	require.NoError(t, err)
+	require.True(t, genTime.Equal(token.GenTime))
+	require.Equal(t, crypto.SHA256, token.Hash)
+	require.Equal(t, asn1.ObjectIdentifier{1, 2, 3}, token.Policy)
+	require.Equal(t, int64(42), token.SerialNumber.Int64())
+
+	signatureValue := signature.SelectElement("ds:" + dsig.SignatureValueTag)
+	signatureValue.SetText("AAAA" + signatureValue.Text())
+	_, err = VerifySignatureTimeStamp(signature)
+	require.Error(t, err)
+
+	_, err = ParseTimeStampToken([]byte("token"))
+	require.Error(t, err)
+}
+
+func TestVerifyTimeStampToken(t *testing.T) {
+	genTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	roots, client := newTestTSA(t, genTime)
+	digest := sha256.Sum256([]byte("data"))
+	token, err := client.Timestamp(context.Background(), digest[:], crypto.SHA256)
+	require.NoError(t, err)
+
+	parsed, err := VerifyTimeStampToken(token, roots)
+	require.NoError(t, err)
+	require.True(t, genTime.Equal(parsed.GenTime))
+	require.Equal(t, digest[:], parsed.MessageImprint)
+
+	_, err = VerifyTimeStampToken(token, nil)
+	require.Error(t, err)
+	_, err = VerifyTimeStampToken(token, x509.NewCertPool())
+	require.Error(t, err)
+
+	tampered := append([]byte(nil), token...)
+	index := bytes.Index(tampered, digest[:])
+	require.True(t, index > 0)
+	tampered[index] ^= 0xff
+	_, err = VerifyTimeStampToken(tampered, roots)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "message-digest")
+
+	unsigned, err := (&derTimestampClient{genTime: genTime}).Timestamp(context.Background(), digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	_, err = VerifyTimeStampToken(unsigned, roots)
+	require.Error(t, err)
+}
+
+func TestTimeStampIncludes(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+	ctx.SignedInfoID = "signedInfo"
+	ctx.SignatureValueID = "signatureValue"
+	ctx.KeyInfoID = "keyInfo"
+	ctx.SignedPropertiesReferenceID = "propertiesReference"
+	ctx.PropertiesContext.IndividualDataObjectsTimeStamp = &TimeStampContext{
+		Client:           &fakeTimestampClient{},
+		Hash:             crypto.SHA256,
+		XPointerIncludes: true,
+	}
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+
+	include := signature.FindElement(".//" + Prefix + ":" + IndividualDataObjectsTimeStampTag + "/" + Prefix + ":" + IncludeTag)
+	require.Equal(t, "#xpointer(id('Reference'))", include.SelectAttrValue(dsig.URIAttr, ""))
+	require.Equal(t, "true", include.SelectAttrValue("referencedData", ""))
+
+	includeURIs := func(timeStamp *etree.Element) (uris []string) {
+		for _, include := range timeStamp.SelectElements(Prefix + ":" + IncludeTag) {
+			require.Nil(t, include.SelectAttr("referencedData"))
+			uris = append(uris, include.SelectAttrValue(dsig.URIAttr, ""))
+		}
+		return uris
+	}
+	elementIds := func(tags ...string) (uris []string) {
+		for _, tag := range tags {
+			el := signature.FindElement(".//" + tag)
+			require.NotNil(t, el, tag)
+			uris = append(uris, "#"+elementId(el))
+		}
+		return uris
+	}
+
+	archiveCtx := &TimeStampContext{
+		Client:        &fakeTimestampClient{},
+		Hash:          crypto.SHA256,
+		Canonicalizer: dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""),
+		Includes:      true,
+		SignedData:    signedData,
+	}
+	archived := signature.Copy()
+	require.NoError(t, AddArchiveTimeStamp(context.Background(), archived, archiveCtx))
+	archiveTimeStamp := archived.FindElement(".//" + Prefix + ":" + ArchiveTimeStampTag)
+	// the references are included by their referenced data first
+	includes := archiveTimeStamp.SelectElements(Prefix + ":" + IncludeTag)
+	require.Len(t, includes, 5)
+	for i, id := range []string{"#Reference", "#propertiesReference"} {
+		require.Equal(t, id, includes[i].SelectAttrValue(dsig.URIAttr, ""))
+		require.Equal(t, "true", includes[i].SelectAttrValue("referencedData", ""))
+	}
+	archiveTimeStamp.RemoveChild(includes[0])
+	archiveTimeStamp.RemoveChild(includes[1])
+	require.Equal(t, elementIds("ds:"+dsig.SignedInfoTag, "ds:"+dsig.SignatureValueTag, "ds:"+dsig.KeyInfoTag), includeURIs(archiveTimeStamp))
+	require.Equal(t, dsig.CanonicalizationMethodTag, archiveTimeStamp.ChildElements()[3].Tag)
+
+	tsCtx := &TimeStampContext{
+		Client:        &derTimestampClient{genTime: time.Date(2020, 1, 1, 0, 0, 1, 0, time.UTC)},
+		Hash:          crypto.SHA256,
+		Canonicalizer: dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""),
+		Includes:      true,
+	}
+	require.NoError(t, AddSignatureTimeStamp(context.Background(), signature, tsCtx))
+	signatureTimeStamp := signature.FindElement(".//" + Prefix + ":" + SignatureTimeStampTag)
+	require.Equal(t, []string{"#signatureValue"}, includeURIs(signatureTimeStamp))
+	_, err = VerifySignatureTimeStamp(signature)
+	require.NoError(t, err)
+
+	signatureTimeStamp.SelectElement(Prefix+":"+IncludeTag).CreateAttr(dsig.URIAttr, "#keyInfo")
+	_, err = VerifySignatureTimeStamp(signature)
+	require.EqualError(t, err, `xades: SignatureTimeStamp Include "#keyInfo" does not point at SignatureValue`)
+
+	// the SignatureTimeStamp has no Id an Include could point at
+	err = AddArchiveTimeStamp(context.Background(), signature, archiveCtx)
+	require.EqualError(t, err, "xades: ArchiveTimeStamp Include requires an Id on SignatureTimeStamp")
+
+	ctx.SignatureValueID = ""
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	err = AddSignatureTimeStamp(context.Background(), signature, tsCtx)
+	require.EqualError(t, err, "xades: SignatureTimeStamp Include requires an Id on SignatureValue")
+}
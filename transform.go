@@ -0,0 +1,231 @@
+package xades
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// Base64TransformAlgorithmId is the XML DSig base64 decoding transform
+const Base64TransformAlgorithmId = "http://www.w3.org/2000/09/xmldsig#base64"
+
+// XSLTTransformAlgorithmId is the XML DSig XSLT transform, applied by the engine of RegisterXSLTEngine
+const XSLTTransformAlgorithmId = "http://www.w3.org/TR/1999/REC-xslt-19991116"
+
+// DataTransform is a transform of the data reference, see SignedDataContext.Transforms
+type DataTransform int
+
+const (
+	// EnvelopedTransform removes the signature: the enveloped-signature transform, or the XPath transform of
+	// ExcludeSignatures. Listed when IsEnveloped
+	EnvelopedTransform DataTransform = iota + 1
+	// CanonicalizationTransform canonicalizes with Canonicalizer and InclusiveNamespaces. When not listed the
+	// reference is digested as its inclusive c14n 1.0, the implicit conversion of a node-set to octets
+	CanonicalizationTransform
+	// Base64DecodeTransform decodes the base64 text content. Listed when Base64Transform, before canonicalization
+	Base64DecodeTransform
+	// XSLTStylesheetTransform applies XSLTStylesheet. Listed when XSLTStylesheet is set, last and after canonicalization
+	XSLTStylesheetTransform
+)
+
+// dataTransforms return the ordered transforms of the data reference of dataCtx, Transforms or by default the
+// enveloped transform, base64 decoding, canonicalization and XSLT as configured
+func dataTransforms(dataCtx *SignedDataContext) []DataTransform {
+	if dataCtx.Transforms != nil {
+		return dataCtx.Transforms
+	}
+	var transforms []DataTransform
+	if dataCtx.IsEnveloped {
+		transforms = append(transforms, EnvelopedTransform)
+	}
+	if dataCtx.Base64Transform {
+		transforms = append(transforms, Base64DecodeTransform)
+	}
+	if !dataCtx.Base64Transform || dataCtx.Base64DecodedXML {
+		transforms = append(transforms, CanonicalizationTransform)
+	}
+	if dataCtx.XSLTStylesheet != nil {
+		transforms = append(transforms, XSLTStylesheetTransform)
+	}
+	return transforms
+}
+
+// checkDataTransforms return error when the Transforms of dataCtx do not list each configured transform once,
+// in an order the transforms can be applied in
+func checkDataTransforms(dataCtx *SignedDataContext) error {
+	if dataCtx.Transforms == nil {
+		return nil
+	}
+	if dataCtx.OmitTransforms {
+		return errors.New("xades: OmitTransforms cannot be combined with Transforms")
+	}
+	index := map[DataTransform]int{}
+	for i, transform := range dataCtx.Transforms {
+		if transform < EnvelopedTransform || transform > XSLTStylesheetTransform {
+			return fmt.Errorf("xades: unknown data transform %d", transform)
+		}
+		if _, ok := index[transform]; ok {
+			return fmt.Errorf("xades: data transform %d is listed twice", transform)
+		}
+		index[transform] = i
+	}
+	_, enveloped := index[EnvelopedTransform]
+	_, base64Decode := index[Base64DecodeTransform]
+	c14n, canonicalize := index[CanonicalizationTransform]
+	xslt, applyXSLT := index[XSLTStylesheetTransform]
+	if enveloped != dataCtx.IsEnveloped || base64Decode != dataCtx.Base64Transform || applyXSLT != (dataCtx.XSLTStylesheet != nil) {
+		return errors.New("xades: Transforms must list the enveloped, base64 and XSLT transforms exactly when IsEnveloped, Base64Transform and XSLTStylesheet are set")
+	}
+	if base64Decode && canonicalize != dataCtx.Base64DecodedXML {
+		return errors.New("xades: with Base64Transform, Transforms lists canonicalization exactly when Base64DecodedXML")
+	}
+	if base64Decode && canonicalize && c14n < index[Base64DecodeTransform] {
+		return errors.New("xades: Transforms decodes base64 after canonicalization")
+	}
+	if applyXSLT && (!canonicalize || xslt < c14n || xslt != len(dataCtx.Transforms)-1) {
+		return errors.New("xades: Transforms must end with the XSLT transform after canonicalization")
+	}
+	return nil
+}
+
+// applyImplicitCanonicalization set the Canonicalizer of dataCtx to inclusive c14n 1.0, with comments when
+// keepComments, when its transforms leave the dereferenced node-set to the implicit conversion to octets
+func applyImplicitCanonicalization(dataCtx *SignedDataContext, keepComments bool) {
+	if (!dataCtx.OmitTransforms && dataCtx.Transforms == nil) || dataCtx.Base64Transform {
+		return
+	}
+	for _, transform := range dataCtx.Transforms {
+		if transform == CanonicalizationTransform {
+			return
+		}
+	}
+	dataCtx.Canonicalizer = implicitCanonicalizer(keepComments)
+}
+
+// implicitCanonicalizer return inclusive c14n 1.0, with comments when keepComments, which XML DSig converts the
+// node-set a reference ends with to octets by
+func implicitCanonicalizer(keepComments bool) dsig.Canonicalizer {
+	if keepComments {
+		return dsig.MakeC14N10WithCommentsCanonicalizer()
+	}
+	return dsig.MakeC14N10RecCanonicalizer()
+}
+
+// transformReference return the output of the data reference transforms of dataCtx over el: its canonical form,
+// transformed by XSLTStylesheet when set, or its decoded base64 text content, canonicalized as an XML document
+// with Base64DecodedXML
+func transformReference(dataCtx *SignedDataContext, el *etree.Element, keepComments bool) ([]byte, error) {
+	if dataCtx.Base64DecodedXML && !dataCtx.Base64Transform {
+		return nil, errors.New("xades: Base64DecodedXML requires Base64Transform")
+	}
+	if dataCtx.XSLTStylesheet != nil && dataCtx.Base64Transform {
+		return nil, errors.New("xades: XSLTStylesheet cannot be combined with Base64Transform")
+	}
+	if dataCtx.IsEnveloped && dataCtx.ExcludeSignatures {
+		var err error
+		if el, err = withoutSignatures(el); err != nil {
+			return nil, err
+		}
+	}
+	if !dataCtx.Base64Transform {
+		canonical, err := canonicalizeReference(dataCtx.Canonicalizer, el, nil, keepComments)
+		if err != nil || dataCtx.XSLTStylesheet == nil {
+			return canonical, err
+		}
+		transform, err := createXSLTTransform(dataCtx.XSLTStylesheet, "")
+		if err != nil {
+			return nil, err
+		}
+		return applyXSLTTransform(transform, canonical)
+	}
+	decoded, err := decodeBase64Transform(el)
+	if err != nil {
+		return nil, err
+	}
+	if !dataCtx.Base64DecodedXML {
+		return decoded, nil
+	}
+	return canonicalizeOctets(dataCtx.Canonicalizer, decoded)
+}
+
+// decodeBase64Transform decode the string value of el, the concatenation of its descendant text, as the base64
+// transform does. White space is ignored
+func decodeBase64Transform(el *etree.Element) ([]byte, error) {
+	var text strings.Builder
+	appendStringValue(&text, el)
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text.String()), ""))
+	if err != nil {
+		return nil, fmt.Errorf("xades: base64 transform input of <%v> is not valid base64: %v", el.FullTag(), err)
+	}
+	return decoded, nil
+}
+
+func appendStringValue(text *strings.Builder, el *etree.Element) {
+	for _, token := range el.Child {
+		switch token := token.(type) {
+		case *etree.CharData:
+			text.WriteString(token.Data)
+		case *etree.Element:
+			appendStringValue(text, token)
+		}
+	}
+}
+
+// canonicalizeOctets parse data, base64 decoded or external, as an XML document and canonicalize its root element
+func canonicalizeOctets(canonicalizer dsig.Canonicalizer, data []byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("xades: data is not XML: %v", err)
+	}
+	if doc.Root() == nil {
+		return nil, errors.New("xades: data has no root element")
+	}
+	return canonicalizer.Canonicalize(doc.Root())
+}
+
+// createXSLTTransform create ds:Transform of the XSLT transform embedding stylesheet, which must be an XML document
+func createXSLTTransform(stylesheet []byte, xmlDsigPrefix string) (*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(stylesheet); err != nil {
+		return nil, fmt.Errorf("xades: XSLT stylesheet is not XML: %v", err)
+	}
+	if doc.Root() == nil {
+		return nil, errors.New("xades: XSLT stylesheet has no root element")
+	}
+	return &etree.Element{
+		Space: xmlDsigPrefix,
+		Tag:   dsig.TransformTag,
+		Attr: []etree.Attr{
+			{Key: dsig.AlgorithmAttr, Value: XSLTTransformAlgorithmId},
+		},
+		Child: []etree.Token{doc.Root()},
+	}, nil
+}
+
+// applyXSLTTransform return the output of the registered XSLT engine over input with the stylesheet embedded in
+// transform. The stylesheet is passed as its serialization out of the signature, so signer and verifier agree on it
+func applyXSLTTransform(transform *etree.Element, input []byte) ([]byte, error) {
+	engine := registeredXSLTEngine()
+	if engine == nil {
+		return nil, errors.New("xades: XSLT transform requires an XSLT engine, see RegisterXSLTEngine")
+	}
+	children := transform.ChildElements()
+	if len(children) != 1 {
+		return nil, errors.New("xades: XSLT transform must embed exactly one stylesheet element")
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(children[0].Copy())
+	stylesheet, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, err
+	}
+	output, err := engine(stylesheet, input)
+	if err != nil {
+		return nil, fmt.Errorf("xades: XSLT transform failed: %v", err)
+	}
+	return output, nil
+}
@@ -0,0 +1,183 @@
+package xades
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBase64Transform(t *testing.T) {
+	content := []byte(`{"amount":"1.01","currency":"CZK"}`)
+	encoded := base64.StdEncoding.EncodeToString(content)
+	documentXML := `<payload id="signedData"><data>` + encoded[:20] + "\n" + encoded[20:] + `</data></payload>`
+
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.Base64Transform = true
+	root, signature := signAndReparse(t, documentXML, ctx)
+
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	transforms := reference.FindElements("ds:" + dsig.TransformsTag + "/ds:" + dsig.TransformTag)
+	require.Len(t, transforms, 2)
+	require.Equal(t, dsig.EnvelopedSignatureAltorithmId.String(), transforms[0].SelectAttrValue(dsig.AlgorithmAttr, ""))
+	require.Equal(t, Base64TransformAlgorithmId, transforms[1].SelectAttrValue(dsig.AlgorithmAttr, ""))
+	require.Equal(t, DigestBytes(content, crypto.SHA256), reference.FindElement("ds:"+dsig.DigestValueTag).Text())
+
+	_, err := (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+	root.FindElement("data").SetText(base64.StdEncoding.EncodeToString([]byte(`{"amount":"9.99"}`)))
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.Error(t, err)
+
+	embedded := `<a:doc xmlns:a="urn:a" xmlns:b="urn:b"><a:item>1</a:item></a:doc>`
+	documentXML = `<payload id="signedData">` + base64.StdEncoding.EncodeToString([]byte(embedded)) + `</payload>`
+	ctx.DataContext.Base64DecodedXML = true
+	root, signature = signAndReparse(t, documentXML, ctx)
+	transforms = signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "[1]/ds:" + dsig.TransformsTag + "/ds:" + dsig.TransformTag)
+	require.Len(t, transforms, 3)
+	require.Equal(t, dsig.CanonicalXML10ExclusiveAlgorithmId.String(), transforms[2].SelectAttrValue(dsig.AlgorithmAttr, ""))
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(embedded))
+	canonical, err := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("").Canonicalize(doc.Root())
+	require.NoError(t, err)
+	require.Equal(t, `<a:doc xmlns:a="urn:a"><a:item>1</a:item></a:doc>`, string(canonical))
+	require.Equal(t, DigestBytes(canonical, crypto.SHA256), signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.ReferenceTag+"/ds:"+dsig.DigestValueTag).Text())
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+
+	ctx.DataContext.Base64Transform = false
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+	ctx.DataContext.Base64Transform = true
+	ctx.DataContext.Base64DecodedXML = false
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+}
+
+func TestXSLTTransform(t *testing.T) {
+	const stylesheet = `<xsl:stylesheet xmlns:xsl="http://www.w3.org/1999/XSL/Transform" version="1.0"><xsl:template match="/"><xsl:value-of select="."/></xsl:template></xsl:stylesheet>`
+
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.XSLTStylesheet = []byte(stylesheet)
+	_, err := CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+
+	// a stand-in for a real engine, the digest only depends on its output
+	RegisterXSLTEngine(func(stylesheet []byte, input []byte) ([]byte, error) {
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(stylesheet); err != nil || doc.Root().Tag != "stylesheet" {
+			return nil, errors.New("not a stylesheet")
+		}
+		return bytes.ToUpper(input), nil
+	})
+	defer RegisterXSLTEngine(nil)
+
+	root, signature := signAndReparse(t, testXML, ctx)
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	transforms := reference.FindElements("ds:" + dsig.TransformsTag + "/ds:" + dsig.TransformTag)
+	require.Len(t, transforms, 3)
+	require.Equal(t, dsig.CanonicalXML10ExclusiveAlgorithmId.String(), transforms[1].SelectAttrValue(dsig.AlgorithmAttr, ""))
+	require.Equal(t, XSLTTransformAlgorithmId, transforms[2].SelectAttrValue(dsig.AlgorithmAttr, ""))
+	embedded := transforms[2].SelectElement("xsl:stylesheet")
+	require.NotNil(t, embedded)
+	require.Equal(t, "http://www.w3.org/1999/XSL/Transform", embedded.NamespaceURI())
+
+	canonical, err := canonicalizeReference(dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""), newTestSignedData(t), nil, false)
+	require.NoError(t, err)
+	require.Equal(t, DigestBytes(bytes.ToUpper(canonical), crypto.SHA256), reference.FindElement("ds:"+dsig.DigestValueTag).Text())
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+
+	root.SelectElement("xid").SetText("tampered")
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.Error(t, err)
+
+	ctx.DataContext.XSLTStylesheet = []byte("not a stylesheet")
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+	ctx.DataContext.XSLTStylesheet = []byte(stylesheet)
+	ctx.DataContext.Base64Transform = true
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.Error(t, err)
+}
+
+func TestOmitTransforms(t *testing.T) {
+	const documentXML = `<root xmlns="urn:example:root" xmlns:unused="urn:example:unused"><first Id="first">one<!-- note --></first></root>`
+
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.IsEnveloped = false
+	ctx.DataContext.OmitTransforms = true
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(documentXML))
+	signature, err := SignElementByID(doc, "first", ctx)
+	require.NoError(t, err)
+
+	reference := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag)
+	require.Nil(t, reference.SelectElement("ds:"+dsig.TransformsTag))
+	// inclusive c14n renders every namespace in scope and drops the comment of a "#id" reference
+	expected := `<first xmlns="urn:example:root" xmlns:unused="urn:example:unused" Id="first">one</first>`
+	require.Equal(t, DigestBytes([]byte(expected), crypto.SHA256), reference.SelectElement("ds:"+dsig.DigestValueTag).Text())
+
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+	_, err = (&VerifyContext{}).Verify(parsed.Root().SelectElement("ds:"+dsig.SignatureTag), parsed.Root())
+	require.NoError(t, err)
+
+	ctx.DataContext.IsEnveloped = true
+	_, err = CreateSignature(newTestSignedData(t), ctx)
+	require.EqualError(t, err, "xades: OmitTransforms cannot be combined with IsEnveloped, Base64Transform or XSLTStylesheet")
+}
+
+func TestDataTransforms(t *testing.T) {
+	algorithms := func(signature *etree.Element) []string {
+		var algorithms []string
+		for _, transform := range signature.FindElements("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "[1]/ds:" + dsig.TransformsTag + "/ds:" + dsig.TransformTag) {
+			algorithms = append(algorithms, transform.SelectAttrValue(dsig.AlgorithmAttr, ""))
+		}
+		return algorithms
+	}
+	enveloped := dsig.EnvelopedSignatureAltorithmId.String()
+	exclusive := dsig.CanonicalXML10ExclusiveAlgorithmId.String()
+
+	ctx := newTestSigningContext(t)
+	_, signature := signAndReparse(t, testXML, ctx)
+	require.Equal(t, []string{enveloped, exclusive}, algorithms(signature))
+	ctx.DataContext.Transforms = []DataTransform{EnvelopedTransform, CanonicalizationTransform}
+	_, preset := signAndReparse(t, testXML, ctx)
+	require.Equal(t, algorithms(signature), algorithms(preset))
+
+	ctx.DataContext.Transforms = []DataTransform{CanonicalizationTransform, EnvelopedTransform}
+	root, signature := signAndReparse(t, testXML, ctx)
+	require.Equal(t, []string{exclusive, enveloped}, algorithms(signature))
+	_, err := (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+
+	// the canonicalization transform left implicit
+	ctx.DataContext.Transforms = []DataTransform{EnvelopedTransform}
+	root, signature = signAndReparse(t, testXML, ctx)
+	require.Equal(t, []string{enveloped}, algorithms(signature))
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+	canonical, err := dsig.MakeC14N10RecCanonicalizer().Canonicalize(newTestSignedData(t))
+	require.NoError(t, err)
+	digestValue := signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "/ds:" + dsig.DigestValueTag)
+	require.Equal(t, DigestBytes(canonical, crypto.SHA256), digestValue.Text())
+
+	for _, transforms := range [][]DataTransform{
+		{CanonicalizationTransform},
+		{EnvelopedTransform, EnvelopedTransform, CanonicalizationTransform},
+		{EnvelopedTransform, XSLTStylesheetTransform},
+		{EnvelopedTransform, DataTransform(42)},
+	} {
+		ctx.DataContext.Transforms = transforms
+		_, err = CreateSignature(newTestSignedData(t), ctx)
+		require.Error(t, err, "%v", transforms)
+	}
+}
@@ -0,0 +1,341 @@
+package xades
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	UnsignedPropertiesTag          string = "UnsignedProperties"
+	UnsignedSignaturePropertiesTag string = "UnsignedSignatureProperties"
+	CompleteCertificateRefsTag     string = "CompleteCertificateRefs"
+	CertRefsTag                    string = "CertRefs"
+	CompleteRevocationRefsTag      string = "CompleteRevocationRefs"
+	CRLRefsTag                     string = "CRLRefs"
+	CRLRefTag                      string = "CRLRef"
+	CRLIdentifierTag               string = "CRLIdentifier"
+	OCSPRefsTag                    string = "OCSPRefs"
+	OCSPRefTag                     string = "OCSPRef"
+	OCSPIdentifierTag              string = "OCSPIdentifier"
+	ResponderIDTag                 string = "ResponderID"
+	ByNameTag                      string = "ByName"
+	ByKeyTag                       string = "ByKey"
+	ProducedAtTag                  string = "ProducedAt"
+	DigestAlgAndValueTag           string = "DigestAlgAndValue"
+	IssuerTag                      string = "Issuer"
+	IssueTimeTag                   string = "IssueTime"
+	NumberTag                      string = "Number"
+	CertificateValuesTag           string = "CertificateValues"
+	EncapsulatedX509CertificateTag string = "EncapsulatedX509Certificate"
+	RevocationValuesTag            string = "RevocationValues"
+	CRLValuesTag                   string = "CRLValues"
+	EncapsulatedCRLValueTag        string = "EncapsulatedCRLValue"
+	OCSPValuesTag                  string = "OCSPValues"
+	EncapsulatedOCSPValueTag       string = "EncapsulatedOCSPValue"
+	ArchiveTimeStampTag            string = "ArchiveTimeStamp"
+	SignatureTimeStampTag          string = "SignatureTimeStamp"
+)
+
+// CompleteReferencesContext configure the XAdES-C CompleteCertificateRefs and CompleteRevocationRefs properties
+type CompleteReferencesContext struct {
+	// CertChain CA certificates of the certification path, the signing certificate is excluded
+	CertChain []*x509.Certificate
+	// CRLRefs references to the CRLs used to validate the certification path
+	CRLRefs []CRLReference
+	// OCSPRefs references to the OCSP responses used to validate the certification path
+	OCSPRefs []OCSPReference
+	// Hash used for all certificate and revocation data digests
+	Hash crypto.Hash
+	// IssuerNameFormat renders X509IssuerName of the CertRefs, GoIssuerName when nil
+	IssuerNameFormat IssuerNameFormat
+}
+
+// CRLReference identify a CRL by its DER encoding and CRLIdentifier fields
+type CRLReference struct {
+	CRL       []byte
+	Issuer    string
+	IssueTime time.Time
+	// Number is the CRL number, omitted when nil
+	Number *big.Int
+}
+
+var oidExtensionCRLNumber = asn1.ObjectIdentifier{2, 5, 29, 20}
+
+// NewCRLReference create CRLReference for the DER encoded CRL crl, Issuer, IssueTime and Number are taken from
+// its issuer, thisUpdate and CRL number extension. The CRL digest uses CompleteReferencesContext.Hash.
+// crl is parsed as a CertificateList rather than an x509.RevocationList, which lacks the issuer and the DER
+// encoding before Go 1.19; the signature of the CRL is not checked
+func NewCRLReference(crl []byte) (CRLReference, error) {
+
+	var certList pkix.CertificateList
+	rest, err := asn1.Unmarshal(crl, &certList)
+	if err != nil {
+		return CRLReference{}, fmt.Errorf("xades: parsing CRL: %w", err)
+	}
+	if len(rest) > 0 {
+		return CRLReference{}, errors.New("xades: trailing data after CRL")
+	}
+
+	var issuer pkix.Name
+	issuer.FillFromRDNSequence(&certList.TBSCertList.Issuer)
+	ref := CRLReference{
+		CRL:       crl,
+		Issuer:    issuer.String(),
+		IssueTime: certList.TBSCertList.ThisUpdate,
+	}
+	for _, extension := range certList.TBSCertList.Extensions {
+		if !extension.Id.Equal(oidExtensionCRLNumber) {
+			continue
+		}
+		if rest, err := asn1.Unmarshal(extension.Value, &ref.Number); err != nil || len(rest) > 0 {
+			return CRLReference{}, errors.New("xades: malformed CRL number extension")
+		}
+	}
+	return ref, nil
+}
+
+// OCSPReference identify an OCSP response by its DER encoding and OCSPIdentifier fields
+type OCSPReference struct {
+	Response []byte
+	// ResponderName is the responder distinguished name, used as ResponderID/ByName when set
+	ResponderName string
+	// ResponderKeyHash is the SHA-1 hash of the responder public key, used as ResponderID/ByKey when ResponderName is empty
+	ResponderKeyHash []byte
+	ProducedAt       time.Time
+}
+
+// AddCompleteReferences add xades:CompleteCertificateRefs and xades:CompleteRevocationRefs to the
+// UnsignedSignatureProperties of signature, upgrading it to XAdES-C
+func AddCompleteReferences(signature *etree.Element, refsCtx *CompleteReferencesContext) error {
+
+	xmlDsigPrefix := signature.Space
+	completeCertificateRefs := createCompleteCertificateRefs(refsCtx, xmlDsigPrefix)
+	completeRevocationRefs, err := createCompleteRevocationRefs(refsCtx, xmlDsigPrefix)
+	if err != nil {
+		return err
+	}
+
+	unsignedSignatureProperties, err := findOrCreateUnsignedSignatureProperties(signature)
+	if err != nil {
+		return err
+	}
+	unsignedSignatureProperties.AddChild(completeCertificateRefs)
+	unsignedSignatureProperties.AddChild(completeRevocationRefs)
+	return nil
+}
+
+func createCompleteCertificateRefs(refsCtx *CompleteReferencesContext, xmlDsigPrefix string) *etree.Element {
+
+	certRefs := etree.Element{
+		Space: Prefix,
+		Tag:   CertRefsTag,
+	}
+	for _, cert := range refsCtx.CertChain {
+		certRefs.AddChild(createCert(cert, cert.Raw, refsCtx.Hash, refsCtx.IssuerNameFormat, xmlDsigPrefix))
+	}
+
+	completeCertificateRefs := etree.Element{
+		Space: Prefix,
+		Tag:   CompleteCertificateRefsTag,
+		Child: []etree.Token{&certRefs},
+	}
+	return &completeCertificateRefs
+}
+
+func createCompleteRevocationRefs(refsCtx *CompleteReferencesContext, xmlDsigPrefix string) (*etree.Element, error) {
+
+	completeRevocationRefs := etree.Element{
+		Space: Prefix,
+		Tag:   CompleteRevocationRefsTag,
+	}
+
+	if len(refsCtx.CRLRefs) > 0 {
+		crlRefs := etree.Element{
+			Space: Prefix,
+			Tag:   CRLRefsTag,
+		}
+		for i := range refsCtx.CRLRefs {
+			crlRefs.AddChild(createCRLRef(&refsCtx.CRLRefs[i], refsCtx.Hash, xmlDsigPrefix))
+		}
+		completeRevocationRefs.AddChild(&crlRefs)
+	}
+
+	if len(refsCtx.OCSPRefs) > 0 {
+		ocspRefs := etree.Element{
+			Space: Prefix,
+			Tag:   OCSPRefsTag,
+		}
+		for i := range refsCtx.OCSPRefs {
+			ocspRef, err := createOCSPRef(&refsCtx.OCSPRefs[i], refsCtx.Hash, xmlDsigPrefix)
+			if err != nil {
+				return nil, err
+			}
+			ocspRefs.AddChild(ocspRef)
+		}
+		completeRevocationRefs.AddChild(&ocspRefs)
+	}
+
+	return &completeRevocationRefs, nil
+}
+
+func createCRLRef(ref *CRLReference, hash crypto.Hash, xmlDsigPrefix string) *etree.Element {
+
+	crlIdentifier := etree.Element{
+		Space: Prefix,
+		Tag:   CRLIdentifierTag,
+	}
+	crlIdentifier.CreateElement(Prefix + ":" + IssuerTag).SetText(ref.Issuer)
+	crlIdentifier.CreateElement(Prefix + ":" + IssueTimeTag).SetText(ref.IssueTime.UTC().Format(timeFormat))
+	if ref.Number != nil {
+		crlIdentifier.CreateElement(Prefix + ":" + NumberTag).SetText(ref.Number.String())
+	}
+
+	crlRef := etree.Element{
+		Space: Prefix,
+		Tag:   CRLRefTag,
+		Child: []etree.Token{createDigestAlgAndValue(DigestAlgAndValueTag, ref.CRL, hash, xmlDsigPrefix), &crlIdentifier},
+	}
+	return &crlRef
+}
+
+func createOCSPRef(ref *OCSPReference, hash crypto.Hash, xmlDsigPrefix string) (*etree.Element, error) {
+
+	responderID := etree.Element{
+		Space: Prefix,
+		Tag:   ResponderIDTag,
+	}
+	switch {
+	case ref.ResponderName != "":
+		responderID.CreateElement(Prefix + ":" + ByNameTag).SetText(ref.ResponderName)
+	case len(ref.ResponderKeyHash) > 0:
+		responderID.CreateElement(Prefix + ":" + ByKeyTag).SetText(base64.StdEncoding.EncodeToString(ref.ResponderKeyHash))
+	default:
+		return nil, errors.New("xades: OCSP reference requires ResponderName or ResponderKeyHash")
+	}
+
+	ocspIdentifier := etree.Element{
+		Space: Prefix,
+		Tag:   OCSPIdentifierTag,
+		Child: []etree.Token{&responderID},
+	}
+	ocspIdentifier.CreateElement(Prefix + ":" + ProducedAtTag).SetText(ref.ProducedAt.UTC().Format(timeFormat))
+
+	ocspRef := etree.Element{
+		Space: Prefix,
+		Tag:   OCSPRefTag,
+		Child: []etree.Token{&ocspIdentifier, createDigestAlgAndValue(DigestAlgAndValueTag, ref.Response, hash, xmlDsigPrefix)},
+	}
+	return &ocspRef, nil
+}
+
+// ValidationValuesContext hold the XAdES-XL CertificateValues and RevocationValues material
+type ValidationValuesContext struct {
+	// CertChain CA certificates of the certification path, the signing certificate is excluded
+	CertChain []*x509.Certificate
+	// CRLs DER encoded CRLs
+	CRLs [][]byte
+	// OCSPResponses DER encoded OCSP responses
+	OCSPResponses [][]byte
+}
+
+// AddValidationValues add xades:CertificateValues and xades:RevocationValues to the UnsignedSignatureProperties
+// of signature, upgrading a XAdES-C signature to XAdES-XL. Ids are derived from the Id of signature and use its
+// attribute name.
+func AddValidationValues(signature *etree.Element, valuesCtx *ValidationValuesContext) error {
+
+	unsignedSignatureProperties, err := findOrCreateUnsignedSignatureProperties(signature)
+	if err != nil {
+		return err
+	}
+	signatureId, idAttribute := elementId(signature), idAttributeName(signature)
+
+	certificateValues := createValuesElement(CertificateValuesTag, signatureId, idAttribute)
+	for i, cert := range valuesCtx.CertChain {
+		certificateValues.AddChild(createEncapsulatedValue(EncapsulatedX509CertificateTag, cert.Raw, signatureId, idAttribute, i))
+	}
+
+	revocationValues := createValuesElement(RevocationValuesTag, signatureId, idAttribute)
+	if len(valuesCtx.CRLs) > 0 {
+		crlValues := revocationValues.CreateElement(Prefix + ":" + CRLValuesTag)
+		for i, crl := range valuesCtx.CRLs {
+			crlValues.AddChild(createEncapsulatedValue(EncapsulatedCRLValueTag, crl, signatureId, idAttribute, i))
+		}
+	}
+	if len(valuesCtx.OCSPResponses) > 0 {
+		ocspValues := revocationValues.CreateElement(Prefix + ":" + OCSPValuesTag)
+		for i, response := range valuesCtx.OCSPResponses {
+			ocspValues.AddChild(createEncapsulatedValue(EncapsulatedOCSPValueTag, response, signatureId, idAttribute, i))
+		}
+	}
+
+	unsignedSignatureProperties.AddChild(certificateValues)
+	unsignedSignatureProperties.AddChild(revocationValues)
+	return nil
+}
+
+func createValuesElement(tag string, signatureId string, idAttribute string) *etree.Element {
+	values := etree.Element{
+		Space: Prefix,
+		Tag:   tag,
+		Attr: []etree.Attr{
+			idAttr(idAttribute, fmt.Sprintf("%v-%v", signatureId, tag)),
+		},
+	}
+	return &values
+}
+
+func createEncapsulatedValue(tag string, data []byte, signatureId string, idAttribute string, index int) *etree.Element {
+	encapsulated := etree.Element{
+		Space: Prefix,
+		Tag:   tag,
+		Attr: []etree.Attr{
+			idAttr(idAttribute, fmt.Sprintf("%v-%v-%d", signatureId, tag, index+1)),
+		},
+	}
+	encapsulated.SetText(base64.StdEncoding.EncodeToString(data))
+	return &encapsulated
+}
+
+// findOrCreateUnsignedSignatureProperties return xades:UnsignedProperties/UnsignedSignatureProperties of signature,
+// creating the missing elements after SignedProperties
+func findOrCreateUnsignedSignatureProperties(signature *etree.Element) (*etree.Element, error) {
+
+	qualifyingProperties := findQualifyingProperties(signature)
+	if qualifyingProperties == nil {
+		return nil, errors.New("xades: signature has no QualifyingProperties")
+	}
+
+	unsignedProperties := findChild(qualifyingProperties, UnsignedPropertiesTag)
+	if unsignedProperties == nil {
+		unsignedProperties = qualifyingProperties.CreateElement(Prefix + ":" + UnsignedPropertiesTag)
+	}
+
+	unsignedSignatureProperties := findChild(unsignedProperties, UnsignedSignaturePropertiesTag)
+	if unsignedSignatureProperties == nil {
+		unsignedSignatureProperties = etree.NewElement(Prefix + ":" + UnsignedSignaturePropertiesTag)
+		unsignedProperties.InsertChildAt(0, unsignedSignatureProperties)
+	}
+	return unsignedSignatureProperties, nil
+}
+
+// findQualifyingProperties return xades:QualifyingProperties held by a ds:Object of signature
+func findQualifyingProperties(signature *etree.Element) *etree.Element {
+	for _, object := range signature.ChildElements() {
+		if object.Tag != "Object" {
+			continue
+		}
+		if qualifyingProperties := findChild(object, QualifyingPropertiesTag); qualifyingProperties != nil {
+			return qualifyingProperties
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package xades
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func unsignedSignaturePropertiesPath(xmlDsigPrefix string) string {
+	return xmlDsigPrefix + ":Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + UnsignedPropertiesTag + "/" + Prefix + ":" + UnsignedSignaturePropertiesTag
+}
+
+func TestAddCompleteReferences(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	ca := newTestKeyStoreFromTemplate(t, &x509.Certificate{SerialNumber: big.NewInt(42), IsCA: true, BasicConstraintsValid: true})
+	producedAt := time.Date(2020, 1, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600))
+	refsCtx := &CompleteReferencesContext{
+		CertChain: []*x509.Certificate{ca.Cert},
+		CRLRefs: []CRLReference{
+			{CRL: []byte("crl"), Issuer: "CN=Test CA", IssueTime: producedAt, Number: big.NewInt(7)},
+		},
+		OCSPRefs: []OCSPReference{
+			{Response: []byte("ocsp"), ResponderName: "CN=Test OCSP", ProducedAt: producedAt},
+			{Response: []byte("ocsp2"), ResponderKeyHash: []byte{1, 2, 3}, ProducedAt: producedAt},
+		},
+		Hash: crypto.SHA256,
+	}
+	require.NoError(t, AddCompleteReferences(signature, refsCtx))
+
+	unsignedSignatureProperties := signature.FindElement(unsignedSignaturePropertiesPath("ds"))
+	require.NotEmpty(t, unsignedSignatureProperties)
+	children := unsignedSignatureProperties.ChildElements()
+	require.Len(t, children, 2)
+	require.Equal(t, CompleteCertificateRefsTag, children[0].Tag)
+	require.Equal(t, CompleteRevocationRefsTag, children[1].Tag)
+
+	certs := children[0].FindElements(Prefix + ":" + CertRefsTag + "/" + Prefix + ":" + CertTag)
+	require.Len(t, certs, 1)
+	require.Equal(t, DigestBytes(ca.CertBinary, crypto.SHA256), certs[0].FindElement(Prefix+":"+CertDigestTag+"/ds:"+dsig.DigestValueTag).Text())
+	require.Equal(t, "42", certs[0].FindElement(Prefix+":"+IssuerSerialTag+"/ds:"+x509SerialNumberTag).Text())
+
+	crlRef := children[1].FindElement(Prefix + ":" + CRLRefsTag + "/" + Prefix + ":" + CRLRefTag)
+	require.NotEmpty(t, crlRef)
+	require.Equal(t, DigestBytes([]byte("crl"), crypto.SHA256), crlRef.FindElement(Prefix+":"+DigestAlgAndValueTag+"/ds:"+dsig.DigestValueTag).Text())
+	require.Equal(t, "CN=Test CA", crlRef.FindElement(Prefix+":"+CRLIdentifierTag+"/"+Prefix+":"+IssuerTag).Text())
+	require.Equal(t, "2020-01-01T00:00:00Z", crlRef.FindElement(Prefix+":"+CRLIdentifierTag+"/"+Prefix+":"+IssueTimeTag).Text())
+	require.Equal(t, "7", crlRef.FindElement(Prefix+":"+CRLIdentifierTag+"/"+Prefix+":"+NumberTag).Text())
+
+	ocspRefs := children[1].FindElements(Prefix + ":" + OCSPRefsTag + "/" + Prefix + ":" + OCSPRefTag)
+	require.Len(t, ocspRefs, 2)
+	require.Equal(t, "CN=Test OCSP", ocspRefs[0].FindElement(Prefix+":"+OCSPIdentifierTag+"/"+Prefix+":"+ResponderIDTag+"/"+Prefix+":"+ByNameTag).Text())
+	require.Equal(t, "AQID", ocspRefs[1].FindElement(Prefix+":"+OCSPIdentifierTag+"/"+Prefix+":"+ResponderIDTag+"/"+Prefix+":"+ByKeyTag).Text())
+	require.Equal(t, DigestBytes([]byte("ocsp"), crypto.SHA256), ocspRefs[0].FindElement(Prefix+":"+DigestAlgAndValueTag+"/ds:"+dsig.DigestValueTag).Text())
+
+	refsCtx.OCSPRefs = []OCSPReference{{Response: []byte("ocsp")}}
+	require.Error(t, AddCompleteReferences(signature, refsCtx))
+	require.Len(t, unsignedSignatureProperties.ChildElements(), 2)
+}
+
+func TestAddValidationValues(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	ca := newTestKeyStoreFromTemplate(t, &x509.Certificate{IsCA: true, BasicConstraintsValid: true})
+	valuesCtx := &ValidationValuesContext{
+		CertChain:     []*x509.Certificate{ca.Cert, ca.Cert},
+		CRLs:          [][]byte{[]byte("crl")},
+		OCSPResponses: [][]byte{[]byte("ocsp1"), []byte("ocsp2")},
+	}
+	require.NoError(t, AddValidationValues(signature, valuesCtx))
+
+	unsignedSignatureProperties := signature.FindElement(unsignedSignaturePropertiesPath("ds"))
+	require.NotEmpty(t, unsignedSignatureProperties)
+	children := unsignedSignatureProperties.ChildElements()
+	require.Len(t, children, 2)
+	require.Equal(t, CertificateValuesTag, children[0].Tag)
+	require.Equal(t, RevocationValuesTag, children[1].Tag)
+
+	certs := children[0].FindElements(Prefix + ":" + EncapsulatedX509CertificateTag)
+	require.Len(t, certs, 2)
+	require.Equal(t, base64.StdEncoding.EncodeToString(ca.CertBinary), certs[0].Text())
+
+	revocationValues := children[1].ChildElements()
+	require.Len(t, revocationValues, 2)
+	require.Equal(t, CRLValuesTag, revocationValues[0].Tag)
+	require.Equal(t, OCSPValuesTag, revocationValues[1].Tag)
+	ocspValues := revocationValues[1].FindElements(Prefix + ":" + EncapsulatedOCSPValueTag)
+	require.Len(t, ocspValues, 2)
+	require.Equal(t, base64.StdEncoding.EncodeToString([]byte("ocsp2")), ocspValues[1].Text())
+
+	ids := map[string]bool{}
+	for _, el := range signature.FindElements("//[@Id]") {
+		id := el.SelectAttrValue("Id", "")
+		require.False(t, ids[id], id)
+		ids[id] = true
+	}
+	require.Len(t, ids, 9)
+}
+
+func TestNewCRLReference(t *testing.T) {
+	ca := newTestKeyStoreFromTemplate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA", Organization: []string{"Example"}},
+		SerialNumber:          big.NewInt(42),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	})
+	thisUpdate := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1234),
+		ThisUpdate: thisUpdate,
+		NextUpdate: thisUpdate.Add(24 * time.Hour),
+	}, ca.Cert, ca.PrivateKey)
+	require.NoError(t, err)
+
+	ref, err := NewCRLReference(crl)
+	require.NoError(t, err)
+	require.Equal(t, crl, ref.CRL)
+	require.Equal(t, ca.Cert.Subject.String(), ref.Issuer)
+	require.True(t, thisUpdate.Equal(ref.IssueTime))
+	require.Equal(t, "1234", ref.Number.String())
+
+	crlRef := createCRLRef(&ref, crypto.SHA256, "ds")
+	require.Equal(t, DigestBytes(crl, crypto.SHA256), crlRef.FindElement(Prefix+":"+DigestAlgAndValueTag+"/ds:"+dsig.DigestValueTag).Text())
+	require.Equal(t, "2020-01-01T00:00:00Z", crlRef.FindElement(Prefix+":"+CRLIdentifierTag+"/"+Prefix+":"+IssueTimeTag).Text())
+
+	_, err = NewCRLReference([]byte("not a CRL"))
+	require.Error(t, err)
+}
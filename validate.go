@@ -0,0 +1,227 @@
+package xades
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// childRule is one particle of a sequence content model: tag occurs between min and max times, max < 0 is unbounded
+type childRule struct {
+	tag string
+	min int
+	max int
+}
+
+var signatureContent = []childRule{
+	{dsig.SignedInfoTag, 1, 1},
+	{dsig.SignatureValueTag, 1, 1},
+	{dsig.KeyInfoTag, 0, 1},
+	{"Object", 0, -1},
+}
+
+var signedInfoContent = []childRule{
+	{dsig.CanonicalizationMethodTag, 1, 1},
+	{dsig.SignatureMethodTag, 1, 1},
+	{dsig.ReferenceTag, 1, -1},
+}
+
+var referenceContent = []childRule{
+	{dsig.TransformsTag, 0, 1},
+	{dsig.DigestMethodTag, 1, 1},
+	{dsig.DigestValueTag, 1, 1},
+}
+
+var qualifyingPropertiesContent = []childRule{
+	{SignedPropertiesTag, 0, 1},
+	{UnsignedPropertiesTag, 0, 1},
+}
+
+var signedPropertiesContent = []childRule{
+	{SignedSignaturePropertiesTag, 0, 1},
+	{SignedDataObjectPropertiesTag, 0, 1},
+}
+
+var signedSignaturePropertiesContent = []childRule{
+	{SigningTimeTag, 0, 1},
+	{SigningCertificateTag, 0, 1},
+	{SigningCertificateV2Tag, 0, 1},
+	{SignaturePolicyIdentifierTag, 0, 1},
+	{"SignatureProductionPlace", 0, 1},
+	{"SignatureProductionPlaceV2", 0, 1},
+	{SignerRoleTag, 0, 1},
+	{"SignerRoleV2", 0, 1},
+}
+
+var signedDataObjectPropertiesContent = []childRule{
+	{"DataObjectFormat", 0, -1},
+	{"CommitmentTypeIndication", 0, -1},
+	{AllDataObjectsTimeStampTag, 0, -1},
+	{IndividualDataObjectsTimeStampTag, 0, -1},
+}
+
+var unsignedPropertiesContent = []childRule{
+	{UnsignedSignaturePropertiesTag, 0, 1},
+	{"UnsignedDataObjectProperties", 0, 1},
+}
+
+// ValidateStructure check sig against the content models of the XML DSig and XAdES schemas: child ordering and
+// cardinality of Signature, SignedInfo, the references and the QualifyingProperties hierarchy, the presence of
+// a data reference and of a SignedProperties reference resolving to the SignedProperties of the signature.
+// Signature values and digests are not verified.
+func ValidateStructure(sig *etree.Element) error {
+
+	if sig.Tag != dsig.SignatureTag {
+		return fmt.Errorf("xades: expected %v element, got <%v>", dsig.SignatureTag, sig.FullTag())
+	}
+	if err := checkContent(sig, signatureContent); err != nil {
+		return err
+	}
+
+	signedInfo := findChild(sig, dsig.SignedInfoTag)
+	if err := checkSignedInfoOrder(signedInfo); err != nil {
+		return err
+	}
+	var dataReferences, propertiesReferences []*etree.Element
+	for _, reference := range signedInfo.ChildElements() {
+		if reference.Tag != dsig.ReferenceTag {
+			continue
+		}
+		if err := checkContent(reference, referenceContent); err != nil {
+			return err
+		}
+		if isSignedPropertiesReference(reference, sig) {
+			propertiesReferences = append(propertiesReferences, reference)
+		} else {
+			dataReferences = append(dataReferences, reference)
+		}
+	}
+	if len(dataReferences) == 0 {
+		return errors.New("xades: SignedInfo has no data reference")
+	}
+	if len(propertiesReferences) != 1 {
+		return fmt.Errorf("xades: SignedInfo must have exactly one SignedProperties reference, got %v", len(propertiesReferences))
+	}
+
+	qualifyingProperties := findQualifyingProperties(sig)
+	if qualifyingProperties == nil {
+		return errors.New("xades: signature has no QualifyingProperties")
+	}
+	if target := qualifyingProperties.SelectAttrValue(targetAttr, ""); target != "#"+elementId(sig) {
+		return fmt.Errorf("xades: QualifyingProperties Target %q does not reference the signature", target)
+	}
+	if err := checkContent(qualifyingProperties, qualifyingPropertiesContent); err != nil {
+		return err
+	}
+
+	signedProperties := findChild(qualifyingProperties, SignedPropertiesTag)
+	if signedProperties == nil {
+		return errors.New("xades: QualifyingProperties has no SignedProperties")
+	}
+	uri := propertiesReferences[0].SelectAttrValue(dsig.URIAttr, "")
+	if uri != "#"+elementId(signedProperties) {
+		return fmt.Errorf("xades: SignedProperties reference URI %q does not match the SignedProperties Id", uri)
+	}
+	if err := checkContent(signedProperties, signedPropertiesContent); err != nil {
+		return err
+	}
+	if el := findChild(signedProperties, SignedSignaturePropertiesTag); el != nil {
+		if err := checkContent(el, signedSignaturePropertiesContent); err != nil {
+			return err
+		}
+	}
+	if el := findChild(signedProperties, SignedDataObjectPropertiesTag); el != nil {
+		if err := checkContent(el, signedDataObjectPropertiesContent); err != nil {
+			return err
+		}
+		if err := checkObjectReferences(el, dataReferences); err != nil {
+			return err
+		}
+	}
+	if el := findChild(qualifyingProperties, UnsignedPropertiesTag); el != nil {
+		if err := checkContent(el, unsignedPropertiesContent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkObjectReferences check that the ObjectReference of every DataObjectFormat and the Include URIs of every
+// IndividualDataObjectsTimeStamp point at the Id of a data reference
+func checkObjectReferences(signedDataObjectProperties *etree.Element, dataReferences []*etree.Element) error {
+	for _, property := range signedDataObjectProperties.ChildElements() {
+		switch property.Tag {
+		case DataObjectFormatTag:
+			objectReference := property.SelectAttrValue("ObjectReference", "")
+			if !isDataReferenceURI(objectReference, dataReferences) {
+				return fmt.Errorf("xades: DataObjectFormat ObjectReference %q does not match the Id of a data reference", objectReference)
+			}
+		case IndividualDataObjectsTimeStampTag:
+			for _, include := range property.ChildElements() {
+				if include.Tag != IncludeTag {
+					continue
+				}
+				if uri := include.SelectAttrValue(dsig.URIAttr, ""); !isDataReferenceURI(uri, dataReferences) {
+					return fmt.Errorf("xades: IndividualDataObjectsTimeStamp Include %q does not match the Id of a data reference", uri)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isDataReferenceURI tell whether uri is "#" followed by the Id of one of dataReferences, or an XPointer
+// "#xpointer(id('Id'))" to it
+func isDataReferenceURI(uri string, dataReferences []*etree.Element) bool {
+	uriId, _ := referenceURIId(uri)
+	for _, reference := range dataReferences {
+		if id := elementId(reference); id != "" && uriId == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSignedInfoOrder check that signedInfo holds CanonicalizationMethod, then SignatureMethod, then one or more
+// Reference and nothing else, as the XML DSig schema mandates
+func checkSignedInfoOrder(signedInfo *etree.Element) error {
+	return checkContent(signedInfo, signedInfoContent)
+}
+
+// checkContent check that the child elements of el, by local name, match the sequence rules
+func checkContent(el *etree.Element, rules []childRule) error {
+	children := el.ChildElements()
+	i := 0
+	for _, rule := range rules {
+		count := 0
+		for i < len(children) && children[i].Tag == rule.tag && (rule.max < 0 || count < rule.max) {
+			count++
+			i++
+		}
+		if count < rule.min {
+			return fmt.Errorf("xades: <%v> requires %v before %v", el.FullTag(), rule.tag, describeChild(children, i))
+		}
+	}
+	if i < len(children) {
+		return fmt.Errorf("xades: <%v> has unexpected %v, expected sequence %v", el.FullTag(), describeChild(children, i), describeRules(rules))
+	}
+	return nil
+}
+
+func describeChild(children []*etree.Element, i int) string {
+	if i < len(children) {
+		return fmt.Sprintf("<%v> at position %v", children[i].FullTag(), i+1)
+	}
+	return "end of content"
+}
+
+func describeRules(rules []childRule) string {
+	tags := make([]string, len(rules))
+	for i, rule := range rules {
+		tags[i] = rule.tag
+	}
+	return strings.Join(tags, ", ")
+}
@@ -0,0 +1,82 @@
+package xades
+
+import (
+	"testing"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateStructure(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.NoError(t, ValidateStructure(signature))
+
+	reordered := signature.Copy()
+	signedInfo := findChild(reordered, dsig.SignedInfoTag)
+	signatureMethod := findChild(signedInfo, dsig.SignatureMethodTag)
+	signedInfo.RemoveChild(signatureMethod)
+	signedInfo.InsertChildAt(0, signatureMethod)
+	err = ValidateStructure(reordered)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), dsig.CanonicalizationMethodTag)
+
+	missingReference := signature.Copy()
+	signedInfo = findChild(missingReference, dsig.SignedInfoTag)
+	signedInfo.RemoveChild(signedInfo.SelectElements("ds:" + dsig.ReferenceTag)[1])
+	require.Error(t, ValidateStructure(missingReference))
+
+	missingSignedProperties := signature.Copy()
+	qualifyingProperties := findQualifyingProperties(missingSignedProperties)
+	qualifyingProperties.RemoveChild(findChild(qualifyingProperties, SignedPropertiesTag))
+	require.Error(t, ValidateStructure(missingSignedProperties))
+
+	wrongId := signature.Copy()
+	findChild(findQualifyingProperties(wrongId), SignedPropertiesTag).CreateAttr("Id", "other")
+	err = ValidateStructure(wrongId)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SignedProperties reference URI")
+
+	misplacedKeyInfo := signature.Copy()
+	keyInfo := findChild(misplacedKeyInfo, dsig.KeyInfoTag)
+	misplacedKeyInfo.RemoveChild(keyInfo)
+	misplacedKeyInfo.AddChild(keyInfo)
+	require.Error(t, ValidateStructure(misplacedKeyInfo))
+}
+
+func TestSignedInfoOrder(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	for _, plain := range []bool{false, true} {
+		ctx.PlainXMLDSig = plain
+		signature, err := CreateSignature(newTestSignedData(t), ctx)
+		require.NoError(t, err)
+		signedInfo := findChild(signature, dsig.SignedInfoTag)
+		require.NoError(t, checkSignedInfoOrder(signedInfo))
+
+		referenceFirst := signedInfo.Copy()
+		reference := findChild(referenceFirst, dsig.ReferenceTag)
+		referenceFirst.RemoveChild(reference)
+		referenceFirst.InsertChildAt(1, reference)
+		err = checkSignedInfoOrder(referenceFirst)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "requires "+dsig.SignatureMethodTag+" before <ds:"+dsig.ReferenceTag+">")
+
+		trailing := signedInfo.Copy()
+		signatureMethod := findChild(trailing, dsig.SignatureMethodTag)
+		trailing.RemoveChild(signatureMethod)
+		trailing.AddChild(signatureMethod)
+		err = checkSignedInfoOrder(trailing)
+		require.Error(t, err)
+
+		noReference := signedInfo.Copy()
+		for _, reference := range noReference.SelectElements("ds:" + dsig.ReferenceTag) {
+			noReference.RemoveChild(reference)
+		}
+		err = checkSignedInfoOrder(noReference)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "requires "+dsig.ReferenceTag)
+	}
+}
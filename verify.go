@@ -0,0 +1,746 @@
+package xades
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// ExtractSigningCertificate return the certificate of the first ds:X509Certificate in ds:KeyInfo/ds:X509Data of sig.
+// The certificate is not verified, it is what the signer claims to have signed with
+func ExtractSigningCertificate(sig *etree.Element) (*x509.Certificate, error) {
+	certs, err := extractKeyInfoCertificates(sig)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+// ExtractCertificateChain return the certificates of the ds:X509Certificate elements following the signing certificate
+// in ds:KeyInfo/ds:X509Data of sig, empty when KeyInfo carries the signing certificate only
+func ExtractCertificateChain(sig *etree.Element) ([]*x509.Certificate, error) {
+	certs, err := extractKeyInfoCertificates(sig)
+	if err != nil {
+		return nil, err
+	}
+	return certs[1:], nil
+}
+
+// extractKeyInfoCertificates parse every ds:X509Certificate of ds:KeyInfo/ds:X509Data in document order
+func extractKeyInfoCertificates(sig *etree.Element) ([]*x509.Certificate, error) {
+
+	keyInfo := findChild(sig, dsig.KeyInfoTag)
+	if keyInfo == nil {
+		return nil, errors.New("xades: signature has no KeyInfo")
+	}
+	x509Data := findChild(keyInfo, dsig.X509DataTag)
+	if x509Data == nil {
+		return nil, errors.New("xades: KeyInfo has no X509Data")
+	}
+
+	var certs []*x509.Certificate
+	for _, el := range x509Data.ChildElements() {
+		if el.Tag != dsig.X509CertificateTag {
+			continue
+		}
+		cert, err := parseBase64Certificate(el.Text())
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("xades: X509Data has no X509Certificate")
+	}
+	return certs, nil
+}
+
+// parseBase64Certificate parse a base64 DER certificate, white space from line wrapping is ignored
+func parseBase64Certificate(text string) (*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return nil, fmt.Errorf("xades: X509Certificate is not valid base64: %v", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// VerifySigningCertificate check that cert, usually the one returned by ExtractSigningCertificate, is referenced by
+// a xades:Cert of the SigningCertificate or SigningCertificateV2 property of sig: its CertDigest, recomputed with
+// the declared DigestMethod, must equal the stored DigestValue and its IssuerSerial must name the issuer and serial
+// number of cert. Issuer names are compared in their RFC 4514 string form, ignoring case and white space around
+// separators. An IssuerSerialV2 must equal the DER IssuerSerial of cert, a V2 Cert without one matches on digest only
+func VerifySigningCertificate(sig *etree.Element, cert *x509.Certificate) error {
+	if err := checkCertDigest(sig, cert); err != nil {
+		return err
+	}
+	certRef, signingCertificateTag := findSigningCertificateRef(sig, cert)
+	return checkIssuerSerial(certRef, signingCertificateTag, cert)
+}
+
+// checkCertDigest return error when no xades:Cert of the SigningCertificate property of sig has the digest of cert
+func checkCertDigest(sig *etree.Element, cert *x509.Certificate) error {
+
+	qualifyingProperties := findQualifyingProperties(sig)
+	if qualifyingProperties == nil {
+		return errors.New("xades: signature has no QualifyingProperties")
+	}
+	signingCertificate := findPath(qualifyingProperties, SignedPropertiesTag, SignedSignaturePropertiesTag, SigningCertificateTag)
+	if signingCertificate == nil {
+		signingCertificate = findPath(qualifyingProperties, SignedPropertiesTag, SignedSignaturePropertiesTag, SigningCertificateV2Tag)
+	}
+	if signingCertificate == nil {
+		return errors.New("xades: signature has no SigningCertificate property")
+	}
+
+	for _, certRef := range signingCertificate.ChildElements() {
+		if certRef.Tag != CertTag {
+			continue
+		}
+		matches, err := certDigestMatches(findChild(certRef, CertDigestTag), cert.Raw)
+		if err != nil {
+			return err
+		}
+		if matches {
+			return nil
+		}
+	}
+	return fmt.Errorf("xades: no SigningCertificate CertDigest matches certificate %q", cert.Subject.String())
+}
+
+// findSigningCertificateRef return the first xades:Cert of the SigningCertificate property of sig whose CertDigest
+// is the digest of cert and the tag of that property, nil when there is none
+func findSigningCertificateRef(sig *etree.Element, cert *x509.Certificate) (*etree.Element, string) {
+	qualifyingProperties := findQualifyingProperties(sig)
+	if qualifyingProperties == nil {
+		return nil, ""
+	}
+	for _, tag := range []string{SigningCertificateTag, SigningCertificateV2Tag} {
+		signingCertificate := findPath(qualifyingProperties, SignedPropertiesTag, SignedSignaturePropertiesTag, tag)
+		if signingCertificate == nil {
+			continue
+		}
+		for _, certRef := range signingCertificate.ChildElements() {
+			if certRef.Tag != CertTag {
+				continue
+			}
+			if matches, err := certDigestMatches(findChild(certRef, CertDigestTag), cert.Raw); err == nil && matches {
+				return certRef, tag
+			}
+		}
+		return nil, ""
+	}
+	return nil, ""
+}
+
+// checkIssuerSerial check the IssuerSerial, or the IssuerSerialV2 of a SigningCertificateV2, of certRef against cert
+func checkIssuerSerial(certRef *etree.Element, signingCertificateTag string, cert *x509.Certificate) error {
+	if certRef == nil {
+		return fmt.Errorf("xades: no SigningCertificate CertDigest matches certificate %q", cert.Subject.String())
+	}
+	if signingCertificateTag == SigningCertificateV2Tag {
+		return verifyIssuerSerialV2(findChild(certRef, IssuerSerialV2Tag), cert)
+	}
+	return verifyIssuerSerial(findChild(certRef, IssuerSerialTag), cert)
+}
+
+// certDigestMatches tell whether the DigestAlgAndValueType element certDigest holds the digest of der
+func certDigestMatches(certDigest *etree.Element, der []byte) (bool, error) {
+	if certDigest == nil {
+		return false, errors.New("xades: Cert has no CertDigest")
+	}
+	digestMethod := findChild(certDigest, dsig.DigestMethodTag)
+	digestValue := findChild(certDigest, dsig.DigestValueTag)
+	if digestMethod == nil || digestValue == nil {
+		return false, errors.New("xades: CertDigest requires DigestMethod and DigestValue")
+	}
+	hash, err := digestAlgorithmHash(digestMethod.SelectAttrValue(dsig.AlgorithmAttr, ""))
+	if err != nil {
+		return false, err
+	}
+	return DigestBytes(der, hash) == strings.TrimSpace(digestValue.Text()), nil
+}
+
+// verifyIssuerSerial check that the IssuerSerial element issuerSerial names the issuer and serial number of cert
+func verifyIssuerSerial(issuerSerial *etree.Element, cert *x509.Certificate) error {
+	if issuerSerial == nil {
+		return errors.New("xades: Cert has no IssuerSerial")
+	}
+	issuerName := findChild(issuerSerial, x509IssuerNameTag)
+	serialNumber := findChild(issuerSerial, x509SerialNumberTag)
+	if issuerName == nil || serialNumber == nil {
+		return errors.New("xades: IssuerSerial requires X509IssuerName and X509SerialNumber")
+	}
+
+	serial, ok := new(big.Int).SetString(strings.TrimSpace(serialNumber.Text()), 10)
+	if !ok || serial.Cmp(cert.SerialNumber) != 0 {
+		return fmt.Errorf("xades: IssuerSerial serial number %q does not match certificate serial number %v", serialNumber.Text(), cert.SerialNumber)
+	}
+	if !matchesIssuerName(issuerName.Text(), cert) {
+		return fmt.Errorf("xades: IssuerSerial issuer %q does not match certificate issuer %q", issuerName.Text(), cert.Issuer.String())
+	}
+	return nil
+}
+
+// verifyIssuerSerialV2 check that the optional IssuerSerialV2 element issuerSerialV2 encodes the IssuerSerial of cert
+func verifyIssuerSerialV2(issuerSerialV2 *etree.Element, cert *x509.Certificate) error {
+	if issuerSerialV2 == nil {
+		return nil
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(issuerSerialV2.Text()), ""))
+	if err != nil {
+		return fmt.Errorf("xades: IssuerSerialV2 is not valid base64: %v", err)
+	}
+	expected, err := marshalIssuerSerial(cert)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(der, expected) {
+		return fmt.Errorf("xades: IssuerSerialV2 does not match issuer and serial number of certificate %q", cert.Subject.String())
+	}
+	return nil
+}
+
+// matchesIssuerName tell whether name is the issuer of cert as rendered by GoIssuerName or RFC2253IssuerName,
+// ignoring case and white space around the separators
+func matchesIssuerName(name string, cert *x509.Certificate) bool {
+	normalized := normalizeDistinguishedName(name)
+	for _, format := range []IssuerNameFormat{GoIssuerName, RFC2253IssuerName} {
+		if strings.EqualFold(normalized, normalizeDistinguishedName(format(cert))) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDistinguishedName remove white space around the "," "+" and "=" separators of name
+func normalizeDistinguishedName(name string) string {
+	var builder strings.Builder
+	for _, rdn := range strings.Split(strings.TrimSpace(name), ",") {
+		if builder.Len() > 0 {
+			builder.WriteByte(',')
+		}
+		for i, ava := range strings.Split(rdn, "+") {
+			if i > 0 {
+				builder.WriteByte('+')
+			}
+			parts := strings.SplitN(ava, "=", 2)
+			builder.WriteString(strings.TrimSpace(parts[0]))
+			if len(parts) == 2 {
+				builder.WriteByte('=')
+				builder.WriteString(strings.TrimSpace(parts[1]))
+			}
+		}
+	}
+	return builder.String()
+}
+
+// findPath return the element reached from el through child elements with local names tags
+func findPath(el *etree.Element, tags ...string) *etree.Element {
+	for _, tag := range tags {
+		if el = findChild(el, tag); el == nil {
+			return nil
+		}
+	}
+	return el
+}
+
+// VerifyContext configure the verification of a signature created by this package.
+//
+// Without TrustedCert the SignatureValue is checked with the public key of the certificate embedded in KeyInfo,
+// which only proves that the holder of that key signed. Anyone can produce a valid signature with a KeyInfo of
+// their own, so the embedded certificate must then be validated against a trust anchor by the caller.
+type VerifyContext struct {
+	// TrustedCert is the certificate, trusted out-of-band, whose public key must verify SignatureValue.
+	// KeyInfo is then informational only, see VerificationResult.KeyInfoMatchesTrustedCert
+	TrustedCert *x509.Certificate
+	// AllowedCanonicalizationMethods restricts the CanonicalizationMethod of SignedInfo and the canonicalization
+	// transforms of the references to these algorithm URIs, any algorithm is allowed when empty
+	AllowedCanonicalizationMethods []string
+	// AllowedSignatureMethods restricts the SignatureMethod of SignedInfo, any algorithm is allowed when empty
+	AllowedSignatureMethods []string
+	// AllowedDigestMethods restricts the DigestMethod of the references, any algorithm is allowed when empty
+	AllowedDigestMethods []string
+	// CheckValidityAtSigningTime requires the verifying certificate to be valid at the reference time of the
+	// signature: the SigningTime of the SignedProperties covered by SignedInfo or, when absent, the GenTime of its
+	// SignatureTimeStamp, whose imprint and token signature are then checked against TimeStampRoots. Verification
+	// fails when the signature has neither
+	CheckValidityAtSigningTime bool
+	// TimeStampRoots are the roots of the time-stamping authorities whose SignatureTimeStamp may provide the
+	// reference time, see VerifyTimeStampToken. Without them a SignatureTimeStamp cannot provide it
+	TimeStampRoots *x509.CertPool
+	// HMACKey is the shared secret verifying an HMAC SignatureMethod, see SigningContext.HMAC. A shared secret
+	// identifies no certificate, so TrustedCert, KeyInfo and the certificate checks are then unused
+	HMACKey []byte
+	// ResolveURI returns the content of a data reference whose URI is not a same-document reference, e.g. the
+	// file signed by CreateDetachedSignature. Without it such references fail to verify
+	ResolveURI func(uri string) ([]byte, error)
+	// RootCAs requires a certificate path from the verifying certificate to one of these roots, valid at the
+	// reference time of the signature as for CheckValidityAtSigningTime. The certificates of KeyInfo following the
+	// signing certificate and Intermediates complete the path, any extended key usage is accepted. A path that
+	// cannot be built fails with an error wrapping ErrCertificatePath. No path is checked when nil
+	RootCAs       *x509.CertPool
+	Intermediates []*x509.Certificate
+}
+
+// VerificationResult describe a successfully verified signature
+type VerificationResult struct {
+	// Certificate is the certificate whose public key verified SignatureValue
+	Certificate *x509.Certificate
+	// KeyInfoCertificate is the signing certificate embedded in KeyInfo, nil when KeyInfo carries none
+	KeyInfoCertificate *x509.Certificate
+	// KeyInfoMatchesTrustedCert tells whether KeyInfoCertificate is TrustedCert, false without TrustedCert
+	KeyInfoMatchesTrustedCert bool
+	// ReferenceTime is the time Certificate was checked valid at, zero without CheckValidityAtSigningTime and RootCAs
+	ReferenceTime time.Time
+	// Chains are the certificate paths from Certificate to VerifyContext.RootCAs, nil without RootCAs
+	Chains [][]*x509.Certificate
+}
+
+// Verify check sig over signedData, the element its data reference points at or, for a same-document "#id" URI,
+// an element containing it, e.g. the document root; a whole-document "" URI resolves to the root above signedData.
+// Checked are the digest of every reference, the SignatureValue over SignedInfo and the SigningCertificate property
+// against the verifying certificate, unless SignedInfo has no SignedProperties reference as in a PlainXMLDSig
+// signature, and with RootCAs the certificate path. Supported transforms are the enveloped-signature transform,
+// the XPath transform excluding every signature, base64 decoding and canonicalization; a same-document reference
+// without transforms is digested as its inclusive c14n, as XML DSig converts it to octets. The content of an
+// external reference comes from ResolveURI, it is digested as is without transforms or parsed as XML and
+// canonicalized by its single canonicalization transform; signedData may be nil when every data reference is
+// external. The checks are those of Report, Verify returns the first that fails.
+func (ctx *VerifyContext) Verify(sig *etree.Element, signedData *etree.Element) (*VerificationResult, error) {
+
+	report := ctx.Report(sig, signedData)
+	if err := report.verifyErr(); err != nil {
+		return nil, err
+	}
+	result := report.VerificationResult
+	return &result, nil
+}
+
+// checkValidityAtReferenceTime return the reference time of sig and an error when cert is not valid at that time
+func (ctx *VerifyContext) checkValidityAtReferenceTime(sig *etree.Element, cert *x509.Certificate) (time.Time, error) {
+	referenceTime, err := referenceTime(sig, ctx.TimeStampRoots)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if referenceTime.Before(cert.NotBefore) || referenceTime.After(cert.NotAfter) {
+		return referenceTime, fmt.Errorf("xades: reference time %v is outside the validity period %v - %v of certificate %q",
+			referenceTime.UTC().Format(timeFormat), cert.NotBefore.UTC().Format(timeFormat),
+			cert.NotAfter.UTC().Format(timeFormat), cert.Subject.String())
+	}
+	return referenceTime, nil
+}
+
+// verifyCertificatePath return the reference time of sig, known when already taken, and the paths from cert to
+// ctx.RootCAs valid at that time
+func (ctx *VerifyContext) verifyCertificatePath(sig *etree.Element, cert *x509.Certificate, known time.Time) (time.Time, [][]*x509.Certificate, error) {
+
+	var err error
+	at := known
+	if at.IsZero() {
+		if at, err = referenceTime(sig, ctx.TimeStampRoots); err != nil {
+			return time.Time{}, nil, wrapPhase(ErrCertificatePath, err)
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range ctx.Intermediates {
+		intermediates.AddCert(intermediate)
+	}
+	// KeyInfo without X509Data, e.g. with TrustedCert, contributes no intermediates
+	if chain, err := ExtractCertificateChain(sig); err == nil {
+		for _, intermediate := range chain {
+			intermediates.AddCert(intermediate)
+		}
+	}
+	chains, err := cert.Verify(x509.VerifyOptions{
+		Roots:         ctx.RootCAs,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return at, nil, wrapPhase(ErrCertificatePath, err)
+	}
+	return at, chains, nil
+}
+
+// referenceTime return the SigningTime of sig, taken only from the SignedProperties a verified reference of
+// SignedInfo covers, or, without one, the GenTime of its SignatureTimeStamp once the imprint and the CMS signature
+// of its token are verified against timeStampRoots. Properties outside the signed SignedProperties are ignored,
+// anyone could add them
+func referenceTime(sig *etree.Element, timeStampRoots *x509.CertPool) (time.Time, error) {
+	if signedInfo := findChild(sig, dsig.SignedInfoTag); signedInfo != nil {
+		for _, reference := range signedInfo.ChildElements() {
+			if reference.Tag != dsig.ReferenceTag || !isSignedPropertiesReference(reference, sig) {
+				continue
+			}
+			if err := verifyReference(reference, sig, nil, nil); err != nil {
+				return time.Time{}, err
+			}
+			// verifyReference resolved the reference to this SignedProperties
+			signedProperties := findChild(findQualifyingProperties(sig), SignedPropertiesTag)
+			if signingTime := findPath(signedProperties, SignedSignaturePropertiesTag, SigningTimeTag); signingTime != nil {
+				return parseSigningTime(signingTime)
+			}
+			break
+		}
+	}
+	if qualifyingProperties := findQualifyingProperties(sig); qualifyingProperties != nil &&
+		findPath(qualifyingProperties, UnsignedPropertiesTag, UnsignedSignaturePropertiesTag, SignatureTimeStampTag) != nil {
+		if timeStampRoots == nil {
+			return time.Time{}, errors.New("xades: the reference time of a SignatureTimeStamp requires VerifyContext.TimeStampRoots to verify its token")
+		}
+		token, err := verifyTrustedSignatureTimeStamp(sig, timeStampRoots)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return token.GenTime, nil
+	}
+	return time.Time{}, errors.New("xades: signature has neither a signed SigningTime nor a SignatureTimeStamp to take the reference time from")
+}
+
+// checkAlgorithms check the algorithms of signedInfo and its references against the allow-lists of ctx
+func (ctx *VerifyContext) checkAlgorithms(signedInfo *etree.Element) error {
+	if err := checkAllowedMethod(findChild(signedInfo, dsig.CanonicalizationMethodTag), ctx.AllowedCanonicalizationMethods, dsig.CanonicalizationMethodTag); err != nil {
+		return err
+	}
+	if err := checkAllowedMethod(findChild(signedInfo, dsig.SignatureMethodTag), ctx.AllowedSignatureMethods, dsig.SignatureMethodTag); err != nil {
+		return err
+	}
+	for _, reference := range signedInfo.ChildElements() {
+		if reference.Tag != dsig.ReferenceTag {
+			continue
+		}
+		if transforms := findChild(reference, dsig.TransformsTag); transforms != nil {
+			for _, transform := range transforms.ChildElements() {
+				switch transform.SelectAttrValue(dsig.AlgorithmAttr, "") {
+				case dsig.EnvelopedSignatureAltorithmId.String(), xpathTransformAlgorithmId, Base64TransformAlgorithmId, XSLTTransformAlgorithmId:
+					continue
+				}
+				if err := checkAllowedMethod(transform, ctx.AllowedCanonicalizationMethods, "canonicalization transform"); err != nil {
+					return err
+				}
+			}
+		}
+		if err := checkAllowedMethod(findChild(reference, dsig.DigestMethodTag), ctx.AllowedDigestMethods, dsig.DigestMethodTag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAllowedMethod check that the Algorithm of method is one of allowed, any algorithm passes when allowed is empty
+func checkAllowedMethod(method *etree.Element, allowed []string, name string) error {
+	if len(allowed) == 0 || method == nil {
+		return nil
+	}
+	algorithm := method.SelectAttrValue(dsig.AlgorithmAttr, "")
+	for _, a := range allowed {
+		if a == algorithm {
+			return nil
+		}
+	}
+	return fmt.Errorf("xades: %v algorithm %q is not allowed", name, algorithm)
+}
+
+// verifyBase64Transform return the decoded text content of target without excluded, canonicalized as an XML
+// document when canonicalizer follows the base64 transform
+func verifyBase64Transform(canonicalizer dsig.Canonicalizer, target *etree.Element, excluded *etree.Element) ([]byte, error) {
+	detached, err := dereference(target, excluded, false)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeBase64Transform(detached)
+	if err != nil || canonicalizer == nil {
+		return decoded, err
+	}
+	return canonicalizeOctets(canonicalizer, decoded)
+}
+
+// hasSignedPropertiesReference tell whether signedInfo signs the SignedProperties of sig, false for plain XML DSig
+func hasSignedPropertiesReference(signedInfo *etree.Element, sig *etree.Element) bool {
+	for _, reference := range signedInfo.ChildElements() {
+		if reference.Tag == dsig.ReferenceTag && isSignedPropertiesReference(reference, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifySignedPropertiesDigest check only the SignedProperties reference of sig: SignedProperties is canonicalized
+// by the declared transform in the context of sig and digested with the declared DigestMethod, which must match the
+// DigestValue. Neither the data references nor SignatureValue are checked, see Verify
+func VerifySignedPropertiesDigest(sig *etree.Element) error {
+	signedInfo := findChild(sig, dsig.SignedInfoTag)
+	if signedInfo == nil {
+		return errors.New("xades: signature has no SignedInfo")
+	}
+	for _, reference := range signedInfo.ChildElements() {
+		if reference.Tag == dsig.ReferenceTag && isSignedPropertiesReference(reference, sig) {
+			return verifyReference(reference, sig, nil, nil)
+		}
+	}
+	return errors.New("xades: SignedInfo has no SignedProperties reference")
+}
+
+// verifyReference recompute the digest of reference, a SignedProperties reference resolves inside sig and
+// an external one through resolve
+func verifyReference(reference *etree.Element, sig *etree.Element, signedData *etree.Element, resolve func(uri string) ([]byte, error)) error {
+	output, err := referenceOutput(reference, sig, signedData, resolve)
+	if err != nil {
+		return err
+	}
+	return checkReferenceDigest(reference, reference.SelectAttrValue(dsig.URIAttr, ""), output)
+}
+
+// referenceOutput return the octets reference digests: what its URI points at, resolved as by verifyReference,
+// after its transforms
+func referenceOutput(reference *etree.Element, sig *etree.Element, signedData *etree.Element, resolve func(uri string) ([]byte, error)) ([]byte, error) {
+
+	uri := reference.SelectAttrValue(dsig.URIAttr, "")
+	var target *etree.Element
+	if isSignedPropertiesReference(reference, sig) {
+		if qualifyingProperties := findQualifyingProperties(sig); qualifyingProperties != nil {
+			target = findChild(qualifyingProperties, SignedPropertiesTag)
+		}
+		if target == nil || "#"+elementId(target) != uri {
+			return nil, fmt.Errorf("xades: SignedProperties reference %q does not resolve", uri)
+		}
+	} else if isExternalURI(uri) {
+		return externalReferenceOutput(reference, uri, resolve)
+	} else {
+		if signedData == nil {
+			return nil, fmt.Errorf("xades: reference %q requires the signed data", uri)
+		}
+		target = signedData
+		if isWholeDocumentURI(uri) {
+			target = documentElement(signedData)
+		} else if id, _ := referenceURIId(uri); id != "" {
+			// a reference may also point at an element of the signature, such as a signed KeyInfo
+			if target = findElementById(signedData, id); target == nil {
+				target = findElementById(sig, id)
+			}
+			if target == nil {
+				return nil, fmt.Errorf("xades: reference %q does not resolve in the signed data", uri)
+			}
+		}
+	}
+
+	_, keepComments := referenceURIId(uri)
+	transforms := findChild(reference, dsig.TransformsTag)
+	if transforms == nil {
+		return canonicalizeReference(implicitCanonicalizer(keepComments), target, nil, keepComments)
+	}
+	var canonicalizer dsig.Canonicalizer
+	var xslt *etree.Element
+	excludeSignature, excludeSignatures, base64Decode := false, false, false
+	for _, transform := range transforms.ChildElements() {
+		if xslt != nil {
+			return nil, fmt.Errorf("xades: reference %q has a transform after the XSLT transform", uri)
+		}
+		switch algorithm := transform.SelectAttrValue(dsig.AlgorithmAttr, ""); algorithm {
+		case dsig.EnvelopedSignatureAltorithmId.String():
+			excludeSignature = true
+		case Base64TransformAlgorithmId:
+			if canonicalizer != nil {
+				return nil, fmt.Errorf("xades: reference %q decodes base64 after canonicalization", uri)
+			}
+			base64Decode = true
+		case xpathTransformAlgorithmId:
+			expected := createXPathExcludeSignaturesTransform("")
+			xpath := findChild(transform, xpathTag)
+			if xpath == nil || xpath.Text() != findChild(expected, xpathTag).Text() {
+				return nil, fmt.Errorf("xades: reference %q has an unsupported XPath transform", uri)
+			}
+			excludeSignatures = true
+		case XSLTTransformAlgorithmId:
+			if canonicalizer == nil || base64Decode {
+				return nil, fmt.Errorf("xades: reference %q requires a canonicalization transform before the XSLT transform", uri)
+			}
+			xslt = transform
+		default:
+			var err error
+			if canonicalizer, err = methodCanonicalizer(transform); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if canonicalizer == nil && !base64Decode {
+		canonicalizer = implicitCanonicalizer(keepComments)
+	}
+
+	var excluded *etree.Element
+	if excludeSignature {
+		excluded = sig
+	}
+	if excludeSignatures {
+		var err error
+		if target, err = withoutSignatures(target); err != nil {
+			return nil, err
+		}
+	}
+	var canonical []byte
+	var err error
+	if base64Decode {
+		canonical, err = verifyBase64Transform(canonicalizer, target, excluded)
+	} else {
+		canonical, err = canonicalizeReference(canonicalizer, target, excluded, keepComments)
+	}
+	if err == nil && xslt != nil {
+		canonical, err = applyXSLTTransform(xslt, canonical)
+	}
+	return canonical, err
+}
+
+// isExternalURI tell whether the reference uri points outside the document of the signature
+func isExternalURI(uri string) bool {
+	return uri != "" && !strings.HasPrefix(uri, "#")
+}
+
+// externalReferenceOutput return the content returned by resolve for the external reference after its transforms
+func externalReferenceOutput(reference *etree.Element, uri string, resolve func(uri string) ([]byte, error)) ([]byte, error) {
+
+	if resolve == nil {
+		return nil, fmt.Errorf("xades: reference %q is external, VerifyContext.ResolveURI is required", uri)
+	}
+	content, err := resolve(uri)
+	if err != nil {
+		return nil, fmt.Errorf("xades: cannot resolve reference %q: %v", uri, err)
+	}
+	if transforms := findChild(reference, dsig.TransformsTag); transforms != nil {
+		children := transforms.ChildElements()
+		if len(children) != 1 {
+			return nil, fmt.Errorf("xades: external reference %q supports a single canonicalization transform only", uri)
+		}
+		canonicalizer, err := methodCanonicalizer(children[0])
+		if err != nil {
+			return nil, err
+		}
+		if content, err = canonicalizeOctets(canonicalizer, content); err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+// checkReferenceDigest compare the DigestValue of reference with the digest of octets by its DigestMethod
+func checkReferenceDigest(reference *etree.Element, uri string, octets []byte) error {
+
+	digestMethod := findChild(reference, dsig.DigestMethodTag)
+	digestValue := findChild(reference, dsig.DigestValueTag)
+	if digestMethod == nil || digestValue == nil {
+		return fmt.Errorf("xades: reference %q requires DigestMethod and DigestValue", uri)
+	}
+	hash, err := digestAlgorithmHash(digestMethod.SelectAttrValue(dsig.AlgorithmAttr, ""))
+	if err != nil {
+		return err
+	}
+	if DigestBytes(octets, hash) != strings.TrimSpace(digestValue.Text()) {
+		return fmt.Errorf("xades: digest of reference %q does not match", uri)
+	}
+	return nil
+}
+
+// signedInfoSignatureValue return the canonical signedInfo, the decoded SignatureValue of sig and the SignatureMethod algorithm
+func signedInfoSignatureValue(sig *etree.Element, signedInfo *etree.Element) (canonical []byte, value []byte, algorithm string, err error) {
+
+	canonicalizationMethod := findChild(signedInfo, dsig.CanonicalizationMethodTag)
+	signatureMethod := findChild(signedInfo, dsig.SignatureMethodTag)
+	signatureValue := findChild(sig, dsig.SignatureValueTag)
+	if canonicalizationMethod == nil || signatureMethod == nil || signatureValue == nil {
+		return nil, nil, "", errors.New("xades: signature requires CanonicalizationMethod, SignatureMethod and SignatureValue")
+	}
+	canonicalizer, err := methodCanonicalizer(canonicalizationMethod)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if canonical, err = canonicalizeInContext(canonicalizer, signedInfo); err != nil {
+		return nil, nil, "", err
+	}
+	if value, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(signatureValue.Text()), "")); err != nil {
+		return nil, nil, "", fmt.Errorf("xades: SignatureValue is not valid base64: %v", err)
+	}
+	return canonical, value, signatureMethod.SelectAttrValue(dsig.AlgorithmAttr, ""), nil
+}
+
+// methodCanonicalizer return canonicalizer of a CanonicalizationMethod or Transform element and its InclusiveNamespaces
+func methodCanonicalizer(method *etree.Element) (dsig.Canonicalizer, error) {
+	prefixList := ""
+	if inclusiveNamespaces := findChild(method, dsig.InclusiveNamespacesTag); inclusiveNamespaces != nil {
+		prefixList = inclusiveNamespaces.SelectAttrValue(dsig.PrefixListAttr, "")
+	}
+	return canonicalizerForAlgorithm(method.SelectAttrValue(dsig.AlgorithmAttr, ""), prefixList)
+}
+
+// verifySignatureValue check SignatureValue of sig over the canonical signedInfo with the public key of cert
+func verifySignatureValue(sig *etree.Element, signedInfo *etree.Element, cert *x509.Certificate) error {
+
+	canonical, value, algorithm, err := signedInfoSignatureValue(sig, signedInfo)
+	if err != nil {
+		return err
+	}
+	if _, ok := hmacHash(algorithm); ok {
+		return fmt.Errorf("xades: HMAC SignatureMethod %q requires VerifyContext.HMACKey", algorithm)
+	}
+	if algorithm == ed25519SignatureMethodIdentifier {
+		publicKey, ok := cert.PublicKey.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("xades: SignatureMethod %q requires an Ed25519 key, got %T", algorithm, cert.PublicKey)
+		}
+		if !ed25519.Verify(publicKey, canonical, value) {
+			return errors.New("xades: SignatureValue does not verify")
+		}
+		return nil
+	}
+
+	for hash, identifier := range ecdsaSignatureMethodIdentifiers {
+		if identifier != algorithm {
+			continue
+		}
+		publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("xades: SignatureMethod %q requires an ECDSA key, got %T", algorithm, cert.PublicKey)
+		}
+		size := (publicKey.Curve.Params().N.BitLen() + 7) / 8
+		if len(value) != 2*size {
+			return errors.New("xades: SignatureValue does not verify")
+		}
+		_hash := hash.New()
+		_hash.Write(canonical)
+		r, s := new(big.Int).SetBytes(value[:size]), new(big.Int).SetBytes(value[size:])
+		if !ecdsa.Verify(publicKey, _hash.Sum(nil), r, s) {
+			return errors.New("xades: SignatureValue does not verify")
+		}
+		return nil
+	}
+	if registeredSigner(algorithm) != nil {
+		return fmt.Errorf("xades: verification of registered SignatureMethod %q is not supported", algorithm)
+	}
+	for _, hash := range []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		if hashSignatureMethodIdentifier(hash) != algorithm {
+			continue
+		}
+		publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("xades: SignatureMethod %q requires an RSA key, got %T", algorithm, cert.PublicKey)
+		}
+		_hash := hash.New()
+		_hash.Write(canonical)
+		if err := rsa.VerifyPKCS1v15(publicKey, hash, _hash.Sum(nil), value); err != nil {
+			return errors.New("xades: SignatureValue does not verify")
+		}
+		return nil
+	}
+	return fmt.Errorf("xades: unsupported SignatureMethod %q", algorithm)
+}
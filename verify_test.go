@@ -0,0 +1,457 @@
+package xades
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractSigningCertificate(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+	ca := newTestKeyStoreFromTemplate(t, &x509.Certificate{})
+	ctx.KeyStore.CertChain = []*x509.Certificate{ca.Cert}
+	ctx.Base64LineWidth = 76
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	cert, err := ExtractSigningCertificate(signature)
+	require.NoError(t, err)
+	require.Equal(t, ctx.KeyStore.CertBinary, cert.Raw)
+
+	chain, err := ExtractCertificateChain(signature)
+	require.NoError(t, err)
+	require.Len(t, chain, 1)
+	require.Equal(t, ca.CertBinary, chain[0].Raw)
+
+	ctx.KeyStore.CertChain = nil
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	chain, err = ExtractCertificateChain(signature)
+	require.NoError(t, err)
+	require.Empty(t, chain)
+
+	ctx.KeyInfoContext.IncludeKeyValue = true
+	ctx.KeyInfoContext.OmitX509Data = true
+	signature, err = CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	_, err = ExtractSigningCertificate(signature)
+	require.Error(t, err)
+
+	corrupted := etree.NewElement("ds:" + dsig.SignatureTag)
+	corrupted.CreateElement("ds:" + dsig.KeyInfoTag).CreateElement("ds:" + dsig.X509DataTag).CreateElement("ds:" + dsig.X509CertificateTag).SetText("not base64!")
+	_, err = ExtractSigningCertificate(corrupted)
+	require.Error(t, err)
+}
+
+func TestVerifySigningCertificate(t *testing.T) {
+	signedData := newTestSignedData(t)
+	ctx := newTestSigningContext(t)
+	ctx.CertDigestHash = crypto.SHA512
+
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	cert, err := ExtractSigningCertificate(signature)
+	require.NoError(t, err)
+	require.NoError(t, VerifySigningCertificate(signature, cert))
+
+	other := newTestKeyStoreFromTemplate(t, &x509.Certificate{SerialNumber: ctx.KeyStore.Cert.SerialNumber})
+	err = VerifySigningCertificate(signature, other.Cert)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "CertDigest")
+
+	issuerSerialPath := "ds:Object/" + Prefix + ":" + QualifyingPropertiesTag + "/" + Prefix + ":" + SignedPropertiesTag + "/" + Prefix + ":" + SignedSignaturePropertiesTag +
+		"/" + Prefix + ":" + SigningCertificateTag + "/" + Prefix + ":" + CertTag + "/" + Prefix + ":" + IssuerSerialTag
+	tampered := signature.Copy()
+	tampered.FindElement(issuerSerialPath + "/ds:" + x509SerialNumberTag).SetText("42")
+	err = VerifySigningCertificate(tampered, cert)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "serial number")
+
+	tampered = signature.Copy()
+	tampered.FindElement(issuerSerialPath + "/ds:" + x509IssuerNameTag).SetText("CN=Someone Else")
+	err = VerifySigningCertificate(tampered, cert)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "issuer")
+
+	require.Equal(t, "CN=Test,O=Example+OU=Unit", normalizeDistinguishedName(" CN = Test, O=Example + OU=Unit "))
+}
+
+// signAndReparse sign the root of documentXML enveloped, then serialize and parse the signed document again
+func signAndReparse(t *testing.T, documentXML string, ctx *SigningContext) (*etree.Element, *etree.Element) {
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(documentXML))
+	signature, err := CreateSignature(doc.Root(), ctx)
+	require.NoError(t, err)
+	require.NoError(t, AppendSignature(doc.Root(), signature))
+
+	serialized, err := doc.WriteToString()
+	require.NoError(t, err)
+	parsed := etree.NewDocument()
+	require.NoError(t, parsed.ReadFromString(serialized))
+	root := parsed.Root()
+	return root, root.SelectElement("ds:" + dsig.SignatureTag)
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	ctx := newTestSigningContext(t)
+
+	root, signature := signAndReparse(t, testXML, ctx)
+	result, err := (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+	require.Equal(t, ctx.KeyStore.CertBinary, result.Certificate.Raw)
+	require.False(t, result.KeyInfoMatchesTrustedCert)
+
+	result, err = (&VerifyContext{TrustedCert: ctx.KeyStore.Cert}).Verify(signature, root)
+	require.NoError(t, err)
+	require.True(t, result.KeyInfoMatchesTrustedCert)
+
+	other := newTestKeyStoreFromTemplate(t, &x509.Certificate{})
+	_, err = (&VerifyContext{TrustedCert: other.Cert}).Verify(signature, root)
+	require.Error(t, err)
+
+	tampered := root.Copy()
+	tampered.SetText("tampered")
+	_, err = (&VerifyContext{}).Verify(tampered.SelectElement("ds:"+dsig.SignatureTag), tampered)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "#signedData")
+
+	ctx.DataContext.ExcludeSignatures = true
+	ctx.UseSignatureUuid = true
+	ctx.Base64LineWidth = 64
+	root, signature = signAndReparse(t, testXML, ctx)
+	_, err = (&VerifyContext{TrustedCert: ctx.KeyStore.Cert}).Verify(signature, root)
+	require.NoError(t, err)
+
+	signedProperties := findChild(findQualifyingProperties(signature), SignedPropertiesTag)
+	signingTime := findPath(signedProperties, SignedSignaturePropertiesTag, SigningTimeTag)
+	signingTime.SetText("2030-01-01T00:00:00Z")
+	_, err = (&VerifyContext{TrustedCert: ctx.KeyStore.Cert}).Verify(signature, root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SignedProperties")
+}
+
+func TestVerifyEnvelopedTransform(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	signedData := newTestSignedData(t)
+	signature, err := CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+
+	// the transform removes the signature wherever it sits inside the signed element
+	for _, nested := range []bool{false, true} {
+		doc := etree.NewDocument()
+		doc.SetRoot(signedData.Copy())
+		parent := doc.Root()
+		if nested {
+			parent = parent.ChildElements()[0]
+		}
+		parent.AddChild(signature.Copy())
+		serialized, err := doc.WriteToString()
+		require.NoError(t, err)
+		parsed := etree.NewDocument()
+		require.NoError(t, parsed.ReadFromString(serialized))
+
+		root := parsed.Root()
+		_, err = (&VerifyContext{}).Verify(root.FindElement("//ds:"+dsig.SignatureTag), root)
+		require.NoError(t, err)
+
+		canonical, err := canonicalizeInContext(ctx.DataContext.Canonicalizer, root)
+		require.NoError(t, err)
+		require.Contains(t, string(canonical), dsig.SignatureTag)
+	}
+
+	// only the verified signature is removed, a signature added later is part of the signed content
+	root, signature := signAndReparse(t, testXML, ctx)
+	other, err := CreateSignature(newTestSignedData(t), ctx)
+	require.NoError(t, err)
+	root.AddChild(other)
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "#signedData")
+}
+
+// TestSignatureValuePrefixes check SignatureValue independently of Verify: SignedInfo is canonicalized inside the
+// parsed document as goxmldsig's validator does and the RSA signature is checked with crypto/rsa
+func TestSignatureValuePrefixes(t *testing.T) {
+	for _, prefix := range []string{"ds", "dsig", "sig1"} {
+		ctx := newTestSigningContext(t)
+		ctx.XmlDsigPrefix = prefix
+		root, _ := signAndReparse(t, testXML, ctx)
+		signature := findChild(root, dsig.SignatureTag)
+		require.Equal(t, prefix, signature.Space)
+
+		nsCtx, err := etreeutils.NSBuildParentContext(signature.SelectElement(prefix + ":" + dsig.SignedInfoTag))
+		require.NoError(t, err)
+		signedInfo, err := etreeutils.NSDetatch(nsCtx, signature.SelectElement(prefix+":"+dsig.SignedInfoTag))
+		require.NoError(t, err)
+		canonical, err := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("").Canonicalize(signedInfo)
+		require.NoError(t, err)
+		require.Contains(t, string(canonical), "<"+prefix+":SignedInfo xmlns:"+prefix+"=")
+
+		signatureValue, err := base64.StdEncoding.DecodeString(signature.SelectElement(prefix + ":" + dsig.SignatureValueTag).Text())
+		require.NoError(t, err)
+		digest := sha256.Sum256(canonical)
+		require.NoError(t, rsa.VerifyPKCS1v15(ctx.KeyStore.Cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signatureValue), prefix)
+
+		_, err = (&VerifyContext{}).Verify(signature, root)
+		require.NoError(t, err, prefix)
+	}
+}
+
+func TestVerifyAllowedAlgorithms(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	root, signature := signAndReparse(t, testXML, ctx)
+
+	exclusive := dsig.CanonicalXML10ExclusiveAlgorithmId.String()
+	verifyCtx := &VerifyContext{
+		AllowedCanonicalizationMethods: []string{exclusive},
+		AllowedSignatureMethods:        []string{signatureMethodIdentifiers[crypto.SHA256]},
+		AllowedDigestMethods:           []string{digestAlgorithmIdentifiers[crypto.SHA256]},
+	}
+	_, err := verifyCtx.Verify(signature, root)
+	require.NoError(t, err)
+
+	for _, restricted := range []VerifyContext{
+		{AllowedCanonicalizationMethods: []string{dsig.CanonicalXML11AlgorithmId.String()}},
+		{AllowedSignatureMethods: []string{signatureMethodIdentifiers[crypto.SHA512]}},
+		{AllowedDigestMethods: []string{digestAlgorithmIdentifiers[crypto.SHA512]}},
+	} {
+		_, err := restricted.Verify(signature, root)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "is not allowed")
+	}
+
+	ctx.DataContext.Canonicalizer = dsig.MakeC14N10RecCanonicalizer()
+	root, signature = signAndReparse(t, testXML, ctx)
+	_, err = verifyCtx.Verify(signature, root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "canonicalization transform")
+}
+
+func TestVerifyValidityAtSigningTime(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	keyStore := newTestKeyStoreFromTemplate(t, &x509.Certificate{
+		NotBefore: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	ctx.KeyStore = *keyStore
+	verifyCtx := &VerifyContext{CheckValidityAtSigningTime: true}
+
+	root, signature := signAndReparse(t, testXML, ctx)
+	_, err := verifyCtx.Verify(signature, root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "validity period")
+
+	ctx.PropertiesContext.SigninigTime = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	root, signature = signAndReparse(t, testXML, ctx)
+	result, err := verifyCtx.Verify(signature, root)
+	require.NoError(t, err)
+	require.True(t, ctx.PropertiesContext.SigninigTime.Equal(result.ReferenceTime))
+
+	ctx.PropertiesContext.OmitSigningTime = true
+	root, signature = signAndReparse(t, testXML, ctx)
+	_, err = verifyCtx.Verify(signature, root)
+	require.Error(t, err)
+	result, err = (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+	require.True(t, result.ReferenceTime.IsZero())
+
+	for _, genTime := range []time.Time{time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)} {
+		timeStampRoots, client := newTestTSA(t, genTime)
+		root, signature = signAndReparse(t, testXML, ctx)
+		require.NoError(t, AddSignatureTimeStamp(context.Background(), signature, &TimeStampContext{
+			Client:        client,
+			Hash:          crypto.SHA256,
+			Canonicalizer: dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""),
+		}))
+		_, err = verifyCtx.Verify(signature, root)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "TimeStampRoots")
+		result, err = (&VerifyContext{CheckValidityAtSigningTime: true, TimeStampRoots: timeStampRoots}).Verify(signature, root)
+		if genTime.Before(keyStore.Cert.NotBefore) {
+			require.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		require.True(t, genTime.Equal(result.ReferenceTime))
+	}
+
+	timeStampRoots, _ := newTestTSA(t, time.Time{})
+	root, signature = signAndReparse(t, testXML, ctx)
+	require.NoError(t, AddSignatureTimeStamp(context.Background(), signature, &TimeStampContext{
+		Client:        &derTimestampClient{genTime: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		Hash:          crypto.SHA256,
+		Canonicalizer: dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(""),
+	}))
+	_, err = (&VerifyContext{CheckValidityAtSigningTime: true, TimeStampRoots: timeStampRoots}).Verify(signature, root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SignerInfo")
+}
+
+func TestVerifyIgnoresUnsignedSigningTime(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	ctx.PropertiesContext.SigninigTime = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, donor := signAndReparse(t, testXML, ctx)
+	forgedObject := func() *etree.Element {
+		return findQualifyingProperties(donor).Parent().Copy()
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ctx.KeyStore.Cert)
+
+	// a QualifyingProperties injected before the signed one is not covered by the SignedProperties reference
+	ctx.PropertiesContext.OmitSigningTime = true
+	root, signature := signAndReparse(t, testXML, ctx)
+	signature.InsertChildAt(findQualifyingProperties(signature).Parent().Index(), forgedObject())
+	_, err := (&VerifyContext{CheckValidityAtSigningTime: true}).Verify(signature, root)
+	require.Error(t, err)
+	_, err = (&VerifyContext{RootCAs: roots}).Verify(signature, root)
+	require.Error(t, err)
+
+	// nor are the properties added to a plain XML DSig signature
+	ctx.PlainXMLDSig = true
+	root, signature = signAndReparse(t, testXML, ctx)
+	signature.AddChild(forgedObject())
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.NoError(t, err)
+	_, err = (&VerifyContext{CheckValidityAtSigningTime: true}).Verify(signature, root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signed SigningTime")
+	_, err = (&VerifyContext{RootCAs: roots}).Verify(signature, root)
+	require.True(t, errors.Is(err, ErrCertificatePath))
+}
+
+func TestVerifyCertificatePath(t *testing.T) {
+	root, intermediate, leaf := newTestCertChain(t)
+	ctx := newTestSigningContext(t)
+	ctx.KeyStore.Cert = leaf
+	ctx.KeyStore.CertBinary = leaf.Raw
+	ctx.KeyStore.CertChain = []*x509.Certificate{intermediate}
+	ctx.PropertiesContext.SigninigTime = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	verifyCtx := &VerifyContext{RootCAs: roots}
+
+	signedRoot, signature := signAndReparse(t, testXML, ctx)
+	result, err := verifyCtx.Verify(signature, signedRoot)
+	require.NoError(t, err)
+	require.True(t, ctx.PropertiesContext.SigninigTime.Equal(result.ReferenceTime))
+	require.Len(t, result.Chains, 1)
+	require.Equal(t, []*x509.Certificate{leaf, intermediate, root}, result.Chains[0])
+
+	// the intermediate comes from Intermediates when KeyInfo lacks it
+	ctx.KeyStore.CertChain = nil
+	signedRoot, signature = signAndReparse(t, testXML, ctx)
+	_, err = verifyCtx.Verify(signature, signedRoot)
+	require.True(t, errors.Is(err, ErrCertificatePath))
+	result, err = (&VerifyContext{RootCAs: roots, Intermediates: []*x509.Certificate{intermediate}}).Verify(signature, signedRoot)
+	require.NoError(t, err)
+	require.Len(t, result.Chains, 1)
+
+	other := x509.NewCertPool()
+	other.AddCert(newTestCertificate(t, caTemplate(4, "Other Root"), nil))
+	report := (&VerifyContext{RootCAs: other, Intermediates: []*x509.Certificate{intermediate}}).Report(signature, signedRoot)
+	require.False(t, report.Valid)
+	require.NoError(t, report.SignatureValue)
+	require.True(t, errors.Is(report.CertificatePath, ErrCertificatePath))
+
+	// the certificates are only valid from 2020
+	ctx.KeyStore.CertChain = []*x509.Certificate{intermediate}
+	ctx.PropertiesContext.SigninigTime = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	signedRoot, signature = signAndReparse(t, testXML, ctx)
+	_, err = verifyCtx.Verify(signature, signedRoot)
+	require.True(t, errors.Is(err, ErrCertificatePath))
+	_, err = (&VerifyContext{}).Verify(signature, signedRoot)
+	require.NoError(t, err)
+}
+
+func TestVerifySignedPropertiesDigest(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	_, signature := signAndReparse(t, testXML, ctx)
+	require.NoError(t, VerifySignedPropertiesDigest(signature))
+
+	// a tampered data reference does not matter
+	signature.FindElement("ds:" + dsig.SignedInfoTag + "/ds:" + dsig.ReferenceTag + "/ds:" + dsig.DigestValueTag).SetText("AAAA")
+	require.NoError(t, VerifySignedPropertiesDigest(signature))
+
+	signingTime := signature.FindElement(".//" + Prefix + ":" + SigningTimeTag)
+	signingTime.SetText("2000-01-01T00:00:00Z")
+	signedPropertiesURI := "#" + elementId(signature.FindElement(".//"+Prefix+":"+SignedPropertiesTag))
+	require.EqualError(t, VerifySignedPropertiesDigest(signature), `xades: digest of reference "`+signedPropertiesURI+`" does not match`)
+
+	ctx.PlainXMLDSig = true
+	_, signature = signAndReparse(t, testXML, ctx)
+	require.EqualError(t, VerifySignedPropertiesDigest(signature), "xades: SignedInfo has no SignedProperties reference")
+}
+
+func TestVerifyMixedDigestReferences(t *testing.T) {
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(`<root><first Id="first">one</first><second Id="second">two</second></root>`))
+	ctx := newTestSigningContext(t)
+	ctx.DataContext.IsEnveloped = false
+	ctx.DataContext.ReferenceURI = "#first"
+	signature, err := CreateSignature(doc.Root().SelectElement("first"), ctx)
+	require.NoError(t, err)
+	doc.Root().AddChild(signature)
+
+	signedInfo := findChild(signature, dsig.SignedInfoTag)
+	second := findChild(signedInfo, dsig.ReferenceTag).Copy()
+	second.CreateAttr(dsig.URIAttr, "#second")
+	findChild(second, dsig.DigestMethodTag).CreateAttr(dsig.AlgorithmAttr, digestAlgorithmIdentifiers[crypto.SHA512])
+	canonical, err := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("").Canonicalize(doc.Root().SelectElement("second").Copy())
+	require.NoError(t, err)
+	findChild(second, dsig.DigestValueTag).SetText(DigestBytes(canonical, crypto.SHA512))
+	signedInfo.InsertChildAt(findChild(signedInfo, dsig.ReferenceTag).Index()+1, second)
+
+	canonicalSignedInfo, err := canonicalizeInContext(ctx.Canonicalizer, signedInfo)
+	require.NoError(t, err)
+	digest := sha256.Sum256(canonicalSignedInfo)
+	value, err := rsa.SignPKCS1v15(nil, ctx.KeyStore.PrivateKey, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	findChild(signature, dsig.SignatureValueTag).SetText(base64.StdEncoding.EncodeToString(value))
+
+	summary, err := Summarize(signature)
+	require.NoError(t, err)
+	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA256], summary.References[0].DigestMethod)
+	require.Equal(t, digestAlgorithmIdentifiers[crypto.SHA512], summary.References[1].DigestMethod)
+	_, err = (&VerifyContext{}).Verify(signature, doc.Root())
+	require.NoError(t, err)
+
+	findChild(second, dsig.DigestMethodTag).CreateAttr(dsig.AlgorithmAttr, digestAlgorithmIdentifiers[crypto.SHA256])
+	_, err = (&VerifyContext{}).Verify(signature, doc.Root())
+	require.EqualError(t, err, `xades: digest of reference "#second" does not match`)
+}
+
+func TestVerifyRequiresDataReference(t *testing.T) {
+	ctx := newTestSigningContext(t)
+	root, signature := signAndReparse(t, testXML, ctx)
+
+	// a SignedInfo left with its SignedProperties reference only, signed again, binds no data
+	signedInfo := findChild(signature, dsig.SignedInfoTag)
+	signedInfo.RemoveChild(findChild(signedInfo, dsig.ReferenceTag))
+	canonicalSignedInfo, err := canonicalizeInContext(ctx.Canonicalizer, signedInfo)
+	require.NoError(t, err)
+	digest := sha256.Sum256(canonicalSignedInfo)
+	value, err := rsa.SignPKCS1v15(nil, ctx.KeyStore.PrivateKey, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	findChild(signature, dsig.SignatureValueTag).SetText(base64.StdEncoding.EncodeToString(value))
+
+	report := (&VerifyContext{}).Report(signature, root)
+	require.False(t, report.Valid)
+	require.NoError(t, report.SignatureValue)
+	require.NoError(t, report.SignedPropertiesReference)
+	require.EqualError(t, report.DataReferences, "xades: SignedInfo has no data reference")
+	_, err = (&VerifyContext{}).Verify(signature, root)
+	require.EqualError(t, err, "xades: SignedInfo has no data reference")
+}
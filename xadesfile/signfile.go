@@ -0,0 +1,69 @@
+// Package xadesfile signs XML files with a PKCS#12 key store, a convenience layer over package xades for
+// command-line tools. It is a separate package so that importing xades does not pull in the PKCS#12 decoder.
+package xadesfile
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/beevik/etree"
+	xades "github.com/julopez747/goxades"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// SignFile sign the XML document at inPath with the key and certificate of the PKCS#12 file at p12Path,
+// protected by password, and write the signed document to outPath. The signature is enveloped and covers the
+// whole document, see xades.SignDocument, created by xades.NewSigningContext with opts. outPath is not written
+// when signing fails.
+func SignFile(inPath, outPath, p12Path, password string, opts ...xades.Option) error {
+
+	p12, err := ioutil.ReadFile(p12Path)
+	if err != nil {
+		return err
+	}
+	keyStore, err := LoadPKCS12(p12, password)
+	if err != nil {
+		return err
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(inPath); err != nil {
+		return fmt.Errorf("xadesfile: cannot parse %q: %w", inPath, err)
+	}
+	if _, err := xades.SignDocument(doc, xades.NewSigningContext(keyStore, opts...)); err != nil {
+		return err
+	}
+	signed, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outPath, signed, 0644)
+}
+
+// LoadPKCS12 create MemoryX509KeyStore from the DER encoded PKCS#12 p12 protected by password. The signing
+// certificate is the one of the private key, its DER encoding is CertBinary and the other certificates of p12
+// are CertChain. RSA keys are set as PrivateKey, other keys as Signer
+func LoadPKCS12(p12 []byte, password string) (*xades.MemoryX509KeyStore, error) {
+
+	key, cert, caCerts, err := pkcs12.DecodeChain(p12, password)
+	if err != nil {
+		return nil, fmt.Errorf("xadesfile: cannot decode PKCS#12: %w", err)
+	}
+	keyStore := &xades.MemoryX509KeyStore{
+		Cert:       cert,
+		CertBinary: cert.Raw,
+		CertChain:  caCerts,
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		keyStore.PrivateKey = key
+	case crypto.Signer:
+		keyStore.Signer = key
+	default:
+		return nil, errors.New("xadesfile: PKCS#12 private key cannot sign")
+	}
+	return keyStore, nil
+}
@@ -0,0 +1,59 @@
+package xadesfile
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	xades "github.com/julopez747/goxades"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestSignFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(3020, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	p12, err := pkcs12.Encode(rand.Reader, key, cert, nil, "secret")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "invoice.xml")
+	outPath := filepath.Join(dir, "invoice-signed.xml")
+	p12Path := filepath.Join(dir, "signer.p12")
+	require.NoError(t, ioutil.WriteFile(inPath, []byte(`<?xml version="1.0" encoding="UTF-8"?><invoice><total>10.00</total></invoice>`), 0644))
+	require.NoError(t, ioutil.WriteFile(p12Path, p12, 0600))
+
+	require.NoError(t, SignFile(inPath, outPath, p12Path, "secret", xades.WithSigningTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))))
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromFile(outPath))
+	signature := doc.Root().SelectElement("ds:" + dsig.SignatureTag)
+	require.NotNil(t, signature)
+	result, err := (&xades.VerifyContext{}).Verify(signature, doc.Root())
+	require.NoError(t, err)
+	require.Equal(t, cert.Raw, result.Certificate.Raw)
+
+	missingPath := filepath.Join(dir, "missing.xml")
+	require.Error(t, SignFile(inPath, missingPath, p12Path, "wrong"))
+	_, err = os.Stat(missingPath)
+	require.True(t, os.IsNotExist(err))
+}
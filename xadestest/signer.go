@@ -0,0 +1,65 @@
+// Package xadestest provides test doubles for code signing with package xades.
+package xadestest
+
+import (
+	"encoding/base64"
+	"sync"
+
+	"github.com/beevik/etree"
+	xades "github.com/julopez747/goxades"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// DefaultSignatureMethod is the SignatureMethod of a Signer without Method, RSA-SHA256
+const DefaultSignatureMethod = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+
+// Signer is a fake xades.Signer returning Value as the SignatureValue of every signature and recording the
+// canonical SignedInfo octets it was asked to sign. The signatures it produces do not verify. It is safe for
+// concurrent use
+type Signer struct {
+	// Method is the SignatureMethod announced in SignedInfo, DefaultSignatureMethod when empty
+	Method string
+	// Value is the raw signature value, "signature" when nil
+	Value []byte
+	// Err is returned by CanonicalizeAndSign when set, to exercise signing failures
+	Err error
+
+	mu     sync.Mutex
+	signed [][]byte
+}
+
+var _ xades.Signer = (*Signer)(nil)
+
+// SignatureMethod return Method, DefaultSignatureMethod when empty
+func (s *Signer) SignatureMethod() string {
+	if s.Method == "" {
+		return DefaultSignatureMethod
+	}
+	return s.Method
+}
+
+// CanonicalizeAndSign record signedInfo canonicalized with canonicalizer and return the base64 of Value
+func (s *Signer) CanonicalizeAndSign(signedInfo *etree.Element, canonicalizer *dsig.Canonicalizer) (string, error) {
+	canonical, err := (*canonicalizer).Canonicalize(signedInfo)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.signed = append(s.signed, canonical)
+	s.mu.Unlock()
+	if s.Err != nil {
+		return "", s.Err
+	}
+	value := s.Value
+	if value == nil {
+		value = []byte("signature")
+	}
+	return base64.StdEncoding.EncodeToString(value), nil
+}
+
+// Signed return the canonical SignedInfo octets of every CanonicalizeAndSign call, in call order
+func (s *Signer) Signed() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.signed...)
+}
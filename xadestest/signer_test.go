@@ -0,0 +1,55 @@
+package xadestest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+	xades "github.com/julopez747/goxades"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(3020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	signer := &Signer{Value: []byte{1, 2, 3}}
+	// the key store provides the certificate only, its key is never used
+	ctx := xades.NewSigningContext(&xades.MemoryX509KeyStore{Cert: cert}, xades.WithSignatureUUID(uuid.Nil),
+		xades.WithSigningTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	ctx.Signer = signer
+	signedData := etree.NewElement("invoice")
+	signedData.CreateAttr("Id", "invoice")
+	ctx.DataContext.ReferenceURI = "#invoice"
+
+	plan, err := xades.Inspect(signedData, ctx)
+	require.NoError(t, err)
+	signature, err := xades.CreateSignature(signedData, ctx)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{plan.SignedInfoCanonical}, signer.Signed())
+	require.Equal(t, "AQID", signature.SelectElement("ds:"+dsig.SignatureValueTag).Text())
+	require.Equal(t, DefaultSignatureMethod, signature.FindElement("ds:"+dsig.SignedInfoTag+"/ds:"+dsig.SignatureMethodTag).SelectAttrValue(dsig.AlgorithmAttr, ""))
+
+	signer.Err = errors.New("backend unavailable")
+	_, err = xades.CreateSignature(signedData, ctx)
+	require.True(t, errors.Is(err, signer.Err))
+	require.Len(t, signer.Signed(), 2)
+}